@@ -0,0 +1,112 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+// Package audit records who changed or destroyed shared data, and what it was before.
+package audit
+
+import (
+	"log"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/velour/catbase/bot/msg"
+)
+
+// Entry is one recorded action
+type Entry struct {
+	ID      int64
+	Time    time.Time
+	UserID  string
+	Nick    string
+	Channel string
+	Plugin  string
+	// Action names what was done, e.g. "set" or "forget"
+	Action string
+	// Target is the thing acted on, e.g. a config key or factoid trigger
+	Target string
+	Before string
+	After  string
+}
+
+// Migrate creates the audit table
+func Migrate(db *sqlx.DB) error {
+	_, err := db.Exec(`create table if not exists audit (
+			id integer primary key,
+			time integer,
+			user_id string,
+			nick string,
+			channel string,
+			plugin string,
+			action string,
+			target string,
+			before string,
+			after string
+		);`)
+	return err
+}
+
+// New starts an entry for an action requested by a message
+func New(m msg.Message, plugin, action, target string) Entry {
+	e := Entry{
+		Time:    time.Now(),
+		Channel: m.Channel,
+		Plugin:  plugin,
+		Action:  action,
+		Target:  target,
+	}
+	if m.User != nil {
+		e.UserID, e.Nick = m.User.ID, m.User.Name
+	}
+	return e
+}
+
+// Record stores an entry
+func Record(db *sqlx.DB, e Entry) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	_, err := db.Exec(`insert into audit
+		(time, user_id, nick, channel, plugin, action, target, before, after)
+		values (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.Time.Unix(), e.UserID, e.Nick, e.Channel, e.Plugin, e.Action, e.Target, e.Before, e.After)
+	return err
+}
+
+// Log records an entry, only logging failures because a broken audit log
+// shouldn't stop the action being audited
+func Log(db *sqlx.DB, e Entry) {
+	if err := Record(db, e); err != nil {
+		log.Printf("Could not audit %s %s %s: %s", e.Plugin, e.Action, e.Target, err)
+	}
+}
+
+// Recent lists the newest entries, optionally only those for one plugin
+func Recent(db *sqlx.DB, plugin string, limit int) ([]Entry, error) {
+	q := `select id, time, user_id, nick, channel, plugin, action, target, before, after
+		from audit`
+	args := []interface{}{}
+	if plugin != "" {
+		q += ` where plugin = ?`
+		args = append(args, plugin)
+	}
+	q += ` order by id desc limit ?`
+	args = append(args, limit)
+
+	rows, err := db.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries := []Entry{}
+	for rows.Next() {
+		var e Entry
+		var t int64
+		err := rows.Scan(&e.ID, &t, &e.UserID, &e.Nick, &e.Channel, &e.Plugin,
+			&e.Action, &e.Target, &e.Before, &e.After)
+		if err != nil {
+			return nil, err
+		}
+		e.Time = time.Unix(t, 0)
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,41 @@
+package audit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/bot/user"
+	"github.com/velour/catbase/config"
+)
+
+func setup(t *testing.T) *config.Config {
+	cfg := config.ReadConfig("file:audittest?mode=memory&cache=shared")
+	assert.Nil(t, Migrate(cfg.DB))
+	cfg.MustExec(`delete from audit`)
+	return cfg
+}
+
+func TestRecordAndRecent(t *testing.T) {
+	cfg := setup(t)
+	m := msg.Message{User: &user.User{ID: "U1", Name: "alice"}, Channel: "#test"}
+
+	e := New(m, "fact", "forget", "coffee")
+	e.Before = "coffee <is> great"
+	assert.Nil(t, Record(cfg.DB, e))
+	Log(cfg.DB, New(m, "counter", "clear", "alice.tea"))
+
+	entries, err := Recent(cfg.DB, "", 10)
+	assert.Nil(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "counter", entries[0].Plugin)
+	assert.Equal(t, "U1", entries[1].UserID)
+	assert.Equal(t, "alice", entries[1].Nick)
+	assert.Equal(t, "#test", entries[1].Channel)
+	assert.Equal(t, "coffee <is> great", entries[1].Before)
+
+	entries, err = Recent(cfg.DB, "fact", 10)
+	assert.Nil(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "forget", entries[0].Action)
+}
@@ -10,7 +10,7 @@ import (
 	"strings"
 
 	"github.com/jmoiron/sqlx"
-	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/bot/audit"
 	"github.com/velour/catbase/bot/msglog"
 	"github.com/velour/catbase/bot/user"
 	"github.com/velour/catbase/config"
@@ -32,18 +32,20 @@ type bot struct {
 
 	conn Connector
 
-	logIn  chan msg.Message
-	logOut chan msg.Messages
+	history *msglog.Store
 
 	version string
 
 	// The entries to the bot's HTTP interface
-	httpEndPoints map[string]string
+	httpEndPoints map[string]webEndPoint
 
 	// filters registered by plugins
 	filters map[string]func(string) string
 
 	callbacks CallbackMap
+
+	// permissions registered by plugins, keyed like callbacks
+	permissions map[string][]permission
 }
 
 // Variable represents a $var replacement
@@ -53,14 +55,9 @@ type Variable struct {
 
 // New creates a bot for a given connection and set of handlers.
 func New(config *config.Config, connector Connector) Bot {
-	logIn := make(chan msg.Message)
-	logOut := make(chan msg.Messages)
-
-	msglog.RunNew(logIn, logOut)
-
 	users := []user.User{
 		user.User{
-			Name: config.Get("Nick", "bot"),
+			Name: config.Get("Nick", ""),
 		},
 	}
 
@@ -71,22 +68,41 @@ func New(config *config.Config, connector Connector) Bot {
 		conn:           connector,
 		users:          users,
 		me:             users[0],
-		logIn:          logIn,
-		logOut:         logOut,
-		httpEndPoints:  make(map[string]string),
+		httpEndPoints:  make(map[string]webEndPoint),
 		filters:        make(map[string]func(string) string),
 		callbacks:      make(CallbackMap),
+		permissions:    make(map[string][]permission),
 	}
 
 	bot.migrateDB()
 
-	http.HandleFunc("/", bot.serveRoot)
+	history, err := msglog.New(bot.DB(), config)
+	if err != nil {
+		log.Fatal("Initial DB migration create msglog table: ", err)
+	}
+	bot.history = history
+	for _, nick := range nickAdmins(config, history) {
+		log.Printf("WARNING: Admins entry %s is a nick, Admins holds connector user IDs so it grants nothing", nick)
+	}
+
+	HandleWeb(config, "/", WebPublic, bot.serveRoot)
 
 	connector.RegisterEvent(bot.Receive)
 
 	return bot
 }
 
+// webEndPoint is a page listed on the index
+type webEndPoint struct {
+	Path   string
+	Access Access
+}
+
+// Admin reports whether the page needs the web token
+func (e webEndPoint) Admin() bool {
+	return e.Access == WebAdmin
+}
+
 // Config gets the configuration that the bot is using
 func (b *bot) Config() *config.Config {
 	return b.config
@@ -107,6 +123,12 @@ func (b *bot) migrateDB() {
 		);`); err != nil {
 		log.Fatal("Initial DB migration create variables table: ", err)
 	}
+	if err := migrateRoles(b.DB()); err != nil {
+		log.Fatal("Initial DB migration create roles table: ", err)
+	}
+	if err := audit.Migrate(b.DB()); err != nil {
+		log.Fatal("Initial DB migration create audit table: ", err)
+	}
 }
 
 // Adds a constructed handler to the bots handlers list
@@ -116,6 +138,15 @@ func (b *bot) AddPlugin(h Plugin) {
 	b.pluginOrdering = append(b.pluginOrdering, name)
 }
 
+// PluginNames lists the short names of every plugin in priority order
+func (b *bot) PluginNames() []string {
+	names := []string{}
+	for _, n := range b.pluginOrdering {
+		names = append(names, shortName(n))
+	}
+	return names
+}
+
 func (b *bot) Who(channel string) []user.User {
 	names := b.conn.Who(channel)
 	users := []user.User{}
@@ -145,7 +176,7 @@ var rootIndex = `
 			<tbody>
 				{{range $key, $value := .EndPoints}}
 				<tr>
-					<td><a href="{{$value}}">{{$key}}</a></td>
+					<td><a href="{{$value.Path}}">{{$key}}</a>{{if $value.Admin}} (admin){{end}}</td>
 				</tr>
 				{{end}}
 			</tbody>
@@ -167,8 +198,8 @@ func (b *bot) serveRoot(w http.ResponseWriter, r *http.Request) {
 
 // IsCmd checks if message is a command and returns its curtailed version
 func IsCmd(c *config.Config, message string) (bool, string) {
-	cmdcs := c.GetArray("CommandChar", []string{"!"})
-	botnick := strings.ToLower(c.Get("Nick", "bot"))
+	cmdcs := c.GetArray("CommandChar", nil)
+	botnick := strings.ToLower(c.Get("Nick", ""))
 	if botnick == "" {
 		log.Fatalf(`You must run catbase -set nick -val <your bot nick>`)
 	}
@@ -202,22 +233,12 @@ func IsCmd(c *config.Config, message string) (bool, string) {
 	return iscmd, message
 }
 
-func (b *bot) CheckAdmin(nick string) bool {
-	for _, u := range b.Config().GetArray("Admins", []string{}) {
-		if nick == u {
-			return true
-		}
-	}
-	return false
-}
-
 var users = map[string]*user.User{}
 
 func (b *bot) GetUser(nick string) *user.User {
 	if _, ok := users[nick]; !ok {
 		users[nick] = &user.User{
-			Name:  nick,
-			Admin: b.checkAdmin(nick),
+			Name: nick,
 		}
 	}
 	return users[nick]
@@ -225,18 +246,8 @@ func (b *bot) GetUser(nick string) *user.User {
 
 func (b *bot) NewUser(nick string) *user.User {
 	return &user.User{
-		Name:  nick,
-		Admin: b.checkAdmin(nick),
-	}
-}
-
-func (b *bot) checkAdmin(nick string) bool {
-	for _, u := range b.Config().GetArray("Admins", []string{}) {
-		if nick == u {
-			return true
-		}
+		Name: nick,
 	}
-	return false
 }
 
 // Register a text filter which every outgoing message is passed through
@@ -256,6 +267,11 @@ func (b *bot) Register(p Plugin, kind Kind, cb Callback) {
 	b.callbacks[t][kind] = append(b.callbacks[t][kind], cb)
 }
 
-func (b *bot) RegisterWeb(root, name string) {
-	b.httpEndPoints[name] = root
+// RegisterWeb serves h at root behind the checks for access.
+// Pages with a name are listed on the index page.
+func (b *bot) RegisterWeb(root, name string, access Access, h http.HandlerFunc) {
+	HandleWeb(b.config, root, access, h)
+	if name != "" {
+		b.httpEndPoints[name] = webEndPoint{root, access}
+	}
 }
@@ -0,0 +1,39 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+package bot
+
+import (
+	"strings"
+
+	"github.com/velour/catbase/config"
+)
+
+// NetworkChannels lists the channels a connector for network should join.
+// When several networks run at once, channels are namespaced like irc:#cats
+// and each network only gets its own, with the prefix removed.
+func NetworkChannels(c *config.Config, network string) []string {
+	networks := map[string]bool{}
+	for _, n := range c.GetArray("multi.networks", []string{}) {
+		networks[n] = true
+	}
+	channels := []string{}
+	for _, ch := range c.GetArray("channels", []string{}) {
+		name, rest := SplitChannel(ch)
+		if !networks[name] {
+			channels = append(channels, ch)
+		} else if name == network {
+			channels = append(channels, rest)
+		}
+	}
+	return channels
+}
+
+// SplitChannel splits a namespaced channel into its network and the
+// channel on that network. Matrix rooms have colons too, so only the first counts.
+func SplitChannel(channel string) (string, string) {
+	i := strings.Index(channel, ":")
+	if i < 0 {
+		return "", channel
+	}
+	return channel[:i], channel[i+1:]
+}
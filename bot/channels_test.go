@@ -0,0 +1,20 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNetworkChannels(t *testing.T) {
+	mb := NewMockBot()
+	mb.Cfg.Set("channels", "#plain;;irc:#cats;;matrix:!cats:example.org;;!room:example.org")
+
+	// without multi.networks nothing is namespaced
+	assert.Equal(t, []string{"#plain", "irc:#cats", "matrix:!cats:example.org", "!room:example.org"},
+		NetworkChannels(mb.Cfg, "irc"))
+
+	mb.Cfg.Set("multi.networks", "irc;;matrix")
+	assert.Equal(t, []string{"#plain", "#cats", "!room:example.org"}, NetworkChannels(mb.Cfg, "irc"))
+	assert.Equal(t, []string{"#plain", "!cats:example.org", "!room:example.org"}, NetworkChannels(mb.Cfg, "matrix"))
+}
@@ -4,7 +4,6 @@ package bot
 
 import (
 	"database/sql"
-	"errors"
 	"fmt"
 	"log"
 	"math/rand"
@@ -15,33 +14,61 @@ import (
 	"time"
 
 	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/bot/msglog"
 )
 
 func (b *bot) Receive(kind Kind, msg msg.Message, args ...interface{}) bool {
 	log.Println("Received event: ", msg)
+	gate := NewPluginGate(b.config, msg.Channel)
 
 	// msg := b.buildMessage(client, inMsg)
 	// do need to look up user and fix it
 	if kind == Message && strings.HasPrefix(msg.Body, "help") && msg.Command {
 		parts := strings.Fields(strings.ToLower(msg.Body))
-		b.checkHelp(msg.Channel, parts)
+		b.checkHelp(msg, parts)
 		log.Println("Handled a help, returning")
 		goto RET
 	}
 
 	for _, name := range b.pluginOrdering {
-		if b.runCallback(b.plugins[name], kind, msg, args...) {
+		if b.runCallback(gate, b.plugins[name], kind, msg, args...) {
 			goto RET
 		}
 	}
 
+	// a reply no plugin was waiting for is an ordinary message, which on
+	// some services is how everything in a thread arrives, except for our
+	// own posts in a thread which we must not answer
+	if kind == Reply && !b.fromMe(msg) {
+		return b.Receive(Message, msg)
+	}
+
 RET:
-	b.logIn <- msg
+	if _, err := b.history.Add(msg); err != nil {
+		log.Printf("Could not log message: %s", err)
+	}
 	return true
 }
 
-func (b *bot) runCallback(plugin Plugin, evt Kind, message msg.Message, args ...interface{}) bool {
+// fromMe reports whether a message was sent by the bot itself, by its ID
+// when the connector knows it and by its nick otherwise
+func (b *bot) fromMe(message msg.Message) bool {
+	if sc, ok := b.conn.(SelfChecker); ok {
+		if self, known := sc.FromMe(message); known {
+			return self
+		}
+	}
+	return message.User != nil && strings.EqualFold(message.User.Name, b.me.Name)
+}
+
+func (b *bot) runCallback(gate PluginGate, plugin Plugin, evt Kind, message msg.Message, args ...interface{}) bool {
 	t := reflect.TypeOf(plugin).String()
+	if !gate.Enabled(shortName(t)) {
+		return false
+	}
+	if evt == Message && !b.checkPermission(t, message) {
+		return true
+	}
 	for _, cb := range b.callbacks[t][evt] {
 		if cb(evt, message, args...) {
 			return true
@@ -50,9 +77,19 @@ func (b *bot) runCallback(plugin Plugin, evt Kind, message msg.Message, args ...
 	return false
 }
 
-// Send a message to the connection
+// Send a message to the connection using positional arguments
 func (b *bot) Send(kind Kind, args ...interface{}) (string, error) {
-	return b.conn.Send(kind, args...)
+	out, err := NewOutgoing(kind, args...)
+	if err != nil {
+		log.Printf("Could not send %s: %s", kind, err)
+		return "", err
+	}
+	return b.SendOutgoing(kind, out)
+}
+
+// SendOutgoing sends a structured message to the connection
+func (b *bot) SendOutgoing(kind Kind, out Outgoing) (string, error) {
+	return b.conn.Send(kind, out)
 }
 
 func (b *bot) GetEmojiList() map[string]string {
@@ -60,53 +97,54 @@ func (b *bot) GetEmojiList() map[string]string {
 }
 
 // Checks to see if the user is asking for help, returns true if so and handles the situation.
-func (b *bot) checkHelp(channel string, parts []string) {
+func (b *bot) checkHelp(message msg.Message, parts []string) {
 	if len(parts) == 1 {
 		// just print out a list of help topics
 		topics := "Help topics: about variables"
 		for name, _ := range b.plugins {
-			name = strings.Split(strings.TrimPrefix(name, "*"), ".")[0]
+			name = shortName(name)
 			topics = fmt.Sprintf("%s, %s", topics, name)
 		}
-		b.Send(Message, channel, topics)
+		b.Send(Message, message, topics)
 	} else {
 		// trigger the proper plugin's help response
 		if parts[1] == "about" {
-			b.Help(channel, parts)
+			b.Help(message, parts)
 			return
 		}
 		if parts[1] == "variables" {
-			b.listVars(channel, parts)
+			b.listVars(message, parts)
 			return
 		}
 		for name, plugin := range b.plugins {
 			if strings.HasPrefix(name, "*"+parts[1]) {
-				if b.runCallback(plugin, Help, msg.Message{Channel: channel}, channel, parts) {
+				if b.runCallback(NewPluginGate(b.config, message.Channel), plugin, Help, message, message.Channel, parts) {
 					return
 				} else {
 					msg := fmt.Sprintf("I'm sorry, I don't know how to help you with %s.", parts[1])
-					b.Send(Message, channel, msg)
+					b.Send(Message, message, msg)
 					return
 				}
 			}
 		}
 		msg := fmt.Sprintf("I'm sorry, I don't know what %s is!", strings.Join(parts, " "))
-		b.Send(Message, channel, msg)
+		b.Send(Message, message, msg)
 	}
 }
 
+// LastMessage gives the most recent message seen in a channel
 func (b *bot) LastMessage(channel string) (msg.Message, error) {
-	log := <-b.logOut
-	if len(log) == 0 {
-		return msg.Message{}, errors.New("No messages found.")
-	}
-	for i := len(log) - 1; i >= 0; i-- {
-		msg := log[i]
-		if strings.ToLower(msg.Channel) == strings.ToLower(channel) {
-			return msg, nil
-		}
-	}
-	return msg.Message{}, errors.New("No messages found.")
+	return b.history.Last(channel)
+}
+
+// LastThreadMessage gives the most recent message seen in a thread
+func (b *bot) LastThreadMessage(channel, thread string) (msg.Message, error) {
+	return b.history.LastInThread(channel, thread)
+}
+
+// History searches the message log, newest first
+func (b *bot) History(q msglog.Query) ([]msglog.Entry, error) {
+	return b.history.Find(q)
 }
 
 // Take an input string and mutate it based on $vars in the string
@@ -124,8 +162,10 @@ func (b *bot) Filter(message msg.Message, input string) string {
 	}
 
 	for strings.Contains(input, "$someone") {
-		nicks := b.Who(message.Channel)
-		someone := nicks[rand.Intn(len(nicks))].Name
+		someone := message.User.Name
+		if nicks := b.Who(message.Channel); len(nicks) > 0 {
+			someone = nicks[rand.Intn(len(nicks))].Name
+		}
 		input = strings.Replace(input, "$someone", someone, 1)
 	}
 
@@ -166,7 +206,7 @@ func (b *bot) Filter(message msg.Message, input string) string {
 
 func (b *bot) getVar(varName string) (string, error) {
 	var text string
-	err := b.DB().Get(&text, `select value from variables where name=? order by random() limit 1`, varName)
+	err := b.DB().Get(&text, `select value from variables where name=? order by `+b.config.Dialect.Random()+` limit 1`, varName)
 	switch {
 	case err == sql.ErrNoRows:
 		return "", fmt.Errorf("No factoid found")
@@ -176,7 +216,7 @@ func (b *bot) getVar(varName string) (string, error) {
 	return text, nil
 }
 
-func (b *bot) listVars(channel string, parts []string) {
+func (b *bot) listVars(message msg.Message, parts []string) {
 	var variables []string
 	err := b.DB().Select(&variables, `select name from variables group by name`)
 	if err != nil {
@@ -186,14 +226,14 @@ func (b *bot) listVars(channel string, parts []string) {
 	if len(variables) > 0 {
 		msg += ", " + strings.Join(variables, ", ")
 	}
-	b.Send(Message, channel, msg)
+	b.Send(Message, message, msg)
 }
 
-func (b *bot) Help(channel string, parts []string) {
+func (b *bot) Help(message msg.Message, parts []string) {
 	msg := fmt.Sprintf("Hi, I'm based on godeepintir version %s. I'm written in Go, and you "+
 		"can find my source code on the internet here: "+
 		"http://github.com/velour/catbase", b.version)
-	b.Send(Message, channel, msg)
+	b.Send(Message, message, msg)
 }
 
 // Send our own musings to the plugins
@@ -209,8 +249,9 @@ func (b *bot) selfSaid(channel, message string, action bool) {
 		Host:    "0.0.0.0", // hack
 	}
 
+	gate := NewPluginGate(b.config, channel)
 	for _, name := range b.pluginOrdering {
-		if b.runCallback(b.plugins[name], SelfMessage, msg) {
+		if b.runCallback(gate, b.plugins[name], SelfMessage, msg) {
 			return
 		}
 	}
@@ -3,8 +3,12 @@
 package bot
 
 import (
+	"fmt"
+	"net/http"
+
 	"github.com/jmoiron/sqlx"
 	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/bot/msglog"
 	"github.com/velour/catbase/bot/user"
 	"github.com/velour/catbase/config"
 )
@@ -31,6 +35,29 @@ const (
 )
 
 type Kind int
+
+func (k Kind) String() string {
+	switch k {
+	case Message:
+		return "Message"
+	case Reply:
+		return "Reply"
+	case Action:
+		return "Action"
+	case Reaction:
+		return "Reaction"
+	case Edit:
+		return "Edit"
+	case Event:
+		return "Event"
+	case Help:
+		return "Help"
+	case SelfMessage:
+		return "SelfMessage"
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
 type Callback func(Kind, msg.Message, ...interface{}) bool
 type CallbackMap map[string]map[Kind][]Callback
 
@@ -44,8 +71,12 @@ type Bot interface {
 	Who(string) []user.User
 	// AddPlugin registers a new plugin handler
 	AddPlugin(Plugin)
-	// First arg should be one of bot.Message/Reply/Action/etc
+	// PluginNames lists the short names of the registered plugins
+	PluginNames() []string
+	// Send takes positional arguments for compatibility, see NewOutgoing
 	Send(Kind, ...interface{}) (string, error)
+	// SendOutgoing sends a structured message of any Kind
+	SendOutgoing(Kind, Outgoing) (string, error)
 	// First arg should be one of bot.Message/Reply/Action/etc
 	Receive(Kind, msg.Message, ...interface{}) bool
 	// Register a callback
@@ -53,18 +84,31 @@ type Bot interface {
 
 	Filter(msg.Message, string) string
 	LastMessage(string) (msg.Message, error)
+	// LastThreadMessage is LastMessage for one thread of a channel
+	LastThreadMessage(string, string) (msg.Message, error)
+	// History searches the message log, newest first
+	History(msglog.Query) ([]msglog.Entry, error)
 
-	CheckAdmin(string) bool
+	// UserRole gives the role of a user, looked up by their connector ID
+	UserRole(*user.User) Role
+	// SetRole gives the user with a connector ID a role
+	SetRole(string, Role) error
+	// RequireRole restricts a plugin's commands matching a pattern to a role
+	RequireRole(Plugin, Role, string)
 	GetEmojiList() map[string]string
 	RegisterFilter(string, func(string) string)
-	RegisterWeb(string, string)
+	// RegisterWeb serves a handler at a path for users with the given access,
+	// listing it on the index page under a name if one is given
+	RegisterWeb(string, string, Access, http.HandlerFunc)
 }
 
 // Connector represents a server connection to a chat service
 type Connector interface {
 	RegisterEvent(Callback)
 
-	Send(Kind, ...interface{}) (string, error)
+	// Send delivers a message, returning its identifier.
+	// Kinds the service cannot deliver return an error wrapping ErrUnsupported.
+	Send(Kind, Outgoing) (string, error)
 
 	GetEmojiList() map[string]string
 	Serve() error
@@ -72,6 +116,13 @@ type Connector interface {
 	Who(string) []string
 }
 
+// SelfChecker is implemented by connectors that know the user or bot ID
+// they post as, which is surer than comparing nicks. known is false when
+// the connector can't tell for this message.
+type SelfChecker interface {
+	FromMe(msg.Message) (self, known bool)
+}
+
 // Plugin interface used for compatibility with the Plugin interface
 // Uhh it turned empty, but we're still using it to ID plugins
 type Plugin interface {
@@ -0,0 +1,69 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+package bot
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/velour/catbase/config"
+)
+
+// ChannelLoops keeps one goroutine running for each channel in a config
+// array, starting and stopping them as the array is changed
+type ChannelLoops struct {
+	sync.Mutex
+	run   func(channel string, quit <-chan struct{})
+	quits map[string]chan struct{}
+}
+
+// WatchChannels starts run for each channel listed under key and keeps the
+// set of running loops in step with the key. run should return soon after
+// quit is closed.
+func WatchChannels(c *config.Config, key string, run func(channel string, quit <-chan struct{})) *ChannelLoops {
+	l := &ChannelLoops{
+		run:   run,
+		quits: map[string]chan struct{}{},
+	}
+	l.Set(c.GetArray(key, []string{}))
+	c.Watch(key, func(_, _ string) {
+		l.Set(c.GetArray(key, []string{}))
+	})
+	return l
+}
+
+// Set starts loops for new channels and stops loops for channels not listed
+func (l *ChannelLoops) Set(channels []string) {
+	l.Lock()
+	defer l.Unlock()
+	want := map[string]bool{}
+	for _, ch := range channels {
+		ch = strings.TrimSpace(ch)
+		if ch == "" {
+			continue
+		}
+		want[ch] = true
+		if _, ok := l.quits[ch]; !ok {
+			quit := make(chan struct{})
+			l.quits[ch] = quit
+			go l.run(ch, quit)
+		}
+	}
+	for ch, quit := range l.quits {
+		if !want[ch] {
+			close(quit)
+			delete(l.quits, ch)
+		}
+	}
+}
+
+// Channels lists the channels with a running loop
+func (l *ChannelLoops) Channels() []string {
+	l.Lock()
+	defer l.Unlock()
+	channels := []string{}
+	for ch := range l.quits {
+		channels = append(channels, ch)
+	}
+	return channels
+}
@@ -0,0 +1,42 @@
+package bot
+
+import (
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatchChannels(t *testing.T) {
+	mb := NewMockBot()
+	mb.Config().SetArray("Test.Channels", []string{"#a", "#b"})
+
+	var mu sync.Mutex
+	stopped := []string{}
+	done := make(chan struct{}, 4)
+	loops := WatchChannels(mb.Config(), "Test.Channels", func(ch string, quit <-chan struct{}) {
+		<-quit
+		mu.Lock()
+		stopped = append(stopped, ch)
+		mu.Unlock()
+		done <- struct{}{}
+	})
+	running := loops.Channels()
+	sort.Strings(running)
+	assert.Equal(t, []string{"#a", "#b"}, running)
+
+	mb.Config().SetArray("Test.Channels", []string{"#b", "#c"})
+	<-done
+	running = loops.Channels()
+	sort.Strings(running)
+	assert.Equal(t, []string{"#b", "#c"}, running)
+	mu.Lock()
+	assert.Equal(t, []string{"#a"}, stopped)
+	mu.Unlock()
+
+	loops.Set(nil)
+	<-done
+	<-done
+	assert.Empty(t, loops.Channels())
+}
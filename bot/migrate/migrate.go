@@ -0,0 +1,158 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+// Package migrate evolves the tables each plugin keeps, one numbered step at a time.
+package migrate
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Migration is one forward step of a plugin's schema
+type Migration struct {
+	// Version numbers start at 1 and must not be reused
+	Version     int
+	Description string
+	// SQL may hold several statements. They run in one transaction, but
+	// MySQL commits every create, alter and drop as it goes, so there a
+	// migration that fails partway leaves its earlier statements applied
+	// and has to be finished by hand before Up will get past it.
+	SQL string
+}
+
+var registry = struct {
+	sync.Mutex
+	migrations map[string][]Migration
+}{migrations: map[string][]Migration{}}
+
+// Register declares the migrations for a plugin.
+// Plugins call it from init so -migrate-status knows about every plugin.
+func Register(plugin string, migrations ...Migration) {
+	registry.Lock()
+	defer registry.Unlock()
+	ms := append(registry.migrations[plugin], migrations...)
+	sort.Slice(ms, func(i, j int) bool { return ms[i].Version < ms[j].Version })
+	for i := 1; i < len(ms); i++ {
+		if ms[i].Version == ms[i-1].Version {
+			panic(fmt.Sprintf("migration %d registered twice for %s", ms[i].Version, plugin))
+		}
+	}
+	registry.migrations[plugin] = ms
+}
+
+// Registered gives the migrations declared for a plugin, oldest first
+func Registered(plugin string) []Migration {
+	registry.Lock()
+	defer registry.Unlock()
+	return append([]Migration{}, registry.migrations[plugin]...)
+}
+
+// Plugins lists the plugins with registered migrations
+func Plugins() []string {
+	registry.Lock()
+	defer registry.Unlock()
+	plugins := []string{}
+	for p := range registry.migrations {
+		plugins = append(plugins, p)
+	}
+	sort.Strings(plugins)
+	return plugins
+}
+
+func migrateSelf(db *sqlx.DB) error {
+	_, err := db.Exec(`create table if not exists schema_migrations (
+			plugin string,
+			version integer,
+			description string,
+			applied integer,
+			primary key (plugin, version)
+		);`)
+	return err
+}
+
+// Version gives the newest migration applied for a plugin, 0 if none are
+func Version(db *sqlx.DB, plugin string) (int, error) {
+	if err := migrateSelf(db); err != nil {
+		return 0, err
+	}
+	var v int
+	err := db.Get(&v, `select coalesce(max(version), 0) from schema_migrations where plugin=?`, plugin)
+	return v, err
+}
+
+// Up runs every migration for a plugin that hasn't been applied yet,
+// each in its own transaction. On SQLite and Postgres a failed migration
+// rolls back completely; on MySQL only its data changes do, see Migration.
+func Up(db *sqlx.DB, plugin string) error {
+	current, err := Version(db, plugin)
+	if err != nil {
+		return err
+	}
+	for _, m := range Registered(plugin) {
+		if m.Version <= current {
+			continue
+		}
+		if err := apply(db, plugin, m); err != nil {
+			return fmt.Errorf("%s migration %d (%s): %s", plugin, m.Version, m.Description, err)
+		}
+	}
+	return nil
+}
+
+func apply(db *sqlx.DB, plugin string, m Migration) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(m.SQL); err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec(`insert into schema_migrations (plugin, version, description, applied)
+		values (?, ?, ?, ?)`, plugin, m.Version, m.Description, time.Now().Unix())
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// State describes how far along a plugin's schema is
+type State struct {
+	Plugin  string
+	Current int
+	Latest  int
+	Pending []Migration
+}
+
+func (s State) String() string {
+	str := fmt.Sprintf("%s: version %d of %d", s.Plugin, s.Current, s.Latest)
+	for _, m := range s.Pending {
+		str += fmt.Sprintf("\n  pending %d: %s", m.Version, m.Description)
+	}
+	return str
+}
+
+// Status reports the state of every plugin with registered migrations
+func Status(db *sqlx.DB) ([]State, error) {
+	states := []State{}
+	for _, plugin := range Plugins() {
+		current, err := Version(db, plugin)
+		if err != nil {
+			return nil, err
+		}
+		s := State{Plugin: plugin, Current: current}
+		for _, m := range Registered(plugin) {
+			s.Latest = m.Version
+			if m.Version > current {
+				s.Pending = append(s.Pending, m)
+			}
+		}
+		states = append(states, s)
+	}
+	return states, nil
+}
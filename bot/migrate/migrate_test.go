@@ -0,0 +1,53 @@
+package migrate
+
+import (
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUp(t *testing.T) {
+	db := sqlx.MustOpen("sqlite3", ":memory:")
+	db.SetMaxOpenConns(1)
+	Register("uptest",
+		Migration{Version: 2, Description: "add colour", SQL: `alter table things add colour string;`},
+		Migration{Version: 1, Description: "create things", SQL: `create table things (id integer primary key, name string);`},
+	)
+
+	assert.NoError(t, Up(db, "uptest"))
+	v, err := Version(db, "uptest")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, v)
+	db.MustExec(`insert into things (name, colour) values ('cat', 'orange')`)
+
+	// running again does nothing
+	assert.NoError(t, Up(db, "uptest"))
+}
+
+func TestUpRollsBack(t *testing.T) {
+	db := sqlx.MustOpen("sqlite3", ":memory:")
+	db.SetMaxOpenConns(1)
+	Register("failtest",
+		Migration{Version: 1, Description: "create widgets", SQL: `create table widgets (id integer primary key);`},
+		Migration{Version: 2, Description: "broken", SQL: `create table gadgets (id integer); nonsense;`},
+	)
+
+	assert.Error(t, Up(db, "failtest"))
+	v, _ := Version(db, "failtest")
+	assert.Equal(t, 1, v)
+	var n int
+	assert.NoError(t, db.Get(&n, `select count(*) from sqlite_master where name='gadgets'`))
+	assert.Equal(t, 0, n)
+
+	states, err := Status(db)
+	assert.NoError(t, err)
+	for _, s := range states {
+		if s.Plugin == "failtest" {
+			assert.Equal(t, 1, s.Current)
+			assert.Equal(t, 2, s.Latest)
+			assert.Len(t, s.Pending, 1)
+		}
+	}
+}
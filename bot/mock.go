@@ -11,7 +11,9 @@ import (
 
 	"github.com/jmoiron/sqlx"
 	"github.com/stretchr/testify/mock"
+	"github.com/velour/catbase/bot/audit"
 	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/bot/msglog"
 	"github.com/velour/catbase/bot/user"
 	"github.com/velour/catbase/config"
 )
@@ -25,35 +27,73 @@ type MockBot struct {
 	Messages  []string
 	Actions   []string
 	Reactions []string
+	Plugins   []string
+	// Members lists the nicks Who gives for each channel
+	Members map[string][]string
+
+	history *msglog.Store
 }
 
 func (mb *MockBot) Config() *config.Config { return mb.Cfg }
 func (mb *MockBot) DB() *sqlx.DB           { return mb.Cfg.DB }
-func (mb *MockBot) Who(string) []user.User { return []user.User{} }
+func (mb *MockBot) Who(channel string) []user.User {
+	users := []user.User{}
+	for _, n := range mb.Members[channel] {
+		users = append(users, user.New(n))
+	}
+	return users
+}
 func (mb *MockBot) Send(kind Kind, args ...interface{}) (string, error) {
+	out, err := NewOutgoing(kind, args...)
+	if err != nil {
+		return "ERR", err
+	}
+	return mb.SendOutgoing(kind, out)
+}
+func (mb *MockBot) SendOutgoing(kind Kind, out Outgoing) (string, error) {
 	switch kind {
 	case Message:
-		mb.Messages = append(mb.Messages, args[1].(string))
+		mb.Messages = append(mb.Messages, out.Text)
 		return fmt.Sprintf("m-%d", len(mb.Actions)-1), nil
 	case Action:
-		mb.Actions = append(mb.Actions, args[1].(string))
+		mb.Actions = append(mb.Actions, out.Text)
 		return fmt.Sprintf("a-%d", len(mb.Actions)-1), nil
 	case Edit:
-		ch, m, id := args[0].(string), args[1].(string), args[2].(string)
-		return mb.edit(ch, m, id)
+		return mb.edit(out.Channel, out.Text, out.EditID)
 	case Reaction:
-		ch, re, msg := args[0].(string), args[1].(string), args[2].(msg.Message)
-		return mb.react(ch, re, msg)
+		if out.Target == nil {
+			return "ERR", fmt.Errorf("Reaction needs a message to react to")
+		}
+		return mb.react(out.Channel, out.Reaction, *out.Target)
 	}
 	return "ERR", fmt.Errorf("Mesasge type unhandled")
 }
-func (mb *MockBot) AddPlugin(f Plugin)                                           {}
-func (mb *MockBot) Register(p Plugin, kind Kind, cb Callback)                    {}
-func (mb *MockBot) RegisterWeb(_, _ string)                                      {}
-func (mb *MockBot) Receive(kind Kind, msg msg.Message, args ...interface{}) bool { return false }
-func (mb *MockBot) Filter(msg msg.Message, s string) string                      { return s }
-func (mb *MockBot) LastMessage(ch string) (msg.Message, error)                   { return msg.Message{}, nil }
-func (mb *MockBot) CheckAdmin(nick string) bool                                  { return false }
+func (mb *MockBot) AddPlugin(f Plugin)                                    { mb.Plugins = append(mb.Plugins, PluginName(f)) }
+func (mb *MockBot) PluginNames() []string                                 { return mb.Plugins }
+func (mb *MockBot) Register(p Plugin, kind Kind, cb Callback)             {}
+func (mb *MockBot) RegisterWeb(_, _ string, _ Access, _ http.HandlerFunc) {}
+func (mb *MockBot) Filter(msg msg.Message, s string) string               { return s }
+func (mb *MockBot) UserRole(u *user.User) Role {
+	if u == nil {
+		return Everyone
+	}
+	return lookupRole(mb.Cfg, u.ID)
+}
+func (mb *MockBot) SetRole(id string, r Role) error              { return storeRole(mb.DB(), id, r) }
+func (mb *MockBot) RequireRole(p Plugin, r Role, pattern string) {}
+
+// Receive only logs the message, plugins are called directly in tests
+func (mb *MockBot) Receive(kind Kind, msg msg.Message, args ...interface{}) bool {
+	mb.history.Add(msg)
+	return false
+}
+func (mb *MockBot) LastMessage(ch string) (msg.Message, error) { return mb.history.Last(ch) }
+func (mb *MockBot) LastThreadMessage(ch, thread string) (msg.Message, error) {
+	return mb.history.LastInThread(ch, thread)
+}
+func (mb *MockBot) History(q msglog.Query) ([]msglog.Entry, error) {
+	return mb.history.Find(q)
+}
 
 func (mb *MockBot) react(channel, reaction string, message msg.Message) (string, error) {
 	mb.Reactions = append(mb.Reactions, reaction)
@@ -101,6 +141,21 @@ func NewMockBot() *MockBot {
 		Messages: make([]string, 0),
 		Actions:  make([]string, 0),
 	}
+	history, err := msglog.New(cfg.DB, cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := migrateRoles(cfg.DB); err != nil {
+		log.Fatal(err)
+	}
+	if err := audit.Migrate(cfg.DB); err != nil {
+		log.Fatal(err)
+	}
+	// The in-memory database is shared, start every test with an empty log
+	cfg.MustExec(`delete from msglog`)
+	cfg.MustExec(`delete from roles`)
+	cfg.MustExec(`delete from audit`)
+	b.history = history
 	// If any plugin registered a route, we need to reset those before any new test
 	http.DefaultServeMux = new(http.ServeMux)
 	return &b
@@ -20,4 +20,12 @@ type Message struct {
 	Time           time.Time
 	Host           string
 	AdditionalData map[string]string
+
+	// ID is how the connector identifies the message, the same kind of
+	// identifier Send returns. It is empty where the service has none.
+	ID string
+	// ThreadID is the thread the message was posted in, empty outside threads
+	ThreadID string
+	// ParentID is the message this one replies to, if any
+	ParentID string
 }
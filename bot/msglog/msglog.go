@@ -1,36 +1,243 @@
 // © 2013 the CatBase Authors under the WTFPL. See AUTHORS for the list of authors.
 
+// Package msglog keeps a searchable history of the messages the bot has seen.
 package msglog
 
-import "github.com/velour/catbase/bot/msg"
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
 
-type MsgLogger struct {
-	in      <-chan msg.Message
-	out     chan<- msg.Messages
-	entries msg.Messages
+	"github.com/jmoiron/sqlx"
+	"github.com/velour/catbase/bot/migrate"
+	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/bot/user"
+	"github.com/velour/catbase/config"
+)
+
+// ErrNotFound is returned by Last when a channel or thread has no history
+var ErrNotFound = errors.New("No messages found.")
+
+// pruneEvery is how many messages are logged between retention checks
+const pruneEvery = 100
+
+// Store writes messages to the msglog table.
+// Retention is read from config on every prune:
+// MsgLog.MaxAgeDays (default 30) and MsgLog.MaxRows (default 100000),
+// either of which may be 0 to keep everything.
+type Store struct {
+	db  *sqlx.DB
+	cfg *config.Config
 }
 
-func New(in chan msg.Message, out chan msg.Messages) *MsgLogger {
-	return &MsgLogger{in, out, make(msg.Messages, 0)}
+// Entry is one logged message
+type Entry struct {
+	// ID numbers entries in the log, the connector's ID is Message.ID
+	ID int64
+	msg.Message
 }
 
-func RunNew(in chan msg.Message, out chan msg.Messages) {
-	logger := New(in, out)
-	go logger.Run()
+// Query selects logged messages. Empty fields match everything.
+type Query struct {
+	Channel string
+	// Thread matches messages in one thread, it only makes sense with Channel
+	Thread string
+	User   string
+	Since  time.Time
+	Until  time.Time
+	// Text matches a case insensitive substring of the body
+	Text string
+	// Pattern matches the body with a regular expression
+	Pattern string
+	// MinID and MaxID bound the entry IDs, 0 means unbounded
+	MinID, MaxID int64
+	// Limit caps the number of entries returned, 0 means no limit
+	Limit int
+	// Oldest returns the oldest matches first instead of the newest
+	Oldest bool
 }
 
-func (l *MsgLogger) sendEntries() {
-	l.out <- l.entries
+func init() {
+	migrate.Register("msglog",
+		migrate.Migration{Version: 1, Description: "create msglog table", SQL: `
+			create table if not exists msglog (
+				id integer primary key,
+				channel string,
+				user_id string,
+				user_name string,
+				body string,
+				raw string,
+				command integer,
+				action integer,
+				time integer,
+				host string
+			);
+			create index if not exists msglog_channel_time on msglog (channel, time);`},
+		migrate.Migration{Version: 2, Description: "add message, thread and parent IDs", SQL: `
+			alter table msglog add column msg_id text;
+			alter table msglog add column thread_id text;
+			alter table msglog add column parent_id text;`},
+	)
+	config.Register(
+		config.Key{Name: "MsgLog.MaxAgeDays", Type: config.Int, Default: "30", Description: "days of messages to keep, 0 keeps everything"},
+		config.Key{Name: "MsgLog.MaxRows", Type: config.Int, Default: "100000", Description: "most messages to keep, 0 keeps everything"},
+	)
+}
+
+// New opens the message log, creating its table if necessary
+func New(db *sqlx.DB, cfg *config.Config) (*Store, error) {
+	if err := migrate.Up(db, "msglog"); err != nil {
+		return nil, err
+	}
+	return &Store{db, cfg}, nil
 }
 
-func (l *MsgLogger) Run() {
-	var msg msg.Message
-	for {
-		select {
-		case msg = <-l.in:
-			l.entries = append(l.entries, msg)
-		case l.out <- l.entries:
-			go l.sendEntries()
+// Add logs a message, returning its entry ID
+func (s *Store) Add(m msg.Message) (int64, error) {
+	t := m.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+	uid, name := "", ""
+	if m.User != nil {
+		uid, name = m.User.ID, m.User.Name
+	}
+	id, err := config.DialectOf(s.db).InsertID(s.db, `insert into msglog
+		(channel, user_id, user_name, body, raw, command, action, time, host, msg_id, thread_id, parent_id)
+		values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		m.Channel, uid, name, m.Body, m.Raw, flag(m.Command), flag(m.Action), t.Unix(), m.Host,
+		m.ID, m.ThreadID, m.ParentID)
+	if err != nil {
+		return 0, err
+	}
+	if id%pruneEvery == 0 {
+		if _, err := s.Prune(); err != nil {
+			log.Printf("Could not prune message log: %s", err)
 		}
 	}
+	return id, nil
+}
+
+// Find returns matching entries, newest first unless the query asks for Oldest
+func (s *Store) Find(q Query) ([]Entry, error) {
+	where := []string{"1=1"}
+	args := []interface{}{}
+	if q.Channel != "" {
+		where = append(where, "lower(channel) = lower(?)")
+		args = append(args, q.Channel)
+	}
+	if q.Thread != "" {
+		where = append(where, "thread_id = ?")
+		args = append(args, q.Thread)
+	}
+	if q.User != "" {
+		where = append(where, "lower(user_name) = lower(?)")
+		args = append(args, q.User)
+	}
+	if !q.Since.IsZero() {
+		where = append(where, "time >= ?")
+		args = append(args, q.Since.Unix())
+	}
+	if !q.Until.IsZero() {
+		where = append(where, "time <= ?")
+		args = append(args, q.Until.Unix())
+	}
+	if q.Text != "" {
+		where = append(where, config.DialectOf(s.db).Contains("lower(body)", "lower(?)"))
+		args = append(args, q.Text)
+	}
+	if q.Pattern != "" {
+		where = append(where, config.DialectOf(s.db).Regexp("body"))
+		args = append(args, q.Pattern)
+	}
+	if q.MinID > 0 {
+		where = append(where, "id >= ?")
+		args = append(args, q.MinID)
+	}
+	if q.MaxID > 0 {
+		where = append(where, "id <= ?")
+		args = append(args, q.MaxID)
+	}
+	query := `select id, channel, user_id, user_name, body, raw, command, action, time, host,
+		coalesce(msg_id, ''), coalesce(thread_id, ''), coalesce(parent_id, '')
+		from msglog where ` + strings.Join(where, " and ") + ` order by id desc`
+	if q.Oldest {
+		query = strings.TrimSuffix(query, "desc") + "asc"
+	}
+	if q.Limit > 0 {
+		query += ` limit ?`
+		args = append(args, q.Limit)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries := []Entry{}
+	for rows.Next() {
+		var e Entry
+		var uid, name string
+		var t int64
+		err := rows.Scan(&e.ID, &e.Channel, &uid, &name, &e.Body, &e.Raw,
+			&e.Command, &e.Action, &t, &e.Host, &e.Message.ID, &e.ThreadID, &e.ParentID)
+		if err != nil {
+			return nil, err
+		}
+		e.User = &user.User{ID: uid, Name: name}
+		e.Time = time.Unix(t, 0)
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// Last returns the most recent message in a channel
+func (s *Store) Last(channel string) (msg.Message, error) {
+	return s.LastInThread(channel, "")
+}
+
+// LastInThread returns the most recent message in a thread of a channel,
+// or in the whole channel if thread is empty
+func (s *Store) LastInThread(channel, thread string) (msg.Message, error) {
+	entries, err := s.Find(Query{Channel: channel, Thread: thread, Limit: 1})
+	if err != nil {
+		return msg.Message{}, err
+	}
+	if len(entries) == 0 {
+		return msg.Message{}, ErrNotFound
+	}
+	return entries[0].Message, nil
+}
+
+// Prune removes entries outside the retention limits, returning how many went
+func (s *Store) Prune() (int64, error) {
+	var removed int64
+	if days := s.cfg.GetInt("MsgLog.MaxAgeDays", 0); days > 0 {
+		cutoff := time.Now().AddDate(0, 0, -days).Unix()
+		res, err := s.db.Exec(`delete from msglog where time < ?`, cutoff)
+		if err != nil {
+			return removed, err
+		}
+		n, _ := res.RowsAffected()
+		removed += n
+	}
+	if rows := s.cfg.GetInt("MsgLog.MaxRows", 0); rows > 0 {
+		res, err := s.db.Exec(`delete from msglog where id <= (
+				select id from msglog order by id desc limit 1 offset ?)`, rows)
+		if err != nil {
+			return removed, err
+		}
+		n, _ := res.RowsAffected()
+		removed += n
+	}
+	return removed, nil
+}
+
+// flag stores a bool as an integer, which every database understands
+func flag(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
 }
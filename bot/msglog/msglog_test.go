@@ -4,25 +4,146 @@ package msglog
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/bot/user"
+	"github.com/velour/catbase/config"
 )
 
-func TestNew(t *testing.T) {
-	in := make(chan msg.Message)
-	out := make(chan msg.Messages)
-	logger := New(in, out)
-	assert.NotNil(t, logger)
+func setup(t *testing.T) *Store {
+	cfg := config.ReadConfig("file:msglogtest?mode=memory&cache=shared")
+	s, err := New(cfg.DB, cfg)
+	assert.Nil(t, err)
+	cfg.MustExec(`delete from msglog`)
+	cfg.MustExec(`delete from config`)
+	return s
 }
 
-func TestRunNew(t *testing.T) {
-	in := make(chan msg.Message)
-	out := make(chan msg.Messages)
-	RunNew(in, out)
+func makeMessage(channel, nick, body string, when time.Time) msg.Message {
+	return msg.Message{
+		User:    &user.User{ID: nick, Name: nick},
+		Channel: channel,
+		Body:    body,
+		Time:    when,
+	}
+}
+
+func TestLast(t *testing.T) {
+	s := setup(t)
+	_, err := s.Last("#test")
+	assert.Equal(t, ErrNotFound, err)
+
+	now := time.Now()
+	s.Add(makeMessage("#test", "alice", "first", now))
+	s.Add(makeMessage("#other", "bob", "elsewhere", now))
+	s.Add(makeMessage("#test", "carol", "second", now))
+
+	m, err := s.Last("#TEST")
+	assert.Nil(t, err)
+	assert.Equal(t, "second", m.Body)
+	assert.Equal(t, "carol", m.User.Name)
+}
+
+func TestLastInThread(t *testing.T) {
+	s := setup(t)
+	now := time.Now()
+	root := makeMessage("#test", "alice", "anyone?", now)
+	root.ID = "100.1"
+	s.Add(root)
+	answer := makeMessage("#test", "bob", "me", now)
+	answer.ID, answer.ThreadID, answer.ParentID = "100.2", "100.1", "100.1"
+	s.Add(answer)
+	s.Add(makeMessage("#test", "carol", "elsewhere", now))
+
+	m, err := s.LastInThread("#test", "100.1")
+	assert.Nil(t, err)
+	assert.Equal(t, "me", m.Body)
+	assert.Equal(t, "100.2", m.ID)
+	assert.Equal(t, "100.1", m.ThreadID)
+	assert.Equal(t, "100.1", m.ParentID)
+
+	m, err = s.Last("#test")
+	assert.Nil(t, err)
+	assert.Equal(t, "elsewhere", m.Body)
+	assert.Equal(t, "", m.ThreadID)
+
+	_, err = s.LastInThread("#test", "999.9")
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestUpgrade(t *testing.T) {
+	cfg := config.ReadConfig(":memory:")
+	cfg.MustExec(`create table msglog (
+			id integer primary key,
+			channel string,
+			user_id string,
+			user_name string,
+			body string,
+			raw string,
+			command integer,
+			action integer,
+			time integer,
+			host string
+		);`)
+	cfg.MustExec(`insert into msglog (channel, user_id, user_name, body, raw, command, action, time, host)
+		values ('#test', 'alice', 'alice', 'from before', 'from before', 0, 0, 1500000000, '')`)
+
+	s, err := New(cfg.DB, cfg)
+	assert.Nil(t, err)
+	m, err := s.Last("#test")
+	assert.Nil(t, err)
+	assert.Equal(t, "from before", m.Body)
+	assert.Equal(t, "", m.ID)
+}
+
+func TestFind(t *testing.T) {
+	s := setup(t)
+	now := time.Now()
+	s.Add(makeMessage("#test", "alice", "I like turtles", now.Add(-2*time.Hour)))
+	s.Add(makeMessage("#test", "bob", "turtles are fine", now.Add(-time.Hour)))
+	s.Add(makeMessage("#test", "alice", "so are frogs", now))
+
+	entries, err := s.Find(Query{Channel: "#test", Text: "TURTLES"})
+	assert.Nil(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "turtles are fine", entries[0].Body)
+
+	entries, err = s.Find(Query{User: "alice"})
+	assert.Nil(t, err)
+	assert.Len(t, entries, 2)
+
+	entries, err = s.Find(Query{Since: now.Add(-90 * time.Minute)})
+	assert.Nil(t, err)
+	assert.Len(t, entries, 2)
+
+	entries, err = s.Find(Query{Pattern: "^so"})
+	assert.Nil(t, err)
+	assert.Len(t, entries, 1)
+
+	entries, err = s.Find(Query{Limit: 1})
+	assert.Nil(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "so are frogs", entries[0].Body)
+}
+
+func TestPrune(t *testing.T) {
+	s := setup(t)
+	s.cfg.Set("MsgLog.MaxAgeDays", "1")
+	s.cfg.Set("MsgLog.MaxRows", "2")
+	now := time.Now()
+	s.Add(makeMessage("#test", "alice", "ancient", now.AddDate(0, 0, -2)))
+	s.Add(makeMessage("#test", "alice", "one", now))
+	s.Add(makeMessage("#test", "alice", "two", now))
+	s.Add(makeMessage("#test", "alice", "three", now))
+
+	removed, err := s.Prune()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), removed)
 
-	in <- msg.Message{}
-	msg := <-out
-	assert.Empty(t, out)
-	assert.NotNil(t, msg)
+	entries, _ := s.Find(Query{})
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "three", entries[0].Body)
+	assert.Equal(t, "two", entries[1].Body)
 }
@@ -0,0 +1,112 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+package bot
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/velour/catbase/bot/msg"
+)
+
+// ErrUnsupported is returned by connectors asked to send a Kind they cannot deliver
+var ErrUnsupported = errors.New("unsupported message kind")
+
+// Outgoing is everything a connector needs to deliver a message.
+// Which fields matter depends on the Kind being sent.
+type Outgoing struct {
+	// Channel the message is delivered to
+	Channel string
+	// Text of a Message, Action, Reply or Edit
+	Text string
+	// ReplyTo is the identifier of the message a Reply answers
+	ReplyTo string
+	// Target is the original message for a Reaction, or for a Reply without ReplyTo
+	Target *msg.Message
+	// Reaction is the emoji name for a Reaction
+	Reaction string
+	// EditID is the identifier of the message an Edit replaces
+	EditID string
+	// ThreadID places the message in a thread on services that have them
+	ThreadID string
+}
+
+// NewOutgoing converts the old positional Send arguments into an Outgoing.
+// It returns an error instead of panicking when the arguments don't fit the kind:
+//
+//	Message, Action: channel, text
+//	Reply:           channel, text, identifier or msg.Message
+//	Reaction:        channel, reaction, msg.Message
+//	Edit:            channel, text, identifier
+//
+// The channel may be the msg.Message being answered instead, then the answer
+// goes to its channel and stays in its thread if it was in one.
+func NewOutgoing(kind Kind, args ...interface{}) (Outgoing, error) {
+	out := Outgoing{}
+	want := 2
+	switch kind {
+	case Message, Action:
+	case Reply, Reaction, Edit:
+		want = 3
+	default:
+		return out, fmt.Errorf("%w: %s", ErrUnsupported, kind)
+	}
+	if len(args) != want {
+		return out, fmt.Errorf("%s takes %d arguments, got %d", kind, want, len(args))
+	}
+
+	var ok bool
+	switch ch := args[0].(type) {
+	case string:
+		out.Channel = ch
+	case msg.Message:
+		out.Channel, out.ThreadID = ch.Channel, ch.ThreadID
+	default:
+		return out, fmt.Errorf("%s channel must be a string or message, got %T", kind, args[0])
+	}
+	text, ok := asText(args[1])
+	if !ok {
+		return out, fmt.Errorf("%s text must be a string, got %T", kind, args[1])
+	}
+
+	switch kind {
+	case Message, Action:
+		out.Text = text
+	case Reply:
+		out.Text = text
+		switch t := args[2].(type) {
+		case string:
+			out.ReplyTo = t
+		case msg.Message:
+			out.Target = &t
+		default:
+			return out, fmt.Errorf("Reply target must be an identifier or message, got %T", args[2])
+		}
+	case Reaction:
+		out.Reaction = text
+		t, ok := args[2].(msg.Message)
+		if !ok {
+			return out, fmt.Errorf("Reaction target must be a message, got %T", args[2])
+		}
+		out.Target = &t
+	case Edit:
+		out.Text = text
+		if out.EditID, ok = args[2].(string); !ok {
+			return out, fmt.Errorf("Edit identifier must be a string, got %T", args[2])
+		}
+	}
+	return out, nil
+}
+
+// asText allows errors and other printable values to be sent as text
+func asText(v interface{}) (string, bool) {
+	switch t := v.(type) {
+	case string:
+		return t, true
+	case error:
+		return t.Error(), true
+	case fmt.Stringer:
+		return t.String(), true
+	}
+	return "", false
+}
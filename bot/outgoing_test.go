@@ -0,0 +1,58 @@
+package bot
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/velour/catbase/bot/msg"
+)
+
+func TestNewOutgoing(t *testing.T) {
+	out, err := NewOutgoing(Message, "#chan", "hi")
+	assert.Nil(t, err)
+	assert.Equal(t, Outgoing{Channel: "#chan", Text: "hi"}, out)
+
+	out, err = NewOutgoing(Reply, "#chan", "yes", "1234")
+	assert.Nil(t, err)
+	assert.Equal(t, "1234", out.ReplyTo)
+
+	m := msg.Message{Body: "party"}
+	out, err = NewOutgoing(Reaction, "#chan", "tada", m)
+	assert.Nil(t, err)
+	assert.Equal(t, "tada", out.Reaction)
+	assert.Equal(t, "party", out.Target.Body)
+
+	out, err = NewOutgoing(Edit, "#chan", "fixed", "1234")
+	assert.Nil(t, err)
+	assert.Equal(t, "1234", out.EditID)
+}
+
+func TestNewOutgoingAnswer(t *testing.T) {
+	m := msg.Message{Channel: "#chan", ID: "1235", ThreadID: "1234"}
+	out, err := NewOutgoing(Message, m, "hi")
+	assert.Nil(t, err)
+	assert.Equal(t, Outgoing{Channel: "#chan", Text: "hi", ThreadID: "1234"}, out)
+
+	out, err = NewOutgoing(Action, msg.Message{Channel: "#chan"}, "waves")
+	assert.Nil(t, err)
+	assert.Equal(t, Outgoing{Channel: "#chan", Text: "waves"}, out)
+}
+
+func TestNewOutgoingErrors(t *testing.T) {
+	_, err := NewOutgoing(Message, "#chan")
+	assert.NotNil(t, err)
+	_, err = NewOutgoing(Message, 42, "hi")
+	assert.NotNil(t, err)
+	_, err = NewOutgoing(Reaction, "#chan", "tada", "not a message")
+	assert.NotNil(t, err)
+	_, err = NewOutgoing(Help, "#chan", "hi")
+	assert.True(t, errors.Is(err, ErrUnsupported))
+}
+
+func TestMockReactionWithoutTarget(t *testing.T) {
+	mb := NewMockBot()
+	_, err := mb.SendOutgoing(Reaction, Outgoing{Channel: "#chan", Reaction: "tada"})
+	assert.NotNil(t, err)
+	assert.Empty(t, mb.Reactions)
+}
@@ -0,0 +1,112 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+package bot
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/velour/catbase/config"
+)
+
+func init() {
+	config.Register(
+		config.Key{Name: "Plugin.Disabled", Type: config.Array, Description: "plugins turned off everywhere"},
+	)
+}
+
+// PluginName gives the short name a plugin is known by in commands and config,
+// e.g. "babbler" for a *babbler.BabblerPlugin
+func PluginName(p Plugin) string {
+	return shortName(reflect.TypeOf(p).String())
+}
+
+func shortName(typeName string) string {
+	return strings.ToLower(strings.Split(strings.TrimPrefix(typeName, "*"), ".")[0])
+}
+
+// PluginEnabled checks whether the named plugin should see messages in channel.
+// A plugin is off if it is listed in Plugin.Disabled or Plugin.<channel>.Disabled,
+// or if Plugin.<name>.Channels is set and does not include the channel.
+func PluginEnabled(c *config.Config, name, channel string) bool {
+	return NewPluginGate(c, channel).Enabled(name)
+}
+
+// PluginGate answers PluginEnabled for every plugin in one channel, reading
+// the disabled lists once rather than once per plugin
+type PluginGate struct {
+	c               *config.Config
+	channel         string
+	disabled        []string
+	channelDisabled []string
+}
+
+// NewPluginGate reads the disabled lists that apply to channel
+func NewPluginGate(c *config.Config, channel string) PluginGate {
+	g := PluginGate{
+		c:        c,
+		channel:  channel,
+		disabled: c.GetArray("Plugin.Disabled", []string{}),
+	}
+	if channel != "" {
+		g.channelDisabled = c.GetArray("Plugin."+channel+".Disabled", []string{})
+	}
+	return g
+}
+
+// Enabled checks whether the named plugin should see messages in the channel
+func (g PluginGate) Enabled(name string) bool {
+	name = strings.ToLower(name)
+	if contains(g.disabled, name) {
+		return false
+	}
+	if g.channel == "" {
+		return true
+	}
+	if contains(g.channelDisabled, name) {
+		return false
+	}
+	allowed := g.c.GetArray("Plugin."+name+".Channels", []string{})
+	return len(allowed) == 0 || contains(allowed, g.channel)
+}
+
+// PluginDisabledEverywhere checks whether the named plugin is in Plugin.Disabled,
+// which no channel setting can override
+func PluginDisabledEverywhere(c *config.Config, name string) bool {
+	return contains(c.GetArray("Plugin.Disabled", []string{}), strings.ToLower(name))
+}
+
+// SetPluginEnabled turns the named plugin on or off everywhere, or only in
+// channel if it is not empty
+func SetPluginEnabled(c *config.Config, name, channel string, enabled bool) error {
+	key := "Plugin.Disabled"
+	if channel != "" {
+		key = "Plugin." + channel + ".Disabled"
+	}
+	name = strings.ToLower(name)
+	disabled := []string{}
+	for _, n := range c.GetArray(key, []string{}) {
+		if n != name {
+			disabled = append(disabled, n)
+		}
+	}
+	if !enabled {
+		disabled = append(disabled, name)
+	}
+	return c.SetArray(key, disabled)
+}
+
+// SetPluginChannels restricts the named plugin to the given channels.
+// An empty list lets the plugin run everywhere again.
+func SetPluginChannels(c *config.Config, name string, channels []string) error {
+	return c.SetArray("Plugin."+strings.ToLower(name)+".Channels", channels)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,162 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+package bot
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/bot/msglog"
+	"github.com/velour/catbase/bot/user"
+	"github.com/velour/catbase/config"
+)
+
+// Role is a level of trust, each role may do everything the roles below it can
+type Role int
+
+const (
+	// Everyone is the role of users nobody has vouched for
+	Everyone Role = iota
+	// Trusted users may change shared data such as factoids and counters
+	Trusted
+	// Moderator users may quiet the bot and tidy up after others
+	Moderator
+	// Admin users may change configuration and hand out roles
+	Admin
+)
+
+var roleNames = []string{"everyone", "trusted", "moderator", "admin"}
+
+func (r Role) String() string {
+	if r < Everyone || int(r) >= len(roleNames) {
+		return fmt.Sprintf("Role(%d)", int(r))
+	}
+	return roleNames[r]
+}
+
+// ParseRole finds the role with the given name
+func ParseRole(name string) (Role, error) {
+	for i, n := range roleNames {
+		if strings.EqualFold(n, name) {
+			return Role(i), nil
+		}
+	}
+	return Everyone, fmt.Errorf("no role named %s, try one of %s", name, strings.Join(roleNames, ", "))
+}
+
+// permission requires a role for commands matching a pattern
+type permission struct {
+	pattern *regexp.Regexp
+	role    Role
+}
+
+func migrateRoles(db *sqlx.DB) error {
+	_, err := db.Exec(`create table if not exists roles (
+			user_id string primary key,
+			role string
+		);`)
+	return err
+}
+
+// nickAdmins finds Admins entries that the message log knows as somebody's
+// nick but never as a user ID, left over from when Admins held nicks
+func nickAdmins(cfg *config.Config, history *msglog.Store) []string {
+	nicks := []string{}
+	for _, a := range cfg.GetArray("Admins", []string{}) {
+		seen, err := history.Find(msglog.Query{User: a, Limit: 1})
+		if err != nil {
+			log.Printf("Could not check admin %s: %s", a, err)
+			continue
+		}
+		if len(seen) > 0 && seen[0].User.ID != "" && seen[0].User.ID != a {
+			nicks = append(nicks, a)
+		}
+	}
+	return nicks
+}
+
+// lookupRole finds the role of a connector user ID.
+// IDs listed in the Admins config array are always admins.
+// Nicks are never trusted, a user without an ID has no role.
+func lookupRole(cfg *config.Config, id string) Role {
+	if id == "" {
+		return Everyone
+	}
+	for _, a := range cfg.GetArray("Admins", []string{}) {
+		if a == id {
+			return Admin
+		}
+	}
+	var name string
+	err := cfg.DB.Get(&name, `select role from roles where user_id=?`, id)
+	if err == sql.ErrNoRows {
+		return Everyone
+	} else if err != nil {
+		log.Printf("Error looking up role for %s: %s", id, err)
+		return Everyone
+	}
+	r, err := ParseRole(name)
+	if err != nil {
+		log.Printf("Bad role for %s: %s", id, err)
+	}
+	return r
+}
+
+func storeRole(db *sqlx.DB, id string, r Role) error {
+	if id == "" {
+		return fmt.Errorf("cannot give a role to a user without an ID")
+	}
+	if r == Everyone {
+		_, err := db.Exec(`delete from roles where user_id=?`, id)
+		return err
+	}
+	_, err := db.Exec(config.DialectOf(db).Upsert("roles", []string{"user_id"}, "role"), id, r.String())
+	return err
+}
+
+// UserRole gives the role of a user, looked up by their connector ID
+func (b *bot) UserRole(u *user.User) Role {
+	if u == nil {
+		return Everyone
+	}
+	return lookupRole(b.config, u.ID)
+}
+
+// SetRole gives the user with a connector ID a role, Everyone removes it
+func (b *bot) SetRole(id string, r Role) error {
+	return storeRole(b.DB(), id, r)
+}
+
+// RequireRole restricts commands for a plugin matching pattern to users with at least role r.
+// Patterns are matched case insensitively against the command body.
+func (b *bot) RequireRole(p Plugin, r Role, pattern string) {
+	t := reflect.TypeOf(p).String()
+	b.permissions[t] = append(b.permissions[t], permission{
+		pattern: regexp.MustCompile("(?i)" + pattern),
+		role:    r,
+	})
+}
+
+// checkPermission stops commands from users without the role a plugin requires,
+// returning false after telling them so
+func (b *bot) checkPermission(t string, message msg.Message) bool {
+	if !message.Command {
+		return true
+	}
+	for _, perm := range b.permissions[t] {
+		if !perm.pattern.MatchString(message.Body) {
+			continue
+		}
+		if b.UserRole(message.User) < perm.role {
+			b.Send(Message, message, fmt.Sprintf("Sorry, you need the %s role to do that.", perm.role))
+			return false
+		}
+	}
+	return true
+}
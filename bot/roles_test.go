@@ -0,0 +1,47 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/bot/user"
+)
+
+func TestParseRole(t *testing.T) {
+	r, err := ParseRole("Moderator")
+	assert.Nil(t, err)
+	assert.Equal(t, Moderator, r)
+	assert.Equal(t, "moderator", r.String())
+
+	_, err = ParseRole("wizard")
+	assert.NotNil(t, err)
+}
+
+func TestUserRole(t *testing.T) {
+	mb := NewMockBot()
+	mb.Cfg.Set("Admins", "U1")
+
+	assert.Equal(t, Admin, mb.UserRole(&user.User{ID: "U1", Name: "alice"}))
+	// Nicks never grant a role
+	assert.Equal(t, Everyone, mb.UserRole(&user.User{ID: "U2", Name: "U1"}))
+	assert.Equal(t, Everyone, mb.UserRole(&user.User{Name: "alice"}))
+
+	assert.Nil(t, mb.SetRole("U2", Trusted))
+	assert.Equal(t, Trusted, mb.UserRole(&user.User{ID: "U2"}))
+	assert.Nil(t, mb.SetRole("U2", Moderator))
+	assert.Equal(t, Moderator, mb.UserRole(&user.User{ID: "U2"}))
+	assert.Nil(t, mb.SetRole("U2", Everyone))
+	assert.Equal(t, Everyone, mb.UserRole(&user.User{ID: "U2"}))
+
+	assert.NotNil(t, mb.SetRole("", Admin))
+}
+
+func TestNickAdmins(t *testing.T) {
+	mb := NewMockBot()
+	mb.Cfg.Set("Admins", "U1;;alice;;carol")
+	mb.history.Add(msg.Message{User: &user.User{ID: "U1", Name: "alice"}, Channel: "#test", Body: "hi"})
+	mb.history.Add(msg.Message{User: &user.User{ID: "U3", Name: "bob"}, Channel: "#test", Body: "hi"})
+
+	assert.Equal(t, []string{"alice"}, nickAdmins(mb.Cfg, mb.history))
+}
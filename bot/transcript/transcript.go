@@ -0,0 +1,264 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+// Package transcript replays scripted conversations through a real bot and
+// records everything the bot sends back, so that whole plugin sets can be
+// checked against golden output.
+package transcript
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/velour/catbase/bot"
+	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/bot/user"
+	"github.com/velour/catbase/config"
+)
+
+var update = flag.Bool("update", false, "rewrite golden transcript files")
+
+// Line is a single scripted message
+type Line struct {
+	Raw     string
+	Time    time.Time
+	Channel string
+	User    string
+	Body    string
+	Action  bool
+}
+
+// Parse reads a script with one message per line in the form
+//
+//	15:04:05 #channel <nick> message body
+//	15:04:05 #channel * nick does an action
+//
+// Blank lines and lines starting with // are ignored.
+// Times are placed on the given day.
+func Parse(r io.Reader, day time.Time) ([]Line, error) {
+	lines := []Line{}
+	scanner := bufio.NewScanner(r)
+	n := 0
+	for scanner.Scan() {
+		n++
+		raw := strings.TrimSpace(scanner.Text())
+		if raw == "" || strings.HasPrefix(raw, "//") {
+			continue
+		}
+		parts := strings.SplitN(raw, " ", 4)
+		if len(parts) < 3 {
+			return nil, fmt.Errorf("line %d: expected time, channel and speaker", n)
+		}
+		t, err := time.Parse("15:04:05", parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err)
+		}
+		l := Line{
+			Raw:     raw,
+			Time:    time.Date(day.Year(), day.Month(), day.Day(), t.Hour(), t.Minute(), t.Second(), 0, day.Location()),
+			Channel: parts[1],
+		}
+		rest := ""
+		if len(parts) == 4 {
+			rest = parts[3]
+		}
+		switch {
+		case parts[2] == "*":
+			who := strings.SplitN(rest, " ", 2)
+			if len(who) != 2 {
+				return nil, fmt.Errorf("line %d: action without a body", n)
+			}
+			l.Action = true
+			l.User, l.Body = who[0], who[1]
+		case strings.HasPrefix(parts[2], "<") && strings.HasSuffix(parts[2], ">"):
+			l.User = strings.Trim(parts[2], "<>")
+			l.Body = rest
+		default:
+			return nil, fmt.Errorf("line %d: bad speaker %q", n, parts[2])
+		}
+		lines = append(lines, l)
+	}
+	return lines, scanner.Err()
+}
+
+// Sent is one call the bot made to its connector
+type Sent struct {
+	Kind bot.Kind
+	Out  bot.Outgoing
+}
+
+func (s Sent) String() string {
+	out := fmt.Sprintf("%s %q", s.Kind, s.Out.Channel)
+	if s.Kind == bot.Reaction {
+		out += fmt.Sprintf(" :%s:", s.Out.Reaction)
+	} else {
+		out += fmt.Sprintf(" %q", s.Out.Text)
+	}
+	if s.Out.ReplyTo != "" {
+		out += " reply_to=" + s.Out.ReplyTo
+	}
+	if s.Out.EditID != "" {
+		out += " edit=" + s.Out.EditID
+	}
+	if s.Out.ThreadID != "" {
+		out += " thread=" + s.Out.ThreadID
+	}
+	if t := s.Out.Target; t != nil {
+		name := ""
+		if t.User != nil {
+			name = t.User.Name
+		}
+		out += fmt.Sprintf(" msg(%s: %q)", name, t.Body)
+	}
+	return out
+}
+
+// Conn is a fake bot.Connector which records every Send
+type Conn struct {
+	// SelfID is the user ID the bot posts as, if the service has one
+	SelfID string
+
+	mu    sync.Mutex
+	event bot.Callback
+	sent  []Sent
+	who   map[string][]string
+}
+
+func (c *Conn) RegisterEvent(f bot.Callback)    { c.event = f }
+func (c *Conn) GetEmojiList() map[string]string { return map[string]string{} }
+func (c *Conn) Serve() error                    { return nil }
+
+func (c *Conn) Send(kind bot.Kind, out bot.Outgoing) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sent = append(c.sent, Sent{kind, out})
+	return fmt.Sprintf("sent-%d", len(c.sent)), nil
+}
+
+// FromMe matches on SelfID when it is set
+func (c *Conn) FromMe(m msg.Message) (bool, bool) {
+	if c.SelfID == "" || m.User == nil || m.User.ID == "" {
+		return false, false
+	}
+	return m.User.ID == c.SelfID, true
+}
+
+// Who lists everybody who has spoken in the channel so far
+func (c *Conn) Who(channel string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string{}, c.who[channel]...)
+}
+
+// drain returns and forgets everything sent since the last call
+func (c *Conn) drain() []Sent {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := c.sent
+	c.sent = nil
+	return out
+}
+
+func (c *Conn) saw(channel, nick string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, n := range c.who[channel] {
+		if n == nick {
+			return
+		}
+	}
+	c.who[channel] = append(c.who[channel], nick)
+}
+
+// Harness couples a real bot to a recording connector and a private database
+type Harness struct {
+	Config *config.Config
+	Conn   *Conn
+
+	b bot.Bot
+}
+
+var dbCount int
+
+// New creates a harness with a fresh in-memory database.
+// Set any configuration needed by plugins before calling Bot.
+func New() *Harness {
+	dbCount++
+	cfg := config.ReadConfig(fmt.Sprintf("file:transcript%d?mode=memory&cache=shared", dbCount))
+	cfg.Set("nick", "catbase")
+	return &Harness{
+		Config: cfg,
+		Conn:   &Conn{who: map[string][]string{}},
+	}
+}
+
+// Bot returns the harness bot, creating it on the first call
+func (h *Harness) Bot() bot.Bot {
+	if h.b == nil {
+		// Plugins register routes on the default mux, start over for every bot
+		http.DefaultServeMux = new(http.ServeMux)
+		h.b = bot.New(h.Config, h.Conn)
+	}
+	return h.b
+}
+
+// Run feeds each line to the bot and returns a transcript of the input
+// interleaved with everything the bot sent in response.
+func (h *Harness) Run(lines []Line) string {
+	h.Bot()
+	h.Conn.drain()
+	out := ""
+	for _, l := range lines {
+		h.Conn.saw(l.Channel, l.User)
+		body := l.Body
+		isCmd := false
+		if !l.Action {
+			isCmd, body = bot.IsCmd(h.Config, l.Body)
+		}
+		m := msg.Message{
+			User: &user.User{
+				ID:   l.User,
+				Name: l.User,
+			},
+			Channel: l.Channel,
+			Body:    body,
+			Raw:     l.Body,
+			Command: isCmd,
+			Action:  l.Action,
+			Time:    l.Time,
+			Host:    "transcript",
+		}
+		h.Conn.event(bot.Message, m)
+		out += "> " + l.Raw + "\n"
+		for _, s := range h.Conn.drain() {
+			out += "< " + s.String() + "\n"
+		}
+	}
+	return out
+}
+
+// Golden compares actual against the contents of path.
+// Running the tests with -update rewrites the file instead.
+func Golden(t *testing.T, path, actual string) {
+	t.Helper()
+	if *update {
+		if err := ioutil.WriteFile(path, []byte(actual), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	expected, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading golden file (run with -update to create it): %s", err)
+	}
+	if string(expected) != actual {
+		t.Errorf("transcript differs from %s\n--- expected\n%s\n--- actual\n%s", path, expected, actual)
+	}
+}
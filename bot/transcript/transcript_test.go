@@ -0,0 +1,110 @@
+package transcript
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/velour/catbase/bot"
+	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/bot/user"
+)
+
+func TestParse(t *testing.T) {
+	script := `
+// comments are skipped
+10:00:00 #chan <alice> hello there
+10:00:30 #chan * bob waves
+`
+	day := time.Date(2019, 2, 1, 0, 0, 0, 0, time.UTC)
+	lines, err := Parse(strings.NewReader(script), day)
+	assert.Nil(t, err)
+	assert.Len(t, lines, 2)
+	assert.Equal(t, "alice", lines[0].User)
+	assert.Equal(t, "hello there", lines[0].Body)
+	assert.Equal(t, time.Date(2019, 2, 1, 10, 0, 0, 0, time.UTC), lines[0].Time)
+	assert.True(t, lines[1].Action)
+	assert.Equal(t, "bob", lines[1].User)
+	assert.Equal(t, "waves", lines[1].Body)
+}
+
+func TestParseBadSpeaker(t *testing.T) {
+	_, err := Parse(strings.NewReader("10:00:00 #chan alice hi"), time.Now())
+	assert.NotNil(t, err)
+}
+
+func TestRun(t *testing.T) {
+	h := New()
+	h.Bot()
+	lines, _ := Parse(strings.NewReader("10:00:00 #chan <alice> hi"), time.Now())
+	assert.Equal(t, "> 10:00:00 #chan <alice> hi\n", h.Run(lines))
+	assert.Equal(t, []string{"alice"}, h.Conn.Who("#chan"))
+}
+
+func TestThreadedReply(t *testing.T) {
+	h := New()
+	b := h.Bot()
+	h.Conn.drain()
+	m := msg.Message{
+		User:     &user.User{ID: "alice", Name: "alice"},
+		Channel:  "#chan",
+		Body:     "help",
+		Command:  true,
+		ID:       "t2",
+		ThreadID: "t1",
+		ParentID: "t1",
+	}
+	h.Conn.event(bot.Reply, m, "t1")
+
+	sent := h.Conn.drain()
+	if assert.Len(t, sent, 1, "a reply nobody waits for is handled as a message") {
+		assert.Equal(t, "t1", sent[0].Out.ThreadID, "answers stay in the thread")
+		assert.Equal(t, "#chan", sent[0].Out.Channel)
+	}
+
+	last, err := b.LastThreadMessage("#chan", "t1")
+	assert.Nil(t, err)
+	assert.Equal(t, "t2", last.ID)
+}
+
+func TestOwnThreadedReply(t *testing.T) {
+	h := New()
+	h.Bot()
+	h.Conn.drain()
+	h.Conn.event(bot.Reply, msg.Message{
+		User:     &user.User{ID: "B0CATBASE", Name: "catbase"},
+		Channel:  "#chan",
+		Body:     "help",
+		Command:  true,
+		ID:       "t3",
+		ThreadID: "t1",
+		ParentID: "t1",
+	}, "t1")
+
+	assert.Empty(t, h.Conn.drain(), "the bot doesn't answer its own posts in a thread")
+}
+
+func TestOwnThreadedReplyByID(t *testing.T) {
+	h := New()
+	h.Conn.SelfID = "B0CATBASE"
+	h.Bot()
+	h.Conn.drain()
+	reply := func(id, name, ts string) {
+		h.Conn.event(bot.Reply, msg.Message{
+			User:     &user.User{ID: id, Name: name},
+			Channel:  "#chan",
+			Body:     "help",
+			Command:  true,
+			ID:       ts,
+			ThreadID: "t1",
+			ParentID: "t1",
+		}, "t1")
+	}
+
+	reply("B0CATBASE", "Cat Base", "t2")
+	assert.Empty(t, h.Conn.drain(), "the bot knows its posts by ID whatever name they show")
+	reply("U9", "catbase", "t3")
+	assert.Len(t, h.Conn.drain(), 1, "someone who took the bot's name is still answered")
+}
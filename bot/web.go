@@ -0,0 +1,88 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+package bot
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/velour/catbase/config"
+)
+
+// Access is who may use a web endpoint
+type Access int
+
+const (
+	// WebPublic pages can be read by anyone, but only with GET and HEAD
+	WebPublic Access = iota
+	// WebAdmin pages need the Web.Token, as a bearer token or a basic auth password
+	WebAdmin
+	// WebSigned endpoints are called by chat services and check their own
+	// request signatures, so they are passed everything untouched
+	WebSigned
+)
+
+func (a Access) String() string {
+	switch a {
+	case WebPublic:
+		return "public"
+	case WebAdmin:
+		return "admin"
+	case WebSigned:
+		return "signed"
+	}
+	return "unknown"
+}
+
+func init() {
+	config.Register(
+		config.Key{Name: "Web.Token", Description: "token needed for admin web pages, which are closed if it is unset", Secret: true},
+	)
+}
+
+// HandleWeb serves h at pattern on the default mux behind the checks for access
+func HandleWeb(c *config.Config, pattern string, access Access, h http.HandlerFunc) {
+	http.Handle(pattern, Protect(c, access, h))
+}
+
+// Protect wraps a handler with the checks for access
+func Protect(c *config.Config, access Access, h http.HandlerFunc) http.Handler {
+	switch access {
+	case WebPublic:
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				w.Header().Set("Allow", "GET, HEAD")
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			h(w, r)
+		})
+	case WebAdmin:
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !webAuthorized(c, r) {
+				w.Header().Set("WWW-Authenticate", `Basic realm="catbase"`)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			h(w, r)
+		})
+	}
+	return h
+}
+
+// webAuthorized checks for the Web.Token as a bearer token or as the
+// password of basic auth, with any user name
+func webAuthorized(c *config.Config, r *http.Request) bool {
+	token := c.Get("Web.Token", "")
+	if token == "" {
+		return false
+	}
+	given := ""
+	if _, pass, ok := r.BasicAuth(); ok {
+		given = pass
+	} else if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		given = strings.TrimPrefix(auth, "Bearer ")
+	}
+	return subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
@@ -0,0 +1,52 @@
+package bot
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func serve(mb *MockBot, access Access, r *http.Request) int {
+	w := httptest.NewRecorder()
+	Protect(mb.Config(), access, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}).ServeHTTP(w, r)
+	return w.Code
+}
+
+func TestWebPublicIsReadOnly(t *testing.T) {
+	mb := NewMockBot()
+	assert.Equal(t, 200, serve(mb, WebPublic, httptest.NewRequest("GET", "/", nil)))
+	assert.Equal(t, 405, serve(mb, WebPublic, httptest.NewRequest("POST", "/", nil)))
+}
+
+func TestWebAdminNeedsToken(t *testing.T) {
+	mb := NewMockBot()
+	mb.Config().Set("Web.Token", "")
+	assert.Equal(t, 401, serve(mb, WebAdmin, httptest.NewRequest("GET", "/", nil)))
+
+	// no token set means nobody gets in
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer ")
+	assert.Equal(t, 401, serve(mb, WebAdmin, r))
+
+	mb.Config().Set("Web.Token", "sekrit")
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer wrong")
+	assert.Equal(t, 401, serve(mb, WebAdmin, r))
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer sekrit")
+	assert.Equal(t, 200, serve(mb, WebAdmin, r))
+
+	r = httptest.NewRequest("POST", "/", nil)
+	r.SetBasicAuth("anyone", "sekrit")
+	assert.Equal(t, 200, serve(mb, WebAdmin, r))
+}
+
+func TestWebSignedPassesThrough(t *testing.T) {
+	mb := NewMockBot()
+	assert.Equal(t, 200, serve(mb, WebSigned, httptest.NewRequest("POST", "/evt", nil)))
+}
@@ -10,6 +10,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/jmoiron/sqlx"
 	sqlite3 "github.com/mattn/go-sqlite3"
@@ -20,18 +21,63 @@ import (
 type Config struct {
 	*sqlx.DB
 
+	// DBFile is the path of the database, only set for SQLite
 	DBFile string
+	// Dialect covers the differences between the databases catbase can use
+	Dialect Dialect
+
+	// file holds keys loaded by LoadFile, which win over the database
+	file map[string]string
+
+	watchLock sync.Mutex
+	watchers  map[string][]Watcher
+}
+
+// Watcher is told the old and new value of a key when it is set
+type Watcher func(old, new string)
+
+// Watch calls fn after every Set that changes key, so plugins can pick up
+// new settings without a restart. Changes made in the environment or a
+// config file are only seen on restart.
+func (c *Config) Watch(key string, fn Watcher) {
+	key = strings.ToLower(key)
+	c.watchLock.Lock()
+	defer c.watchLock.Unlock()
+	if c.watchers == nil {
+		c.watchers = map[string][]Watcher{}
+	}
+	c.watchers[key] = append(c.watchers[key], fn)
+}
+
+func (c *Config) notify(key, old, new string) {
+	c.watchLock.Lock()
+	watchers := append([]Watcher{}, c.watchers[key]...)
+	c.watchLock.Unlock()
+	for _, fn := range watchers {
+		fn(old, new)
+	}
 }
 
 // GetFloat64 returns the config value for a string key
 // It will first look in the env vars for the key
 // It will check the DB for the key if an env DNE
-// Finally, it will return a zero value if the key does not exist
-// It will attempt to convert the value to a float64 if it exists
+// Finally, it will return the fallback if the key does not exist
+// or its value cannot be converted to a float64
+// A default registered for the key takes the place of the fallback
 func (c *Config) GetFloat64(key string, fallback float64) float64 {
-	f, err := strconv.ParseFloat(c.GetString(key, fmt.Sprintf("%f", fallback)), 64)
+	if d, ok := registeredDefault(key); ok {
+		if f, err := strconv.ParseFloat(d, 64); err == nil {
+			fallback = f
+		}
+	}
+	v, _ := c.lookup(key)
+	if v == "" {
+		return fallback
+	}
+	f, err := strconv.ParseFloat(v, 64)
 	if err != nil {
-		return 0.0
+		log.Printf("WARN: Key %s is not a float: %q", key, v)
+		return fallback
 	}
 	return f
 }
@@ -39,12 +85,23 @@ func (c *Config) GetFloat64(key string, fallback float64) float64 {
 // GetInt returns the config value for a string key
 // It will first look in the env vars for the key
 // It will check the DB for the key if an env DNE
-// Finally, it will return a zero value if the key does not exist
-// It will attempt to convert the value to an int if it exists
+// Finally, it will return the fallback if the key does not exist
+// or its value cannot be converted to an int
+// A default registered for the key takes the place of the fallback
 func (c *Config) GetInt(key string, fallback int) int {
-	i, err := strconv.Atoi(c.GetString(key, strconv.Itoa(fallback)))
+	if d, ok := registeredDefault(key); ok {
+		if i, err := strconv.Atoi(d); err == nil {
+			fallback = i
+		}
+	}
+	v, _ := c.lookup(key)
+	if v == "" {
+		return fallback
+	}
+	i, err := strconv.Atoi(v)
 	if err != nil {
-		return 0
+		log.Printf("WARN: Key %s is not an int: %q", key, v)
+		return fallback
 	}
 	return i
 }
@@ -62,32 +119,90 @@ func envkey(key string) string {
 
 // GetString returns the config value for a string key
 // It will first look in the env vars for the key
-// It will check the DB for the key if an env DNE
-// Finally, it will return a zero value if the key does not exist
+// It will then look in the config file loaded by LoadFile
+// It will check the DB for the key if neither has it
+// Finally, it will return the fallback if the key does not exist
+// A default registered for the key takes the place of the fallback
 // It will convert the value to a string if it exists
 func (c *Config) GetString(key, fallback string) string {
+	if v, found := c.lookup(key); found {
+		return v
+	}
+	if d, ok := registeredDefault(key); ok {
+		return d
+	}
+	return fallback
+}
+
+// lookup finds the value set for a key in the env vars, the config file
+// or the DB, in that order
+func (c *Config) lookup(key string) (string, bool) {
+	v, src := c.find(key)
+	return v, src != ""
+}
+
+// Sources a value can come from, as given by Source
+const (
+	FromEnv     = "env"
+	FromFile    = "file"
+	FromDB      = "db"
+	FromDefault = "default"
+)
+
+// Source says which layer the value of a key comes from: FromEnv,
+// FromFile, FromDB or FromDefault, or "" if it has no value at all
+func (c *Config) Source(key string) string {
+	if _, src := c.find(key); src != "" {
+		return src
+	}
+	if _, ok := registeredDefault(key); ok {
+		return FromDefault
+	}
+	return ""
+}
+
+// shadow gives the layer that would hide a value stored in the DB, if any
+func (c *Config) shadow(key string) string {
+	key = strings.ToLower(key)
+	if _, found := os.LookupEnv(envkey(key)); found {
+		return FromEnv
+	}
+	if _, found := c.file[key]; found {
+		return FromFile
+	}
+	return ""
+}
+
+func (c *Config) find(key string) (string, string) {
 	key = strings.ToLower(key)
 	if v, found := os.LookupEnv(envkey(key)); found {
-		return v
+		return v, FromEnv
+	}
+	if v, found := c.file[key]; found {
+		return v, FromFile
 	}
 	var configValue string
 	q := `select value from config where key=?`
 	err := c.DB.Get(&configValue, q, key)
 	if err != nil {
 		log.Printf("WARN: Key %s is empty", key)
-		return fallback
+		return "", ""
 	}
-	return configValue
+	return configValue, FromDB
 }
 
 // GetArray returns the string slice config value for a string key
 // It will first look in the env vars for the key with ;; separated values
 // Look, I'm too lazy to do parsing to ensure that a comma is what the user meant
 // It will check the DB for the key if an env DNE
-// Finally, it will return a zero value if the key does not exist
+// Finally, it will return the fallback if the key does not exist
+// A default registered for the key takes the place of the fallback
 // This will do no conversion.
 func (c *Config) GetArray(key string, fallback []string) []string {
-	val := c.GetString(key, "")
+	val, _ := c.lookup(key)
+	if val == "" {
+		val, _ = registeredDefault(key)
+	}
 	if val == "" {
 		return fallback
 	}
@@ -96,15 +211,27 @@ func (c *Config) GetArray(key string, fallback []string) []string {
 
 // Set changes the value for a configuration in the database
 // Note, this is always a string. Use the SetArray for an array helper
+// Watchers of the key are called once the change is stored.
+// Keys given in the env or the config file are refused, since the stored
+// value would never be seen.
 func (c *Config) Set(key, value string) error {
 	key = strings.ToLower(key)
-	q := (`insert into config (key,value) values (?, ?)
-		on conflict(key) do update set value=?;`)
+	switch c.shadow(key) {
+	case FromEnv:
+		return fmt.Errorf("%s is set in the environment as %s, which wins over the database", key, envkey(key))
+	case FromFile:
+		return fmt.Errorf("%s is set in the config file, which wins over the database", key)
+	}
+	var old string
+	if err := c.DB.Get(&old, `select value from config where key=?`, key); err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	q := c.Dialect.Upsert("config", []string{"key"}, "value")
 	tx, err := c.Begin()
 	if err != nil {
 		return err
 	}
-	_, err = tx.Exec(q, key, value, value)
+	_, err = tx.Exec(q, key, value)
 	if err != nil {
 		return err
 	}
@@ -112,6 +239,9 @@ func (c *Config) Set(key, value string) error {
 	if err != nil {
 		return err
 	}
+	if old != value {
+		c.notify(key, old, value)
+	}
 	return nil
 }
 
@@ -124,7 +254,7 @@ func init() {
 	regex := func(re, s string) (bool, error) {
 		return regexp.MatchString(re, s)
 	}
-	sql.Register("sqlite3_custom",
+	sql.Register(SQLite.driver,
 		&sqlite3.SQLiteDriver{
 			ConnectHook: func(conn *sqlite3.SQLiteConn) error {
 				return conn.RegisterFunc("REGEXP", regex, true)
@@ -132,31 +262,61 @@ func init() {
 		})
 }
 
-// Readconfig loads the config data out of a JSON file located in cfile
+// Readconfig loads the config data out of the SQLite database at dbpath
 func ReadConfig(dbpath string) *Config {
 	if dbpath == "" {
 		dbpath = "catbase.db"
 	}
 	fmt.Printf("Using %s as database file.\n", dbpath)
-
-	sqlDB, err := sqlx.Open("sqlite3_custom", dbpath)
+	c, err := Open(SQLite.Name, dbpath)
 	if err != nil {
 		log.Fatal(err)
 	}
+	fmt.Printf("catbase is running.\n")
+	return c
+}
+
+// Open loads the config data out of a database.
+// driver is one of sqlite3, postgres or mysql and dsn is in the form that
+// database's Go driver expects, e.g. a file path for sqlite3.
+func Open(driver, dsn string) (*Config, error) {
+	d, err := FindDialect(driver)
+	if err != nil {
+		return nil, err
+	}
+	if d == MySQL {
+		// migrations run several statements at once
+		dsn = withParam(dsn, "multiStatements=true")
+	}
+
+	sqlDB, err := sqlx.Open(d.driver, dsn)
+	if err != nil {
+		return nil, err
+	}
 	c := Config{
-		DBFile: dbpath,
+		DB:      sqlDB,
+		Dialect: d,
+	}
+	if d == SQLite {
+		c.DBFile = dsn
 	}
-	c.DB = sqlDB
 
 	if _, err := c.Exec(`create table if not exists config (
 		key string,
 		value string,
 		primary key (key)
 	);`); err != nil {
-		panic(err)
+		return nil, err
 	}
+	return &c, nil
+}
 
-	fmt.Printf("catbase is running.\n")
-
-	return &c
+func withParam(dsn, param string) string {
+	if strings.Contains(dsn, param) {
+		return dsn
+	}
+	if strings.Contains(dsn, "?") {
+		return dsn + "&" + param
+	}
+	return dsn + "?" + param
 }
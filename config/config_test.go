@@ -1,6 +1,9 @@
 package config
 
 import (
+	"bytes"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -21,3 +24,129 @@ func TestSetGetArray(t *testing.T) {
 	actual := cfg.GetArray("test", []string{"NOPE"})
 	assert.Equal(t, expected, actual, "Config did not store values")
 }
+
+func TestGetIntBadValue(t *testing.T) {
+	cfg := ReadConfig(":memory:")
+	cfg.Set("test", "lots")
+	assert.Equal(t, 5, cfg.GetInt("test", 5))
+	assert.Equal(t, 0.5, cfg.GetFloat64("test", 0.5))
+}
+
+func TestRegisteredDefault(t *testing.T) {
+	Register(
+		Key{Name: "Defaults.String", Default: "schema"},
+		Key{Name: "Defaults.Int", Type: Int, Default: "7"},
+		Key{Name: "Defaults.Array", Type: Array, Default: "a;;b"},
+	)
+	cfg := ReadConfig(":memory:")
+	assert.Equal(t, "schema", cfg.Get("Defaults.String", ""))
+	assert.Equal(t, "schema", cfg.Get("Defaults.String", "call"))
+	assert.Equal(t, FromDefault, cfg.Source("Defaults.String"))
+	assert.Equal(t, 7, cfg.GetInt("Defaults.Int", 0))
+	assert.Equal(t, 7, cfg.GetInt("Defaults.Int", 3))
+	assert.Equal(t, []string{"a", "b"}, cfg.GetArray("Defaults.Array", []string{"c"}))
+	assert.Equal(t, []string{"a", "b"}, cfg.GetArray("Defaults.Array", nil))
+
+	cfg.Set("Defaults.Int", "9")
+	assert.Equal(t, 9, cfg.GetInt("Defaults.Int", 0))
+	cfg.Set("Defaults.Int", "nine")
+	assert.Equal(t, 7, cfg.GetInt("Defaults.Int", 0))
+}
+
+func TestValidate(t *testing.T) {
+	Register(
+		Key{Name: "Test.Count", Type: Int},
+		Key{Name: "Test.Password", Secret: true},
+	)
+	assert.NoError(t, Validate("test.count", "12"))
+	assert.Error(t, Validate("test.count", "twelve"))
+	assert.NoError(t, Validate("test.unknown", "anything"))
+	assert.True(t, IsSecret("TEST.PASSWORD"))
+	assert.False(t, IsSecret("test.count"))
+	assert.Len(t, Keys("test"), 2)
+}
+
+func TestExportImport(t *testing.T) {
+	Register(Key{Name: "Test.Freq", Type: Int}, Key{Name: "Test.Channels", Type: Array})
+	cfg := ReadConfig(":memory:")
+	cfg.Set("test.freq", "60")
+	cfg.SetArray("test.channels", []string{"#one", "#two"})
+	cfg.SetArray("test.undeclared", []string{"a", "b"})
+	cfg.Set("test.quote", `she said "hi"`)
+
+	var buf bytes.Buffer
+	assert.NoError(t, cfg.Export(&buf, false))
+	assert.Contains(t, buf.String(), `"test.freq" = 60`)
+
+	other := ReadConfig(":memory:")
+	n, err := other.Import(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, n)
+	assert.Equal(t, 60, other.GetInt("test.freq", 0))
+	assert.Equal(t, []string{"#one", "#two"}, other.GetArray("test.channels", nil))
+	assert.Equal(t, []string{"a", "b"}, other.GetArray("test.undeclared", nil))
+	assert.Equal(t, `she said "hi"`, other.Get("test.quote", ""))
+}
+
+func TestExportSecrets(t *testing.T) {
+	Register(Key{Name: "Export.Token", Secret: true})
+	cfg := ReadConfig(":memory:")
+	cfg.Set("export.token", "hunter2")
+	cfg.Set("export.name", "catbase")
+
+	var buf bytes.Buffer
+	assert.NoError(t, cfg.Export(&buf, false))
+	assert.NotContains(t, buf.String(), "hunter2")
+	assert.Contains(t, buf.String(), "catbase")
+
+	buf.Reset()
+	assert.NoError(t, cfg.Export(&buf, true))
+	assert.Contains(t, buf.String(), "hunter2")
+}
+
+func TestLoadFileLayering(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bot.toml")
+	doc := "[reaction]\ngeneralchance = 0.5\nharrasslist = [\"bob\", \"sue\"]\n"
+	assert.NoError(t, os.WriteFile(path, []byte(doc), 0644))
+
+	cfg := ReadConfig(":memory:")
+	cfg.Set("reaction.generalchance", "0.1")
+	cfg.Set("reaction.harrasschance", "0.2")
+	assert.NoError(t, cfg.LoadFile(path))
+	assert.Equal(t, 0.5, cfg.GetFloat64("Reaction.GeneralChance", 0))
+	assert.Equal(t, 0.2, cfg.GetFloat64("Reaction.HarrassChance", 0))
+	assert.Equal(t, []string{"bob", "sue"}, cfg.GetArray("Reaction.HarrassList", nil))
+	assert.Equal(t, FromFile, cfg.Source("reaction.generalchance"))
+	assert.Equal(t, FromDB, cfg.Source("reaction.harrasschance"))
+	assert.Equal(t, "", cfg.Source("reaction.nothing"))
+
+	assert.Error(t, cfg.Set("reaction.generalchance", "0.3"))
+	assert.Equal(t, 0.5, cfg.GetFloat64("Reaction.GeneralChance", 0))
+	assert.NoError(t, cfg.Set("reaction.harrasschance", "0.3"))
+
+	os.Setenv("REACTIONGENERALCHANCE", "0.7")
+	defer os.Unsetenv("REACTIONGENERALCHANCE")
+	assert.Equal(t, 0.7, cfg.GetFloat64("Reaction.GeneralChance", 0))
+	assert.Equal(t, FromEnv, cfg.Source("reaction.generalchance"))
+}
+
+func TestSetDefaultsKeepsSettings(t *testing.T) {
+	cfg := ReadConfig(":memory:")
+	cfg.Set("test.keep", "me")
+	cfg.SetDefaults("#chan", "catbase")
+	assert.Equal(t, "me", cfg.Get("test.keep", ""))
+	assert.Equal(t, "catbase", cfg.Get("nick", ""))
+}
+
+func TestWatch(t *testing.T) {
+	cfg := ReadConfig(":memory:")
+	cfg.Set("test.watched", "one")
+	changes := [][2]string{}
+	cfg.Watch("Test.Watched", func(old, new string) {
+		changes = append(changes, [2]string{old, new})
+	})
+	cfg.Set("test.watched", "two")
+	cfg.Set("test.watched", "two")
+	cfg.Set("test.other", "three")
+	assert.Equal(t, [][2]string{{"one", "two"}}, changes)
+}
@@ -1,37 +1,24 @@
 package config
 
 import (
-	"bytes"
 	"log"
-	"strings"
-	"text/template"
 )
 
-var q = `
-INSERT INTO config VALUES('nick','{{.Nick}}');
-INSERT INTO config VALUES('channels','{{.Channel}}');
-INSERT INTO config VALUES('untappd.channels','{{.Channel}}');
-INSERT INTO config VALUES('twitch.channels','{{.Channel}}');
-INSERT INTO config VALUES('init',1);
-`
-
 func (c *Config) SetDefaults(mainChannel, nick string) {
 	if nick == mainChannel && nick == "" {
 		log.Fatalf("You must provide a nick and a mainChannel")
 	}
-	t := template.Must(template.New("query").Parse(q))
-	vals := struct {
-		Nick       string
-		Channel    string
-		ChannelKey string
-	}{
-		nick,
-		mainChannel,
-		strings.ToLower(mainChannel),
+	defaults := []struct{ key, value string }{
+		{"nick", nick},
+		{"channels", mainChannel},
+		{"untappd.channels", mainChannel},
+		{"twitch.channels", mainChannel},
+		{"init", "1"},
+	}
+	for _, d := range defaults {
+		if err := c.Set(d.key, d.value); err != nil {
+			log.Fatalf("Could not set %s: %s", d.key, err)
+		}
 	}
-	var buf bytes.Buffer
-	t.Execute(&buf, vals)
-	c.MustExec(`delete from config;`)
-	c.MustExec(buf.String())
 	log.Println("Configuration initialized.")
 }
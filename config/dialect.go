@@ -0,0 +1,324 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+package config
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Dialect papers over the differences between the databases catbase can use.
+//
+// Queries are written for SQLite with ? placeholders. The drivers for other
+// databases rewrite placeholders and column types in create table statements
+// on the way through, see Translate. Things that can't be rewritten safely,
+// like random ordering and upserts, are built with the methods here.
+type Dialect struct {
+	// Name is what the db.driver option is set to for this dialect
+	Name string
+	// driver is the database/sql driver the dialect is registered as
+	driver string
+}
+
+var (
+	SQLite   = Dialect{Name: "sqlite3", driver: "sqlite3_custom"}
+	Postgres = Dialect{Name: "postgres", driver: "catbase_postgres"}
+	MySQL    = Dialect{Name: "mysql", driver: "catbase_mysql"}
+)
+
+var dialects = []Dialect{SQLite, Postgres, MySQL}
+
+// FindDialect looks up a dialect by the name used in the db.driver option
+func FindDialect(name string) (Dialect, error) {
+	for _, d := range dialects {
+		if strings.EqualFold(d.Name, name) {
+			return d, nil
+		}
+	}
+	return Dialect{}, fmt.Errorf("unknown database driver %s, try sqlite3, postgres or mysql", name)
+}
+
+// DialectOf finds the dialect a database was opened with.
+// Databases opened some other way are assumed to be SQLite.
+func DialectOf(db *sqlx.DB) Dialect {
+	for _, d := range dialects {
+		if db.DriverName() == d.driver {
+			return d
+		}
+	}
+	return SQLite
+}
+
+// Random is an expression for ordering rows randomly
+func (d Dialect) Random() string {
+	if d == MySQL {
+		return "rand()"
+	}
+	return "random()"
+}
+
+// Regexp is a condition matching column against a pattern given as a parameter
+func (d Dialect) Regexp(column string) string {
+	if d == Postgres {
+		return column + " ~ ?"
+	}
+	return column + " regexp ?"
+}
+
+// Contains is a condition that needle occurs somewhere in haystack
+func (d Dialect) Contains(haystack, needle string) string {
+	if d == Postgres {
+		return fmt.Sprintf("strpos(%s, %s) > 0", haystack, needle)
+	}
+	return fmt.Sprintf("instr(%s, %s) > 0", haystack, needle)
+}
+
+// Upsert builds an insert of cols into table that updates the other columns
+// of the existing row when one with the same keys is already there.
+// Arguments are given once per column, in order.
+func (d Dialect) Upsert(table string, keys []string, cols ...string) string {
+	all := append(append([]string{}, keys...), cols...)
+	q := fmt.Sprintf("insert into %s (%s) values (%s)",
+		table, strings.Join(all, ", "), strings.TrimSuffix(strings.Repeat("?, ", len(all)), ", "))
+	sets := []string{}
+	if d == MySQL {
+		for _, c := range cols {
+			sets = append(sets, fmt.Sprintf("%s=values(%s)", c, c))
+		}
+		if len(sets) == 0 {
+			sets = append(sets, fmt.Sprintf("%s=%s", keys[0], keys[0]))
+		}
+		return q + " on duplicate key update " + strings.Join(sets, ", ")
+	}
+	for _, c := range cols {
+		sets = append(sets, fmt.Sprintf("%s=excluded.%s", c, c))
+	}
+	q += fmt.Sprintf(" on conflict(%s) do ", strings.Join(keys, ", "))
+	if len(sets) == 0 {
+		return q + "nothing"
+	}
+	return q + "update set " + strings.Join(sets, ", ")
+}
+
+// inserter is satisfied by both *sqlx.DB and *sqlx.Tx
+type inserter interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// InsertID runs an insert into a table with an id column and gives the id
+// of the new row. Postgres can't report it from Exec so it is asked for.
+func (d Dialect) InsertID(db inserter, query string, args ...interface{}) (int64, error) {
+	if d == Postgres {
+		var id int64
+		err := db.QueryRow(strings.TrimSuffix(strings.TrimSpace(query), ";")+" returning id", args...).Scan(&id)
+		return id, err
+	}
+	res, err := db.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+var (
+	createTableRE = regexp.MustCompile(`(?is)^\s*create\s+table\s+(if\s+not\s+exists\s+)?(\w+)`)
+	createIndexRE = regexp.MustCompile(`(?is)^\s*create\s+(unique\s+)?index\s+(if\s+not\s+exists\s+)?\w+\s+on\s+(\w+)\s*\(([^)]*)\)`)
+)
+
+// Translate rewrites a query written for SQLite for this dialect.
+// Postgres gets numbered placeholders, MySQL gets its reserved words quoted,
+// and both get column types they understand in create table statements.
+// MySQL can't index text, so string columns indexed by a create index in the
+// same query become varchar(255), and it has no if not exists for indexes.
+func (d Dialect) Translate(query string) string {
+	if d == SQLite {
+		return query
+	}
+	stmts := splitStatements(query)
+	indexed := map[string]map[string]bool{}
+	for _, s := range stmts {
+		if m := createIndexRE.FindStringSubmatch(s); m != nil {
+			table := strings.ToLower(m[3])
+			if indexed[table] == nil {
+				indexed[table] = map[string]bool{}
+			}
+			for _, col := range strings.Split(m[4], ",") {
+				indexed[table][strings.ToLower(strings.TrimSpace(col))] = true
+			}
+		}
+	}
+	for i, s := range stmts {
+		if m := createTableRE.FindStringSubmatch(s); m != nil {
+			stmts[i] = d.translateCreate(s, indexed[strings.ToLower(m[2])])
+		} else if m := createIndexRE.FindStringSubmatchIndex(s); m != nil && d == MySQL && m[4] >= 0 {
+			stmts[i] = s[:m[4]] + s[m[5]:]
+		}
+	}
+	return d.translateTokens(strings.Join(stmts, ";"))
+}
+
+// splitStatements breaks a query on semicolons that aren't quoted
+func splitStatements(query string) []string {
+	stmts := []string{}
+	var quote rune
+	start := 0
+	for i, r := range query {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		case r == ';':
+			stmts = append(stmts, query[start:i])
+			start = i + 1
+		}
+	}
+	return append(stmts, query[start:])
+}
+
+// translateCreate maps the column types of a create table statement,
+// indexed holds the columns that other statements put an index on
+func (d Dialect) translateCreate(stmt string, indexed map[string]bool) string {
+	open, close := strings.Index(stmt, "("), strings.LastIndex(stmt, ")")
+	if open < 0 || close < open {
+		return stmt
+	}
+	items := splitTopLevel(stmt[open+1 : close])
+
+	// columns in a table level primary key need a type that can be indexed
+	keyed := map[string]bool{}
+	for col := range indexed {
+		keyed[col] = true
+	}
+	for _, item := range items {
+		lower := strings.ToLower(strings.TrimSpace(item))
+		if strings.HasPrefix(lower, "primary key") || strings.HasPrefix(lower, "unique") {
+			list := lower[strings.Index(lower, "(")+1 : strings.LastIndex(lower, ")")]
+			for _, col := range strings.Split(list, ",") {
+				keyed[strings.TrimSpace(col)] = true
+			}
+		}
+	}
+
+	for i, item := range items {
+		fields := strings.Fields(item)
+		if len(fields) < 2 {
+			continue
+		}
+		lower := strings.ToLower(item)
+		if strings.HasPrefix(strings.ToLower(fields[0]), "primary") || strings.HasPrefix(strings.ToLower(fields[0]), "unique") {
+			continue
+		}
+		name, typ, rest := fields[0], strings.ToLower(fields[1]), fields[2:]
+		primary := strings.Contains(lower, "primary key")
+		unique := primary || strings.Contains(lower, "unique") || keyed[strings.ToLower(name)]
+		rest = dropWord(rest, "autoincrement")
+		switch typ {
+		// interger is a typo in old babbler tables that SQLite doesn't mind
+		case "integer", "interger":
+			typ = "bigint"
+			if primary && d == Postgres {
+				typ = "bigserial"
+			} else if primary && d == MySQL {
+				rest = append(rest, "auto_increment")
+			}
+		case "string":
+			typ = "text"
+			if unique && d == MySQL {
+				typ = "varchar(255)"
+			}
+		}
+		items[i] = "\n\t" + strings.Join(append([]string{name, typ}, rest...), " ")
+	}
+	return stmt[:open+1] + strings.Join(items, ",") + "\n" + stmt[close:]
+}
+
+func splitTopLevel(s string) []string {
+	items := []string{}
+	depth, start := 0, 0
+	for i, r := range s {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				items = append(items, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(items, s[start:])
+}
+
+func dropWord(words []string, drop string) []string {
+	out := []string{}
+	for _, w := range words {
+		if !strings.EqualFold(w, drop) {
+			out = append(out, w)
+		}
+	}
+	return out
+}
+
+// mysqlReserved are column names catbase uses that MySQL reserves
+var mysqlReserved = map[string]bool{"key": true, "before": true}
+
+// keyPhrases are words that make a following "key" a keyword, not a column
+var keyPhrases = map[string]bool{"primary": true, "unique": true, "foreign": true, "duplicate": true}
+
+// translateTokens rewrites placeholders and reserved words outside quotes
+func (d Dialect) translateTokens(query string) string {
+	var out strings.Builder
+	var quote rune
+	n := 0
+	prev := ""
+	word := strings.Builder{}
+	flush := func() {
+		if word.Len() == 0 {
+			return
+		}
+		w := word.String()
+		lower := strings.ToLower(w)
+		if d == MySQL && mysqlReserved[lower] && !(lower == "key" && keyPhrases[prev]) {
+			w = "`" + w + "`"
+		}
+		out.WriteString(w)
+		prev = lower
+		word.Reset()
+	}
+	for _, r := range query {
+		if quote != 0 {
+			out.WriteRune(r)
+			if r == quote {
+				quote = 0
+			}
+			continue
+		}
+		if r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || word.Len() > 0 && r >= '0' && r <= '9' {
+			word.WriteRune(r)
+			continue
+		}
+		flush()
+		switch {
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+			out.WriteRune(r)
+		case r == '?' && d == Postgres:
+			n++
+			fmt.Fprintf(&out, "$%d", n)
+		default:
+			out.WriteRune(r)
+		}
+	}
+	flush()
+	return out.String()
+}
@@ -0,0 +1,72 @@
+package config_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/velour/catbase/bot/migrate"
+	"github.com/velour/catbase/config"
+
+	// plugins register their migrations when imported
+	_ "github.com/velour/catbase/bot/msglog"
+	_ "github.com/velour/catbase/plugins/babbler"
+	_ "github.com/velour/catbase/plugins/beers"
+	_ "github.com/velour/catbase/plugins/counter"
+	_ "github.com/velour/catbase/plugins/fact"
+	_ "github.com/velour/catbase/plugins/first"
+	_ "github.com/velour/catbase/plugins/reminder"
+)
+
+// openDialect gives a database for the dialect, SQLite is always tested in
+// memory and the others only when DBDRIVER names them and DBDSN points at a
+// scratch database
+func openDialect(t *testing.T, d config.Dialect) *config.Config {
+	if d == config.SQLite {
+		return config.ReadConfig(":memory:")
+	}
+	dsn := os.Getenv("DBDSN")
+	if dsn == "" || !strings.EqualFold(os.Getenv("DBDRIVER"), d.Name) {
+		t.Skipf("set DBDRIVER=%s and DBDSN to test against %s", d.Name, d.Name)
+	}
+	c, err := config.Open(d.Name, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestMigrationsEachDialect(t *testing.T) {
+	for _, d := range []config.Dialect{config.SQLite, config.Postgres, config.MySQL} {
+		t.Run(d.Name, func(t *testing.T) {
+			c := openDialect(t, d)
+			defer c.Close()
+
+			for _, plugin := range migrate.Plugins() {
+				assert.NoError(t, migrate.Up(c.DB, plugin), plugin)
+			}
+			states, err := migrate.Status(c.DB)
+			assert.NoError(t, err)
+			for _, s := range states {
+				assert.Empty(t, s.Pending, s.Plugin)
+			}
+
+			channel := "#dialect-test-" + time.Now().Format("150405.000000")
+			defer c.Exec(`delete from msglog where channel=?`, channel)
+			_, err = c.Exec(`insert into msglog (channel, user_id, user_name, body, time, thread_id)
+				values (?, ?, ?, ?, ?, ?)`, channel, "U1", "alice", "hi 'there'", 1500000000, "T1")
+			assert.NoError(t, err)
+			var body string
+			err = c.DB.Get(&body, `select body from msglog where channel=? and thread_id=?`, channel, "T1")
+			assert.NoError(t, err)
+			assert.Equal(t, "hi 'there'", body)
+
+			assert.NoError(t, c.Set("dialect.test", "value"))
+			assert.NoError(t, c.Set("dialect.test", "changed"))
+			assert.Equal(t, "changed", c.Get("dialect.test", ""))
+		})
+	}
+}
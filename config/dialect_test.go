@@ -0,0 +1,79 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTranslatePlaceholders(t *testing.T) {
+	q := Postgres.Translate(`select * from factoid where fact=? and tidbit='what?' and verb=?`)
+	assert.Equal(t, `select * from factoid where fact=$1 and tidbit='what?' and verb=$2`, q)
+	assert.Equal(t, `select 1 where a=?`, SQLite.Translate(`select 1 where a=?`))
+}
+
+func TestTranslateCreate(t *testing.T) {
+	ddl := `create table if not exists counter_alias (
+			id integer PRIMARY KEY AUTOINCREMENT,
+			item string NOT NULL UNIQUE,
+			points_to string NOT NULL
+		);`
+	pg := Postgres.Translate(ddl)
+	assert.Contains(t, pg, "id bigserial PRIMARY KEY")
+	assert.NotContains(t, pg, "AUTOINCREMENT")
+	assert.Contains(t, pg, "item text NOT NULL UNIQUE")
+
+	my := MySQL.Translate(ddl)
+	assert.Contains(t, my, "id bigint PRIMARY KEY auto_increment")
+	assert.Contains(t, my, "item varchar(255) NOT NULL UNIQUE")
+	assert.Contains(t, my, "points_to text NOT NULL")
+}
+
+func TestTranslateIndex(t *testing.T) {
+	ddl := `create table if not exists msglog (
+			id integer primary key,
+			channel string,
+			body string,
+			time integer
+		);
+		create index if not exists msglog_channel_time on msglog (channel, time);`
+	my := MySQL.Translate(ddl)
+	assert.Contains(t, my, "channel varchar(255)")
+	assert.Contains(t, my, "body text")
+	assert.Contains(t, my, "create index msglog_channel_time on msglog (channel, time)")
+
+	pg := Postgres.Translate(ddl)
+	assert.Contains(t, pg, "channel text")
+	assert.Contains(t, pg, "create index if not exists msglog_channel_time")
+}
+
+func TestTranslateMySQLReserved(t *testing.T) {
+	ddl := MySQL.Translate(`create table if not exists config (key string, value string, primary key (key));`)
+	assert.Contains(t, ddl, "`key` varchar(255)")
+	assert.Contains(t, ddl, "primary key (`key`)")
+
+	q := MySQL.Translate(configUpsert(MySQL))
+	assert.Equal(t, "insert into config (`key`, value) values (?, ?) on duplicate key update value=values(value)", q)
+}
+
+func configUpsert(d Dialect) string {
+	return d.Upsert("config", []string{"key"}, "value")
+}
+
+func TestUpsert(t *testing.T) {
+	assert.Equal(t, "insert into config (key, value) values (?, ?) on conflict(key) do update set value=excluded.value",
+		configUpsert(SQLite))
+	assert.Equal(t, "insert into factoid_alias (fact, next) values (?, ?) on conflict(fact, next) do nothing",
+		Postgres.Upsert("factoid_alias", []string{"fact", "next"}))
+}
+
+func TestOpenUnknownDriver(t *testing.T) {
+	_, err := Open("oracle", "")
+	assert.Error(t, err)
+}
+
+func TestDialectOf(t *testing.T) {
+	c := ReadConfig(":memory:")
+	assert.Equal(t, SQLite, DialectOf(c.DB))
+	assert.Equal(t, SQLite, c.Dialect)
+}
@@ -0,0 +1,69 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+package config
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+func init() {
+	sql.Register(Postgres.driver, translator{Postgres, &pq.Driver{}})
+	sql.Register(MySQL.driver, translator{MySQL, &mysql.MySQLDriver{}})
+}
+
+// translator wraps a driver, translating every query for its dialect
+// before the driver sees it
+type translator struct {
+	dialect Dialect
+	driver.Driver
+}
+
+func (t translator) Open(dsn string) (driver.Conn, error) {
+	c, err := t.Driver.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &translatingConn{t.dialect, c}, nil
+}
+
+type translatingConn struct {
+	dialect Dialect
+	driver.Conn
+}
+
+func (c *translatingConn) Prepare(query string) (driver.Stmt, error) {
+	return c.Conn.Prepare(c.dialect.Translate(query))
+}
+
+func (c *translatingConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return p.PrepareContext(ctx, c.dialect.Translate(query))
+	}
+	return c.Prepare(query)
+}
+
+func (c *translatingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if e, ok := c.Conn.(driver.ExecerContext); ok {
+		return e.ExecContext(ctx, c.dialect.Translate(query), args)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c *translatingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if q, ok := c.Conn.(driver.QueryerContext); ok {
+		return q.QueryContext(ctx, c.dialect.Translate(query), args)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c *translatingConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
@@ -0,0 +1,169 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+package config
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// LoadFile layers the keys in a TOML file over the database.
+// Lookups check the environment, then the file, then the database,
+// so settings kept in version control win over ones set in chat.
+func (c *Config) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	values, err := readTOML(f)
+	if err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+	c.file = values
+	return nil
+}
+
+// Import reads a TOML file and stores every key in it in the database
+func (c *Config) Import(r io.Reader) (int, error) {
+	values, err := readTOML(r)
+	if err != nil {
+		return 0, err
+	}
+	keys := sortedKeys(values)
+	for _, k := range keys {
+		if err := c.Set(k, values[k]); err != nil {
+			return 0, err
+		}
+	}
+	return len(keys), nil
+}
+
+// Export writes every key in the database as TOML.
+// Arrays become TOML arrays and keys declared as numbers or bools keep
+// their type, so the file can be edited by hand and imported again.
+// Secret keys are left out unless secrets is set.
+func (c *Config) Export(w io.Writer, secrets bool) error {
+	rows, err := c.Query(`select key, value from config order by key`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	out := map[string]interface{}{}
+	for rows.Next() {
+		var k, v string
+		if err := rows.Scan(&k, &v); err != nil {
+			return err
+		}
+		if IsSecret(k) && !secrets {
+			continue
+		}
+		out[k] = exportValue(k, v)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return toml.NewEncoder(w).Encode(out)
+}
+
+func exportValue(key, value string) interface{} {
+	decl, ok := Lookup(key)
+	if !ok {
+		if strings.Contains(value, ";;") {
+			return strings.Split(value, ";;")
+		}
+		return value
+	}
+	switch decl.Type {
+	case Array:
+		if value == "" {
+			return []string{}
+		}
+		return strings.Split(value, ";;")
+	case Int:
+		if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return i
+		}
+	case Float:
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	case Bool:
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return value
+}
+
+// readTOML flattens a TOML document into config keys.
+// Tables become dotted prefixes, so [untappd] freq = 60 sets untappd.freq.
+func readTOML(r io.Reader) (map[string]string, error) {
+	doc := map[string]interface{}{}
+	if _, err := toml.DecodeReader(r, &doc); err != nil {
+		return nil, err
+	}
+	values := map[string]string{}
+	if err := flatten("", doc, values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func flatten(prefix string, doc map[string]interface{}, values map[string]string) error {
+	for k, v := range doc {
+		key := strings.ToLower(prefix + k)
+		switch v := v.(type) {
+		case map[string]interface{}:
+			if err := flatten(key+".", v, values); err != nil {
+				return err
+			}
+		case []interface{}:
+			items := []string{}
+			for _, item := range v {
+				s, err := scalar(item)
+				if err != nil {
+					return fmt.Errorf("%s: %s", key, err)
+				}
+				items = append(items, s)
+			}
+			values[key] = strings.Join(items, ";;")
+		default:
+			s, err := scalar(v)
+			if err != nil {
+				return fmt.Errorf("%s: %s", key, err)
+			}
+			values[key] = s
+		}
+	}
+	return nil
+}
+
+func scalar(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	return "", fmt.Errorf("cannot store a %T", v)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
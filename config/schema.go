@@ -0,0 +1,150 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Type is the kind of value a config key holds
+type Type int
+
+const (
+	String Type = iota
+	Int
+	Float
+	Bool
+	// Array values are stored separated by ;;
+	Array
+)
+
+func (t Type) String() string {
+	switch t {
+	case String:
+		return "string"
+	case Int:
+		return "int"
+	case Float:
+		return "float"
+	case Bool:
+		return "bool"
+	case Array:
+		return "array"
+	}
+	return fmt.Sprintf("Type(%d)", int(t))
+}
+
+// Key describes a config key that can be tuned
+type Key struct {
+	Name        string
+	Type        Type
+	Default     string
+	Description string
+	// Secret keys can't be read or written through chat
+	Secret bool
+}
+
+// Plugin gives the part of the key before the first dot, lowercased.
+// Keys without a dot belong to the bot itself.
+func (k Key) Plugin() string {
+	if i := strings.Index(k.Name, "."); i > 0 {
+		return strings.ToLower(k.Name[:i])
+	}
+	return "bot"
+}
+
+// Validate checks that value can be parsed as the key's type
+func (k Key) Validate(value string) error {
+	var err error
+	switch k.Type {
+	case Int:
+		_, err = strconv.Atoi(value)
+	case Float:
+		_, err = strconv.ParseFloat(value, 64)
+	case Bool:
+		_, err = strconv.ParseBool(value)
+	}
+	if err != nil {
+		return fmt.Errorf("%s must be a %s", k.Name, k.Type)
+	}
+	return nil
+}
+
+var schema = struct {
+	sync.RWMutex
+	keys map[string]Key
+}{keys: map[string]Key{}}
+
+// Register declares config keys. Packages call it from init so that every
+// key, including secrets for connectors that aren't running, is known.
+func Register(keys ...Key) {
+	schema.Lock()
+	defer schema.Unlock()
+	for _, k := range keys {
+		schema.keys[strings.ToLower(k.Name)] = k
+	}
+}
+
+// Lookup finds the declaration of a key
+func Lookup(name string) (Key, bool) {
+	schema.RLock()
+	defer schema.RUnlock()
+	k, ok := schema.keys[strings.ToLower(name)]
+	return k, ok
+}
+
+// registeredDefault gives the default declared for a key, if any.
+// A declared default replaces whatever fallback the caller passes.
+func registeredDefault(name string) (string, bool) {
+	k, ok := Lookup(name)
+	return k.Default, ok && k.Default != ""
+}
+
+// IsSecret reports whether a key is declared secret
+func IsSecret(name string) bool {
+	k, ok := Lookup(name)
+	return ok && k.Secret
+}
+
+// Validate checks a value against the declared type of a key.
+// Undeclared keys accept anything.
+func Validate(name, value string) error {
+	k, ok := Lookup(name)
+	if !ok {
+		return nil
+	}
+	return k.Validate(value)
+}
+
+// Keys lists the declared keys for a plugin, or every key if plugin is empty
+func Keys(plugin string) []Key {
+	schema.RLock()
+	defer schema.RUnlock()
+	keys := []Key{}
+	for _, k := range schema.keys {
+		if plugin == "" || k.Plugin() == strings.ToLower(plugin) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return strings.ToLower(keys[i].Name) < strings.ToLower(keys[j].Name)
+	})
+	return keys
+}
+
+func init() {
+	Register(
+		Key{Name: "Nick", Default: "bot", Description: "name the bot goes by"},
+		Key{Name: "FullName", Default: "bot", Description: "real name shown by some services"},
+		Key{Name: "channels", Type: Array, Description: "channels to join"},
+		Key{Name: "Admins", Type: Array, Description: "connector user IDs that are always admins, such as U024BE7LH on Slack or user@host on IRC; nicks are not accepted"},
+		Key{Name: "CommandChar", Type: Array, Default: "!", Description: "prefixes that mark a message as a command"},
+		Key{Name: "HttpAddr", Default: "127.0.0.1:1337", Description: "address the web interface listens on"},
+		Key{Name: "BaseURL", Description: "public URL of the web interface, for links"},
+		Key{Name: "type", Default: "slackapp", Description: "connector to use"},
+	)
+}
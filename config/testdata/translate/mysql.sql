@@ -0,0 +1,709 @@
+-- migration babbler 1
+create table if not exists babblers (
+	id bigint primary key auto_increment,
+	babbler text
+);
+			create table if not exists babblerWords (
+	id bigint primary key auto_increment,
+	word text
+);
+			create table if not exists babblerNodes (
+	id bigint primary key auto_increment,
+	babblerId bigint,
+	wordId bigint,
+	root bigint,
+	rootFrequency bigint
+);
+			create table if not exists babblerArcs (
+	id bigint primary key auto_increment,
+	fromNodeId bigint,
+	toNodeId bigint,
+	frequency bigint
+);
+
+-- migration babbler 2
+create table babblerArcs_new (
+	id bigint primary key auto_increment,
+	fromNodeId bigint,
+	toNodeId bigint,
+	frequency bigint
+);
+			insert into babblerArcs_new (id, fromNodeId, toNodeId, frequency)
+				select id, fromNodeId, toNodeId, frequency from babblerArcs;
+			drop table babblerArcs;
+			alter table babblerArcs_new rename to babblerArcs;
+
+-- migration beers 1
+create table if not exists untappd (
+	id bigint primary key auto_increment,
+	untappdUser text,
+	channel text,
+	lastCheckin bigint,
+	chanNick text
+);
+
+-- migration counter 1
+create table if not exists counter (
+	id bigint primary key auto_increment,
+	nick text,
+	item text,
+	count bigint
+);
+			create table if not exists counter_alias (
+	id bigint PRIMARY KEY auto_increment,
+	item varchar(255) NOT NULL UNIQUE,
+	points_to text NOT NULL
+);
+
+-- migration fact 1
+create table if not exists factoid (
+	id bigint primary key auto_increment,
+	fact text,
+	tidbit text,
+	verb text,
+	owner text,
+	created bigint,
+	accessed bigint,
+	count bigint
+);
+			create table if not exists factoid_alias (
+	fact varchar(255),
+	next varchar(255),
+				primary key (fact, next)
+			
+);
+
+-- migration fact 2
+create table if not exists factoid_history (
+	id bigint primary key auto_increment,
+	fact_id bigint,
+	fact text,
+	tidbit text,
+	verb text,
+	owner text,
+	created bigint,
+	count bigint,
+	action text,
+	changed_by text,
+	changed bigint
+);
+
+-- migration fact 3
+alter table factoid_history add column channel text;
+
+-- migration first 1
+create table if not exists first (
+	id bigint primary key auto_increment,
+	day bigint,
+	time bigint,
+	body text,
+	nick text
+);
+
+-- migration msglog 1
+create table if not exists msglog (
+	id bigint primary key auto_increment,
+	channel varchar(255),
+	user_id text,
+	user_name text,
+	body text,
+	raw text,
+	command bigint,
+	action bigint,
+	time bigint,
+	host text
+);
+			create index msglog_channel_time on msglog (channel, time);
+
+-- migration msglog 2
+alter table msglog add column msg_id text;
+			alter table msglog add column thread_id text;
+			alter table msglog add column parent_id text;
+
+-- migration reminder 1
+create table if not exists reminders (
+	id bigint primary key auto_increment,
+	fromWho text,
+	toWho text,
+	what text,
+	remindWhen text,
+	channel text
+);
+
+-- bot/audit/audit.go Migrate
+create table if not exists audit (
+	id bigint primary key auto_increment,
+	time bigint,
+	user_id text,
+	nick text,
+	channel text,
+	plugin text,
+	action text,
+	target text,
+	`before` text,
+	after text
+);
+
+-- bot/audit/audit.go Recent
+select id, time, user_id, nick, channel, plugin, action, target, `before`, after
+		from audit
+
+-- bot/audit/audit.go Record
+insert into audit
+		(time, user_id, nick, channel, plugin, action, target, `before`, after)
+		values (?, ?, ?, ?, ?, ?, ?, ?, ?)
+
+-- bot/bot.go bot.migrateDB
+create table if not exists variables (
+	id bigint primary key auto_increment,
+	name text,
+	value text
+);
+
+-- bot/handlers.go bot.getVar
+select value from variables where name=? order by
+
+-- bot/handlers.go bot.listVars
+select name from variables group by name
+
+-- bot/migrate/migrate.go Version
+select coalesce(max(version), 0) from schema_migrations where plugin=?
+
+-- bot/migrate/migrate.go apply
+insert into schema_migrations (plugin, version, description, applied)
+		values (?, ?, ?, ?)
+
+-- bot/migrate/migrate.go migrateSelf
+create table if not exists schema_migrations (
+	plugin varchar(255),
+	version bigint,
+	description text,
+	applied bigint,
+			primary key (plugin, version)
+		
+);
+
+-- bot/mock.go NewMockBot
+delete from msglog
+
+-- bot/mock.go NewMockBot #2
+delete from roles
+
+-- bot/mock.go NewMockBot #3
+delete from audit
+
+-- bot/msglog/msglog.go Store.Add
+insert into msglog
+		(channel, user_id, user_name, body, raw, command, action, time, host, msg_id, thread_id, parent_id)
+		values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+
+-- bot/msglog/msglog.go Store.Find
+select id, channel, user_id, user_name, body, raw, command, action, time, host,
+		coalesce(msg_id, ''), coalesce(thread_id, ''), coalesce(parent_id, '')
+		from msglog where
+
+-- bot/msglog/msglog.go Store.Prune
+delete from msglog where time < ?
+
+-- bot/msglog/msglog.go Store.Prune #2
+delete from msglog where id <= (
+				select id from msglog order by id desc limit 1 offset ?)
+
+-- bot/msglog/msglog.go init
+create table if not exists msglog (
+	id bigint primary key auto_increment,
+	channel varchar(255),
+	user_id text,
+	user_name text,
+	body text,
+	raw text,
+	command bigint,
+	action bigint,
+	time bigint,
+	host text
+);
+			create index msglog_channel_time on msglog (channel, time);
+
+-- bot/msglog/msglog.go init #2
+alter table msglog add column msg_id text;
+			alter table msglog add column thread_id text;
+			alter table msglog add column parent_id text;
+
+-- bot/roles.go lookupRole
+select role from roles where user_id=?
+
+-- bot/roles.go migrateRoles
+create table if not exists roles (
+	user_id varchar(255) primary key,
+	role text
+);
+
+-- bot/roles.go storeRole
+delete from roles where user_id=?
+
+-- config/config.go Config.Set
+select value from config where `key`=?
+
+-- config/config.go Config.find
+select value from config where `key`=?
+
+-- config/config.go Open
+create table if not exists config (
+	`key` varchar(255),
+	value text,
+		primary key (`key`)
+	
+);
+
+-- config/dialect.go Dialect.Upsert
+insert into %s (%s) values (%s)
+
+-- config/file.go Config.Export
+select `key`, value from config order by `key`
+
+-- plugins/admin/admin.go AdminPlugin.handleVariables
+delete from variables where name=? and value=?
+
+-- plugins/admin/admin.go AdminPlugin.handleVariables #2
+select count(*) from variables where value = ?
+
+-- plugins/admin/admin.go AdminPlugin.handleVariables #3
+INSERT INTO variables (name, value) VALUES (?, ?)
+
+-- plugins/babbler/babbler.go BabblerPlugin.babbleSeedBookends
+select * from babblerWords where id = ? LIMIT 1;
+
+-- plugins/babbler/babbler.go BabblerPlugin.createBabblerNode
+insert into babblerNodes (babblerId, wordId, root, rootFrequency) values (?, ?, 0, 0)
+
+-- plugins/babbler/babbler.go BabblerPlugin.createNewWord
+insert into babblerWords (word) values (?);
+
+-- plugins/babbler/babbler.go BabblerPlugin.getBabbler
+select * from babblers where babbler = ? LIMIT 1;
+
+-- plugins/babbler/babbler.go BabblerPlugin.getBabblerArc
+select * from babblerArcs where fromNodeId = ? and toNodeId = ?;
+
+-- plugins/babbler/babbler.go BabblerPlugin.getBabblerNode
+select * from babblerNodes where babblerId = ? and wordId = ? LIMIT 1;
+
+-- plugins/babbler/babbler.go BabblerPlugin.getBabblerNodeById
+select * from babblerNodes where id = ? LIMIT 1;
+
+-- plugins/babbler/babbler.go BabblerPlugin.getNextArcs
+select * from babblerArcs where fromNodeId = ?;
+
+-- plugins/babbler/babbler.go BabblerPlugin.getOrCreateBabbler
+select tidbit from factoid where fact like '%s quotes';
+
+-- plugins/babbler/babbler.go BabblerPlugin.getWeightedNextWord
+select * from babblerArcs where fromNodeId = ?;
+
+-- plugins/babbler/babbler.go BabblerPlugin.getWeightedNextWord #2
+select * from babblerNodes where id = ? LIMIT 1;
+
+-- plugins/babbler/babbler.go BabblerPlugin.getWeightedNextWord #3
+select * from babblerWords where id = ? LIMIT 1;
+
+-- plugins/babbler/babbler.go BabblerPlugin.getWeightedPreviousWord
+select * from babblerArcs where toNodeId = ?;
+
+-- plugins/babbler/babbler.go BabblerPlugin.getWeightedPreviousWord #2
+select * from babblerNodes where id = ? LIMIT 1;
+
+-- plugins/babbler/babbler.go BabblerPlugin.getWeightedPreviousWord #3
+select * from babblerWords where id = ? LIMIT 1;
+
+-- plugins/babbler/babbler.go BabblerPlugin.getWeightedRootNode
+select * from babblerNodes where babblerId = ? and root = 1;
+
+-- plugins/babbler/babbler.go BabblerPlugin.getWeightedRootNode #2
+select * from babblerWords where id = ? LIMIT 1;
+
+-- plugins/babbler/babbler.go BabblerPlugin.getWord
+select * from babblerWords where word = ? LIMIT 1;
+
+-- plugins/babbler/babbler.go BabblerPlugin.incrementRootWordFrequency
+update babblerNodes set rootFrequency = rootFrequency + 1, root = 1 where id = ?;
+
+-- plugins/babbler/babbler.go BabblerPlugin.incrementWordArc
+update babblerArcs set frequency = frequency + 1 where fromNodeId = ? and toNodeId = ?;
+
+-- plugins/babbler/babbler.go BabblerPlugin.incrementWordArc #2
+insert into babblerArcs (fromNodeId, toNodeId, frequency) values (?, ?, 1);
+
+-- plugins/babbler/babbler.go BabblerPlugin.makeBabbler
+insert into babblers (babbler) values (?);
+
+-- plugins/babbler/babbler.go BabblerPlugin.mergeBabblers
+select * from babblerNodes where babblerId = ?;
+
+-- plugins/babbler/babbler.go BabblerPlugin.mergeBabblers #2
+update babblerNodes set rootFrequency = rootFrequency + ?, root = 1 where babblerId = ? and wordId = ?;
+
+-- plugins/babbler/babbler.go BabblerPlugin.mergeBabblers #3
+update babblerNodes set rootFrequency = rootFrequency + ? where babblerId = ? and wordId = ?;
+
+-- plugins/babbler/babbler.go BabblerPlugin.mergeBabblers #4
+insert into babblerNodes (babblerId, wordId, root, rootFrequency) values (?,?,?,?) ;
+
+-- plugins/babbler/babbler.go BabblerPlugin.mergeBabblers #5
+select * from babblerNodes where babblerId = ? and wordId = ? LIMIT 1;
+
+-- plugins/babbler/babbler.go BabblerPlugin.mergeBabblers #6
+select * from babblerArcs where fromNodeId = ?;
+
+-- plugins/babbler/babbler.go init
+create table if not exists babblers (
+	id bigint primary key auto_increment,
+	babbler text
+);
+			create table if not exists babblerWords (
+	id bigint primary key auto_increment,
+	word text
+);
+			create table if not exists babblerNodes (
+	id bigint primary key auto_increment,
+	babblerId bigint,
+	wordId bigint,
+	root bigint,
+	rootFrequency bigint
+);
+			create table if not exists babblerArcs (
+	id bigint primary key auto_increment,
+	fromNodeId bigint,
+	toNodeId bigint,
+	frequency bigint
+);
+
+-- plugins/babbler/babbler.go init #2
+create table babblerArcs_new (
+	id bigint primary key auto_increment,
+	fromNodeId bigint,
+	toNodeId bigint,
+	frequency bigint
+);
+			insert into babblerArcs_new (id, fromNodeId, toNodeId, frequency)
+				select id, fromNodeId, toNodeId, frequency from babblerArcs;
+			drop table babblerArcs;
+			alter table babblerArcs_new rename to babblerArcs;
+
+-- plugins/beers/beers.go BeersPlugin.checkUntappd
+select id, untappdUser, channel, lastCheckin, chanNick from untappd;
+
+-- plugins/beers/beers.go BeersPlugin.checkUntappd #2
+update untappd set
+			lastCheckin = ?
+		where id = ?
+
+-- plugins/beers/beers.go BeersPlugin.doIKnow
+select count(*) from beers where nick = ?
+
+-- plugins/beers/beers.go BeersPlugin.message
+select count(*) from untappd
+			where untappdUser = ?
+
+-- plugins/beers/beers.go BeersPlugin.message #2
+insert into untappd (
+			untappdUser,
+			channel,
+			lastCheckin,
+			chanNick
+		) values (?, ?, ?, ?);
+
+-- plugins/beers/beers.go init
+create table if not exists untappd (
+	id bigint primary key auto_increment,
+	untappdUser text,
+	channel text,
+	lastCheckin bigint,
+	chanNick text
+);
+
+-- plugins/counter/counter.go GetItem
+select * from counter_alias where item=?
+
+-- plugins/counter/counter.go GetItem #2
+select * from counter where nick = ? and item= ?
+
+-- plugins/counter/counter.go GetItems
+select * from counter where nick = ?
+
+-- plugins/counter/counter.go Item.Create
+insert into counter (nick, item, count) values (?, ?, ?);
+
+-- plugins/counter/counter.go Item.Delete
+delete from counter where id = ?
+
+-- plugins/counter/counter.go Item.Update
+update counter set count = ? where id = ?
+
+-- plugins/counter/counter.go Leader
+select * from counter where item=? order by count desc
+
+-- plugins/counter/counter.go LeaderAll
+select id,item,nick,max(count) as count from counter group by item having count(nick) > 1 and max(count) > 1 order by count desc
+
+-- plugins/counter/counter.go MkAlias
+insert into counter_alias (item, points_to) values (?, ?)
+
+-- plugins/counter/counter.go MkAlias #2
+update counter_alias set points_to=? where item=?
+
+-- plugins/counter/counter.go MkAlias #3
+select * from counter_alias where item=?
+
+-- plugins/counter/counter.go init
+create table if not exists counter (
+	id bigint primary key auto_increment,
+	nick text,
+	item text,
+	count bigint
+);
+			create table if not exists counter_alias (
+	id bigint PRIMARY KEY auto_increment,
+	item varchar(255) NOT NULL UNIQUE,
+	points_to text NOT NULL
+);
+
+-- plugins/fact/factoid.go Factoid.Save
+update factoid set
+			fact=?,
+			tidbit=?,
+			verb=?,
+			owner=?,
+			accessed=?,
+			count=?
+		where id=?
+
+-- plugins/fact/factoid.go Factoid.Save #2
+insert into factoid (
+			fact,
+			tidbit,
+			verb,
+			owner,
+			created,
+			accessed,
+			count
+		) values (?, ?, ?, ?, ?, ?, ?);
+
+-- plugins/fact/factoid.go Factoid.delete
+delete from factoid where id=?
+
+-- plugins/fact/factoid.go FactoidPlugin.learnFact
+select count(*) from factoid
+		where fact=? and verb=? and tidbit=?
+
+-- plugins/fact/factoid.go GetSingle
+select
+			id,
+			fact,
+			tidbit,
+			verb,
+			owner,
+			created,
+			accessed,
+			count
+		from factoid
+		order by
+
+-- plugins/fact/factoid.go GetSingleFact
+select
+			id,
+			fact,
+			tidbit,
+			verb,
+			owner,
+			created,
+			accessed,
+			count
+		from factoid
+		where fact like ?
+		order by
+
+-- plugins/fact/factoid.go alias.resolve
+select fact, next from factoid_alias where fact=?
+
+-- plugins/fact/factoid.go alias.save
+select * from factoid_alias where fact=?
+
+-- plugins/fact/factoid.go findAlias
+select * from factoid_alias where fact=?
+
+-- plugins/fact/factoid.go getFactByID
+select
+			id,
+			fact,
+			tidbit,
+			verb,
+			owner,
+			created,
+			accessed,
+			count
+		from factoid
+		where id=?;
+
+-- plugins/fact/factoid.go getFacts
+select
+			id,
+			fact,
+			tidbit,
+			verb,
+			owner,
+			created,
+			accessed,
+			count
+		from factoid
+		where fact like ?
+		and tidbit like ?;
+
+-- plugins/fact/revisions.go factHistory
+select id, fact_id, fact, tidbit, verb, owner, created, count, action, changed_by, changed from factoid_history
+		where fact=? or fact_id in (select id from factoid where fact=?)
+		order by id desc limit ?
+
+-- plugins/fact/revisions.go getRevision
+select id, fact_id, fact, tidbit, verb, owner, created, count, action, changed_by, changed from factoid_history where id=?
+
+-- plugins/fact/revisions.go init
+create table if not exists factoid (
+	id bigint primary key auto_increment,
+	fact text,
+	tidbit text,
+	verb text,
+	owner text,
+	created bigint,
+	accessed bigint,
+	count bigint
+);
+			create table if not exists factoid_alias (
+	fact varchar(255),
+	next varchar(255),
+				primary key (fact, next)
+			
+);
+
+-- plugins/fact/revisions.go init #2
+create table if not exists factoid_history (
+	id bigint primary key auto_increment,
+	fact_id bigint,
+	fact text,
+	tidbit text,
+	verb text,
+	owner text,
+	created bigint,
+	count bigint,
+	action text,
+	changed_by text,
+	changed bigint
+);
+
+-- plugins/fact/revisions.go init #3
+alter table factoid_history add column channel text;
+
+-- plugins/fact/revisions.go lastRevision
+select id, fact_id, fact, tidbit, verb, owner, created, count, action, changed_by, changed from factoid_history
+		where channel=? order by id desc limit 1
+
+-- plugins/fact/revisions.go revision.delete
+delete from factoid_history where id=?
+
+-- plugins/fact/revisions.go revision.restore
+insert into factoid
+			(id, fact, tidbit, verb, owner, created, accessed, count)
+			values (?, ?, ?, ?, ?, ?, ?, ?)
+
+-- plugins/fact/revisions.go saveRevision
+insert into factoid_history
+		(fact_id, fact, tidbit, verb, owner, created, count, action, changed_by, changed, channel)
+		values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+
+-- plugins/first/first.go FirstEntry.save
+insert into first (day, time, body, nick)
+		values (?, ?, ?, ?)
+
+-- plugins/first/first.go getLastFirst
+select
+		id, max(day), time, body, nick from first
+		limit 1;
+
+-- plugins/first/first.go init
+create table if not exists first (
+	id bigint primary key auto_increment,
+	day bigint,
+	time bigint,
+	body text,
+	nick text
+);
+
+-- plugins/inventory/inventory.go InventoryPlugin.addItem
+INSERT INTO inventory (item) values (?)
+
+-- plugins/inventory/inventory.go InventoryPlugin.count
+select count(*) as count from inventory
+
+-- plugins/inventory/inventory.go InventoryPlugin.exists
+select count(*) as count from inventory where item=?
+
+-- plugins/inventory/inventory.go InventoryPlugin.getAll
+select item from inventory
+
+-- plugins/inventory/inventory.go InventoryPlugin.random
+select item from inventory order by
+
+-- plugins/inventory/inventory.go InventoryPlugin.remove
+delete from inventory where item=?
+
+-- plugins/inventory/inventory.go InventoryPlugin.removeRandom
+select item from inventory order by
+
+-- plugins/inventory/inventory.go InventoryPlugin.removeRandom #2
+delete from inventory where item=?
+
+-- plugins/inventory/inventory.go New
+create table if not exists inventory (
+	item varchar(255) primary key
+);
+
+-- plugins/remember/remember.go RememberPlugin.randQuote
+select * from factoid where fact like '%quotes'
+		order by
+
+-- plugins/reminder/reminder.go ReminderPlugin.addReminder
+insert into reminders (fromWho, toWho, what, remindWhen, channel) values (?, ?, ?, ?, ?);
+
+-- plugins/reminder/reminder.go ReminderPlugin.deleteReminder
+delete from reminders where id = ?;
+
+-- plugins/reminder/reminder.go ReminderPlugin.getNextReminder
+select id, fromWho, toWho, what, remindWhen, channel from reminders order by remindWhen asc limit 1;
+
+-- plugins/reminder/reminder.go ReminderPlugin.getRemindersFormatted
+select id, fromWho, toWho, what, remindWhen from reminders %s order by remindWhen asc limit %d;
+
+-- plugins/reminder/reminder.go ReminderPlugin.getRemindersFormatted #2
+select COUNT(*) from reminders %s;
+
+-- plugins/reminder/reminder.go ReminderPlugin.message
+select fromWho, toWho, what from reminders where id = ?;
+
+-- plugins/reminder/reminder.go init
+create table if not exists reminders (
+	id bigint primary key auto_increment,
+	fromWho text,
+	toWho text,
+	what text,
+	remindWhen text,
+	channel text
+);
+
+-- upsert config
+insert into config (`key`, value) values (?, ?) on duplicate key update value=values(value)
+
+-- upsert roles
+insert into roles (user_id, role) values (?, ?) on duplicate key update role=values(role)
+
+-- upsert factoid_alias
+insert into factoid_alias (fact, next) values (?, ?) on duplicate key update fact=fact
+
@@ -0,0 +1,709 @@
+-- migration babbler 1
+create table if not exists babblers (
+	id bigserial primary key,
+	babbler text
+);
+			create table if not exists babblerWords (
+	id bigserial primary key,
+	word text
+);
+			create table if not exists babblerNodes (
+	id bigserial primary key,
+	babblerId bigint,
+	wordId bigint,
+	root bigint,
+	rootFrequency bigint
+);
+			create table if not exists babblerArcs (
+	id bigserial primary key,
+	fromNodeId bigint,
+	toNodeId bigint,
+	frequency bigint
+);
+
+-- migration babbler 2
+create table babblerArcs_new (
+	id bigserial primary key,
+	fromNodeId bigint,
+	toNodeId bigint,
+	frequency bigint
+);
+			insert into babblerArcs_new (id, fromNodeId, toNodeId, frequency)
+				select id, fromNodeId, toNodeId, frequency from babblerArcs;
+			drop table babblerArcs;
+			alter table babblerArcs_new rename to babblerArcs;
+
+-- migration beers 1
+create table if not exists untappd (
+	id bigserial primary key,
+	untappdUser text,
+	channel text,
+	lastCheckin bigint,
+	chanNick text
+);
+
+-- migration counter 1
+create table if not exists counter (
+	id bigserial primary key,
+	nick text,
+	item text,
+	count bigint
+);
+			create table if not exists counter_alias (
+	id bigserial PRIMARY KEY,
+	item text NOT NULL UNIQUE,
+	points_to text NOT NULL
+);
+
+-- migration fact 1
+create table if not exists factoid (
+	id bigserial primary key,
+	fact text,
+	tidbit text,
+	verb text,
+	owner text,
+	created bigint,
+	accessed bigint,
+	count bigint
+);
+			create table if not exists factoid_alias (
+	fact text,
+	next text,
+				primary key (fact, next)
+			
+);
+
+-- migration fact 2
+create table if not exists factoid_history (
+	id bigserial primary key,
+	fact_id bigint,
+	fact text,
+	tidbit text,
+	verb text,
+	owner text,
+	created bigint,
+	count bigint,
+	action text,
+	changed_by text,
+	changed bigint
+);
+
+-- migration fact 3
+alter table factoid_history add column channel text;
+
+-- migration first 1
+create table if not exists first (
+	id bigserial primary key,
+	day bigint,
+	time bigint,
+	body text,
+	nick text
+);
+
+-- migration msglog 1
+create table if not exists msglog (
+	id bigserial primary key,
+	channel text,
+	user_id text,
+	user_name text,
+	body text,
+	raw text,
+	command bigint,
+	action bigint,
+	time bigint,
+	host text
+);
+			create index if not exists msglog_channel_time on msglog (channel, time);
+
+-- migration msglog 2
+alter table msglog add column msg_id text;
+			alter table msglog add column thread_id text;
+			alter table msglog add column parent_id text;
+
+-- migration reminder 1
+create table if not exists reminders (
+	id bigserial primary key,
+	fromWho text,
+	toWho text,
+	what text,
+	remindWhen text,
+	channel text
+);
+
+-- bot/audit/audit.go Migrate
+create table if not exists audit (
+	id bigserial primary key,
+	time bigint,
+	user_id text,
+	nick text,
+	channel text,
+	plugin text,
+	action text,
+	target text,
+	before text,
+	after text
+);
+
+-- bot/audit/audit.go Recent
+select id, time, user_id, nick, channel, plugin, action, target, before, after
+		from audit
+
+-- bot/audit/audit.go Record
+insert into audit
+		(time, user_id, nick, channel, plugin, action, target, before, after)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+
+-- bot/bot.go bot.migrateDB
+create table if not exists variables (
+	id bigserial primary key,
+	name text,
+	value text
+);
+
+-- bot/handlers.go bot.getVar
+select value from variables where name=$1 order by
+
+-- bot/handlers.go bot.listVars
+select name from variables group by name
+
+-- bot/migrate/migrate.go Version
+select coalesce(max(version), 0) from schema_migrations where plugin=$1
+
+-- bot/migrate/migrate.go apply
+insert into schema_migrations (plugin, version, description, applied)
+		values ($1, $2, $3, $4)
+
+-- bot/migrate/migrate.go migrateSelf
+create table if not exists schema_migrations (
+	plugin text,
+	version bigint,
+	description text,
+	applied bigint,
+			primary key (plugin, version)
+		
+);
+
+-- bot/mock.go NewMockBot
+delete from msglog
+
+-- bot/mock.go NewMockBot #2
+delete from roles
+
+-- bot/mock.go NewMockBot #3
+delete from audit
+
+-- bot/msglog/msglog.go Store.Add
+insert into msglog
+		(channel, user_id, user_name, body, raw, command, action, time, host, msg_id, thread_id, parent_id)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+
+-- bot/msglog/msglog.go Store.Find
+select id, channel, user_id, user_name, body, raw, command, action, time, host,
+		coalesce(msg_id, ''), coalesce(thread_id, ''), coalesce(parent_id, '')
+		from msglog where
+
+-- bot/msglog/msglog.go Store.Prune
+delete from msglog where time < $1
+
+-- bot/msglog/msglog.go Store.Prune #2
+delete from msglog where id <= (
+				select id from msglog order by id desc limit 1 offset $1)
+
+-- bot/msglog/msglog.go init
+create table if not exists msglog (
+	id bigserial primary key,
+	channel text,
+	user_id text,
+	user_name text,
+	body text,
+	raw text,
+	command bigint,
+	action bigint,
+	time bigint,
+	host text
+);
+			create index if not exists msglog_channel_time on msglog (channel, time);
+
+-- bot/msglog/msglog.go init #2
+alter table msglog add column msg_id text;
+			alter table msglog add column thread_id text;
+			alter table msglog add column parent_id text;
+
+-- bot/roles.go lookupRole
+select role from roles where user_id=$1
+
+-- bot/roles.go migrateRoles
+create table if not exists roles (
+	user_id text primary key,
+	role text
+);
+
+-- bot/roles.go storeRole
+delete from roles where user_id=$1
+
+-- config/config.go Config.Set
+select value from config where key=$1
+
+-- config/config.go Config.find
+select value from config where key=$1
+
+-- config/config.go Open
+create table if not exists config (
+	key text,
+	value text,
+		primary key (key)
+	
+);
+
+-- config/dialect.go Dialect.Upsert
+insert into %s (%s) values (%s)
+
+-- config/file.go Config.Export
+select key, value from config order by key
+
+-- plugins/admin/admin.go AdminPlugin.handleVariables
+delete from variables where name=$1 and value=$2
+
+-- plugins/admin/admin.go AdminPlugin.handleVariables #2
+select count(*) from variables where value = $1
+
+-- plugins/admin/admin.go AdminPlugin.handleVariables #3
+INSERT INTO variables (name, value) VALUES ($1, $2)
+
+-- plugins/babbler/babbler.go BabblerPlugin.babbleSeedBookends
+select * from babblerWords where id = $1 LIMIT 1;
+
+-- plugins/babbler/babbler.go BabblerPlugin.createBabblerNode
+insert into babblerNodes (babblerId, wordId, root, rootFrequency) values ($1, $2, 0, 0)
+
+-- plugins/babbler/babbler.go BabblerPlugin.createNewWord
+insert into babblerWords (word) values ($1);
+
+-- plugins/babbler/babbler.go BabblerPlugin.getBabbler
+select * from babblers where babbler = $1 LIMIT 1;
+
+-- plugins/babbler/babbler.go BabblerPlugin.getBabblerArc
+select * from babblerArcs where fromNodeId = $1 and toNodeId = $2;
+
+-- plugins/babbler/babbler.go BabblerPlugin.getBabblerNode
+select * from babblerNodes where babblerId = $1 and wordId = $2 LIMIT 1;
+
+-- plugins/babbler/babbler.go BabblerPlugin.getBabblerNodeById
+select * from babblerNodes where id = $1 LIMIT 1;
+
+-- plugins/babbler/babbler.go BabblerPlugin.getNextArcs
+select * from babblerArcs where fromNodeId = $1;
+
+-- plugins/babbler/babbler.go BabblerPlugin.getOrCreateBabbler
+select tidbit from factoid where fact like '%s quotes';
+
+-- plugins/babbler/babbler.go BabblerPlugin.getWeightedNextWord
+select * from babblerArcs where fromNodeId = $1;
+
+-- plugins/babbler/babbler.go BabblerPlugin.getWeightedNextWord #2
+select * from babblerNodes where id = $1 LIMIT 1;
+
+-- plugins/babbler/babbler.go BabblerPlugin.getWeightedNextWord #3
+select * from babblerWords where id = $1 LIMIT 1;
+
+-- plugins/babbler/babbler.go BabblerPlugin.getWeightedPreviousWord
+select * from babblerArcs where toNodeId = $1;
+
+-- plugins/babbler/babbler.go BabblerPlugin.getWeightedPreviousWord #2
+select * from babblerNodes where id = $1 LIMIT 1;
+
+-- plugins/babbler/babbler.go BabblerPlugin.getWeightedPreviousWord #3
+select * from babblerWords where id = $1 LIMIT 1;
+
+-- plugins/babbler/babbler.go BabblerPlugin.getWeightedRootNode
+select * from babblerNodes where babblerId = $1 and root = 1;
+
+-- plugins/babbler/babbler.go BabblerPlugin.getWeightedRootNode #2
+select * from babblerWords where id = $1 LIMIT 1;
+
+-- plugins/babbler/babbler.go BabblerPlugin.getWord
+select * from babblerWords where word = $1 LIMIT 1;
+
+-- plugins/babbler/babbler.go BabblerPlugin.incrementRootWordFrequency
+update babblerNodes set rootFrequency = rootFrequency + 1, root = 1 where id = $1;
+
+-- plugins/babbler/babbler.go BabblerPlugin.incrementWordArc
+update babblerArcs set frequency = frequency + 1 where fromNodeId = $1 and toNodeId = $2;
+
+-- plugins/babbler/babbler.go BabblerPlugin.incrementWordArc #2
+insert into babblerArcs (fromNodeId, toNodeId, frequency) values ($1, $2, 1);
+
+-- plugins/babbler/babbler.go BabblerPlugin.makeBabbler
+insert into babblers (babbler) values ($1);
+
+-- plugins/babbler/babbler.go BabblerPlugin.mergeBabblers
+select * from babblerNodes where babblerId = $1;
+
+-- plugins/babbler/babbler.go BabblerPlugin.mergeBabblers #2
+update babblerNodes set rootFrequency = rootFrequency + $1, root = 1 where babblerId = $2 and wordId = $3;
+
+-- plugins/babbler/babbler.go BabblerPlugin.mergeBabblers #3
+update babblerNodes set rootFrequency = rootFrequency + $1 where babblerId = $2 and wordId = $3;
+
+-- plugins/babbler/babbler.go BabblerPlugin.mergeBabblers #4
+insert into babblerNodes (babblerId, wordId, root, rootFrequency) values ($1,$2,$3,$4) ;
+
+-- plugins/babbler/babbler.go BabblerPlugin.mergeBabblers #5
+select * from babblerNodes where babblerId = $1 and wordId = $2 LIMIT 1;
+
+-- plugins/babbler/babbler.go BabblerPlugin.mergeBabblers #6
+select * from babblerArcs where fromNodeId = $1;
+
+-- plugins/babbler/babbler.go init
+create table if not exists babblers (
+	id bigserial primary key,
+	babbler text
+);
+			create table if not exists babblerWords (
+	id bigserial primary key,
+	word text
+);
+			create table if not exists babblerNodes (
+	id bigserial primary key,
+	babblerId bigint,
+	wordId bigint,
+	root bigint,
+	rootFrequency bigint
+);
+			create table if not exists babblerArcs (
+	id bigserial primary key,
+	fromNodeId bigint,
+	toNodeId bigint,
+	frequency bigint
+);
+
+-- plugins/babbler/babbler.go init #2
+create table babblerArcs_new (
+	id bigserial primary key,
+	fromNodeId bigint,
+	toNodeId bigint,
+	frequency bigint
+);
+			insert into babblerArcs_new (id, fromNodeId, toNodeId, frequency)
+				select id, fromNodeId, toNodeId, frequency from babblerArcs;
+			drop table babblerArcs;
+			alter table babblerArcs_new rename to babblerArcs;
+
+-- plugins/beers/beers.go BeersPlugin.checkUntappd
+select id, untappdUser, channel, lastCheckin, chanNick from untappd;
+
+-- plugins/beers/beers.go BeersPlugin.checkUntappd #2
+update untappd set
+			lastCheckin = $1
+		where id = $2
+
+-- plugins/beers/beers.go BeersPlugin.doIKnow
+select count(*) from beers where nick = $1
+
+-- plugins/beers/beers.go BeersPlugin.message
+select count(*) from untappd
+			where untappdUser = $1
+
+-- plugins/beers/beers.go BeersPlugin.message #2
+insert into untappd (
+			untappdUser,
+			channel,
+			lastCheckin,
+			chanNick
+		) values ($1, $2, $3, $4);
+
+-- plugins/beers/beers.go init
+create table if not exists untappd (
+	id bigserial primary key,
+	untappdUser text,
+	channel text,
+	lastCheckin bigint,
+	chanNick text
+);
+
+-- plugins/counter/counter.go GetItem
+select * from counter_alias where item=$1
+
+-- plugins/counter/counter.go GetItem #2
+select * from counter where nick = $1 and item= $2
+
+-- plugins/counter/counter.go GetItems
+select * from counter where nick = $1
+
+-- plugins/counter/counter.go Item.Create
+insert into counter (nick, item, count) values ($1, $2, $3);
+
+-- plugins/counter/counter.go Item.Delete
+delete from counter where id = $1
+
+-- plugins/counter/counter.go Item.Update
+update counter set count = $1 where id = $2
+
+-- plugins/counter/counter.go Leader
+select * from counter where item=$1 order by count desc
+
+-- plugins/counter/counter.go LeaderAll
+select id,item,nick,max(count) as count from counter group by item having count(nick) > 1 and max(count) > 1 order by count desc
+
+-- plugins/counter/counter.go MkAlias
+insert into counter_alias (item, points_to) values ($1, $2)
+
+-- plugins/counter/counter.go MkAlias #2
+update counter_alias set points_to=$1 where item=$2
+
+-- plugins/counter/counter.go MkAlias #3
+select * from counter_alias where item=$1
+
+-- plugins/counter/counter.go init
+create table if not exists counter (
+	id bigserial primary key,
+	nick text,
+	item text,
+	count bigint
+);
+			create table if not exists counter_alias (
+	id bigserial PRIMARY KEY,
+	item text NOT NULL UNIQUE,
+	points_to text NOT NULL
+);
+
+-- plugins/fact/factoid.go Factoid.Save
+update factoid set
+			fact=$1,
+			tidbit=$2,
+			verb=$3,
+			owner=$4,
+			accessed=$5,
+			count=$6
+		where id=$7
+
+-- plugins/fact/factoid.go Factoid.Save #2
+insert into factoid (
+			fact,
+			tidbit,
+			verb,
+			owner,
+			created,
+			accessed,
+			count
+		) values ($1, $2, $3, $4, $5, $6, $7);
+
+-- plugins/fact/factoid.go Factoid.delete
+delete from factoid where id=$1
+
+-- plugins/fact/factoid.go FactoidPlugin.learnFact
+select count(*) from factoid
+		where fact=$1 and verb=$2 and tidbit=$3
+
+-- plugins/fact/factoid.go GetSingle
+select
+			id,
+			fact,
+			tidbit,
+			verb,
+			owner,
+			created,
+			accessed,
+			count
+		from factoid
+		order by
+
+-- plugins/fact/factoid.go GetSingleFact
+select
+			id,
+			fact,
+			tidbit,
+			verb,
+			owner,
+			created,
+			accessed,
+			count
+		from factoid
+		where fact like $1
+		order by
+
+-- plugins/fact/factoid.go alias.resolve
+select fact, next from factoid_alias where fact=$1
+
+-- plugins/fact/factoid.go alias.save
+select * from factoid_alias where fact=$1
+
+-- plugins/fact/factoid.go findAlias
+select * from factoid_alias where fact=$1
+
+-- plugins/fact/factoid.go getFactByID
+select
+			id,
+			fact,
+			tidbit,
+			verb,
+			owner,
+			created,
+			accessed,
+			count
+		from factoid
+		where id=$1;
+
+-- plugins/fact/factoid.go getFacts
+select
+			id,
+			fact,
+			tidbit,
+			verb,
+			owner,
+			created,
+			accessed,
+			count
+		from factoid
+		where fact like $1
+		and tidbit like $2;
+
+-- plugins/fact/revisions.go factHistory
+select id, fact_id, fact, tidbit, verb, owner, created, count, action, changed_by, changed from factoid_history
+		where fact=$1 or fact_id in (select id from factoid where fact=$2)
+		order by id desc limit $3
+
+-- plugins/fact/revisions.go getRevision
+select id, fact_id, fact, tidbit, verb, owner, created, count, action, changed_by, changed from factoid_history where id=$1
+
+-- plugins/fact/revisions.go init
+create table if not exists factoid (
+	id bigserial primary key,
+	fact text,
+	tidbit text,
+	verb text,
+	owner text,
+	created bigint,
+	accessed bigint,
+	count bigint
+);
+			create table if not exists factoid_alias (
+	fact text,
+	next text,
+				primary key (fact, next)
+			
+);
+
+-- plugins/fact/revisions.go init #2
+create table if not exists factoid_history (
+	id bigserial primary key,
+	fact_id bigint,
+	fact text,
+	tidbit text,
+	verb text,
+	owner text,
+	created bigint,
+	count bigint,
+	action text,
+	changed_by text,
+	changed bigint
+);
+
+-- plugins/fact/revisions.go init #3
+alter table factoid_history add column channel text;
+
+-- plugins/fact/revisions.go lastRevision
+select id, fact_id, fact, tidbit, verb, owner, created, count, action, changed_by, changed from factoid_history
+		where channel=$1 order by id desc limit 1
+
+-- plugins/fact/revisions.go revision.delete
+delete from factoid_history where id=$1
+
+-- plugins/fact/revisions.go revision.restore
+insert into factoid
+			(id, fact, tidbit, verb, owner, created, accessed, count)
+			values ($1, $2, $3, $4, $5, $6, $7, $8)
+
+-- plugins/fact/revisions.go saveRevision
+insert into factoid_history
+		(fact_id, fact, tidbit, verb, owner, created, count, action, changed_by, changed, channel)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+
+-- plugins/first/first.go FirstEntry.save
+insert into first (day, time, body, nick)
+		values ($1, $2, $3, $4)
+
+-- plugins/first/first.go getLastFirst
+select
+		id, max(day), time, body, nick from first
+		limit 1;
+
+-- plugins/first/first.go init
+create table if not exists first (
+	id bigserial primary key,
+	day bigint,
+	time bigint,
+	body text,
+	nick text
+);
+
+-- plugins/inventory/inventory.go InventoryPlugin.addItem
+INSERT INTO inventory (item) values ($1)
+
+-- plugins/inventory/inventory.go InventoryPlugin.count
+select count(*) as count from inventory
+
+-- plugins/inventory/inventory.go InventoryPlugin.exists
+select count(*) as count from inventory where item=$1
+
+-- plugins/inventory/inventory.go InventoryPlugin.getAll
+select item from inventory
+
+-- plugins/inventory/inventory.go InventoryPlugin.random
+select item from inventory order by
+
+-- plugins/inventory/inventory.go InventoryPlugin.remove
+delete from inventory where item=$1
+
+-- plugins/inventory/inventory.go InventoryPlugin.removeRandom
+select item from inventory order by
+
+-- plugins/inventory/inventory.go InventoryPlugin.removeRandom #2
+delete from inventory where item=$1
+
+-- plugins/inventory/inventory.go New
+create table if not exists inventory (
+	item text primary key
+);
+
+-- plugins/remember/remember.go RememberPlugin.randQuote
+select * from factoid where fact like '%quotes'
+		order by
+
+-- plugins/reminder/reminder.go ReminderPlugin.addReminder
+insert into reminders (fromWho, toWho, what, remindWhen, channel) values ($1, $2, $3, $4, $5);
+
+-- plugins/reminder/reminder.go ReminderPlugin.deleteReminder
+delete from reminders where id = $1;
+
+-- plugins/reminder/reminder.go ReminderPlugin.getNextReminder
+select id, fromWho, toWho, what, remindWhen, channel from reminders order by remindWhen asc limit 1;
+
+-- plugins/reminder/reminder.go ReminderPlugin.getRemindersFormatted
+select id, fromWho, toWho, what, remindWhen from reminders %s order by remindWhen asc limit %d;
+
+-- plugins/reminder/reminder.go ReminderPlugin.getRemindersFormatted #2
+select COUNT(*) from reminders %s;
+
+-- plugins/reminder/reminder.go ReminderPlugin.message
+select fromWho, toWho, what from reminders where id = $1;
+
+-- plugins/reminder/reminder.go init
+create table if not exists reminders (
+	id bigserial primary key,
+	fromWho text,
+	toWho text,
+	what text,
+	remindWhen text,
+	channel text
+);
+
+-- upsert config
+insert into config (key, value) values ($1, $2) on conflict(key) do update set value=excluded.value
+
+-- upsert roles
+insert into roles (user_id, role) values ($1, $2) on conflict(user_id) do update set role=excluded.role
+
+-- upsert factoid_alias
+insert into factoid_alias (fact, next) values ($1, $2) on conflict(fact, next) do nothing
+
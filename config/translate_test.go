@@ -0,0 +1,217 @@
+package config_test
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/velour/catbase/bot/migrate"
+	"github.com/velour/catbase/config"
+)
+
+var update = flag.Bool("update", false, "rewrite testdata/translate from the current translations")
+
+// sqlRE spots string literals that are queries rather than chat text
+var sqlRE = regexp.MustCompile(`(?is)^\s*(select\s.*\sfrom\s|insert\s+(or\s+\w+\s+)?into\s|update\s+\w+\s+set\s|delete\s+from\s|(create|alter|drop)\s+(unique\s+)?(table|index)\s)`)
+
+type query struct {
+	name string
+	sql  string
+}
+
+// treeQueries gathers every migration, every query literal outside of tests
+// and every upsert the tree builds, so a change to Translate or a new query
+// shows up as a difference in testdata/translate
+func treeQueries(t *testing.T) []query {
+	qs := []query{}
+	for _, plugin := range migrate.Plugins() {
+		for _, m := range migrate.Registered(plugin) {
+			qs = append(qs, query{fmt.Sprintf("migration %s %d", plugin, m.Version), m.SQL})
+		}
+	}
+
+	literals := []query{}
+	err := filepath.Walk("..", func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != ".." && (strings.HasPrefix(info.Name(), ".") || info.Name() == "testdata") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+		rel, _ := filepath.Rel("..", path)
+		literals = append(literals, fileQueries(t, path, filepath.ToSlash(rel))...)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.SliceStable(literals, func(i, j int) bool { return literals[i].name < literals[j].name })
+	seen := map[string]int{}
+	for i, q := range literals {
+		seen[q.name]++
+		if n := seen[q.name]; n > 1 {
+			literals[i].name = fmt.Sprintf("%s #%d", q.name, n)
+		}
+	}
+	return append(qs, literals...)
+}
+
+func fileQueries(t *testing.T, path, rel string) []query {
+	f, err := parser.ParseFile(token.NewFileSet(), path, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	consts := map[string]string{}
+	for _, decl := range f.Decls {
+		if gen, ok := decl.(*ast.GenDecl); ok {
+			for _, spec := range gen.Specs {
+				vs, ok := spec.(*ast.ValueSpec)
+				if !ok || len(vs.Names) != len(vs.Values) {
+					continue
+				}
+				for i, name := range vs.Names {
+					if s, ok := stringExpr(vs.Values[i], nil); ok {
+						consts[name.Name] = s
+					}
+				}
+			}
+		}
+	}
+	qs := []query{}
+	for _, decl := range f.Decls {
+		name := rel
+		if fn, ok := decl.(*ast.FuncDecl); ok {
+			name += " " + fn.Name.Name
+			if fn.Recv != nil && len(fn.Recv.List) > 0 {
+				name = fmt.Sprintf("%s %s.%s", rel, recvName(fn.Recv.List[0].Type), fn.Name.Name)
+			}
+		}
+		ast.Inspect(decl, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.BasicLit, *ast.BinaryExpr:
+				s, ok := stringExpr(n.(ast.Expr), consts)
+				if !ok {
+					return true
+				}
+				if sqlRE.MatchString(s) {
+					qs = append(qs, query{name, s})
+				}
+				return false
+			}
+			return true
+		})
+	}
+	return qs
+}
+
+// stringExpr evaluates literals joined with +, taking string constants
+// declared in the same file from consts
+func stringExpr(e ast.Expr, consts map[string]string) (string, bool) {
+	switch e := e.(type) {
+	case *ast.BasicLit:
+		if e.Kind != token.STRING {
+			return "", false
+		}
+		s, err := strconv.Unquote(e.Value)
+		return s, err == nil
+	case *ast.Ident:
+		s, ok := consts[e.Name]
+		return s, ok
+	case *ast.ParenExpr:
+		return stringExpr(e.X, consts)
+	case *ast.BinaryExpr:
+		if e.Op != token.ADD {
+			return "", false
+		}
+		x, ok := stringExpr(e.X, consts)
+		if !ok {
+			return "", false
+		}
+		y, ok := stringExpr(e.Y, consts)
+		return x + y, ok
+	}
+	return "", false
+}
+
+func recvName(e ast.Expr) string {
+	switch e := e.(type) {
+	case *ast.StarExpr:
+		return recvName(e.X)
+	case *ast.Ident:
+		return e.Name
+	}
+	return "?"
+}
+
+func upserts(d config.Dialect) []query {
+	return []query{
+		{"upsert config", d.Upsert("config", []string{"key"}, "value")},
+		{"upsert roles", d.Upsert("roles", []string{"user_id"}, "role")},
+		{"upsert factoid_alias", d.Upsert("factoid_alias", []string{"fact", "next"})},
+	}
+}
+
+func TestTranslateTree(t *testing.T) {
+	qs := treeQueries(t)
+	assert.NotEmpty(t, qs)
+	for _, d := range []config.Dialect{config.Postgres, config.MySQL} {
+		t.Run(d.Name, func(t *testing.T) {
+			var golden strings.Builder
+			for _, q := range append(qs, upserts(d)...) {
+				out := d.Translate(q.sql)
+				checkTranslation(t, d, q.name, out)
+				fmt.Fprintf(&golden, "-- %s\n%s\n\n", q.name, strings.TrimSpace(out))
+			}
+			path := filepath.Join("testdata", "translate", d.Name+".sql")
+			if *update {
+				assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+				assert.NoError(t, os.WriteFile(path, []byte(golden.String()), 0644))
+				return
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("%s, run go test ./config -run TestTranslateTree -update", err)
+			}
+			assert.Equal(t, string(want), golden.String(),
+				"translations changed, check them and run go test ./config -run TestTranslateTree -update")
+		})
+	}
+}
+
+var (
+	sqliteTypeRE   = regexp.MustCompile(`(?i)\b\w+\s+(string|integer primary key autoincrement)\b`)
+	indexIfRE      = regexp.MustCompile(`(?i)create\s+(unique\s+)?index\s+if\s+not\s+exists`)
+	quotedRE       = regexp.MustCompile("'[^']*'|`[^`]*`")
+	mysqlKeyColRE  = regexp.MustCompile(`(?i)[(,]\s*key\b`)
+	postgresArgsRE = regexp.MustCompile(`\?`)
+)
+
+// checkTranslation asserts what each dialect can't run, whatever the query
+func checkTranslation(t *testing.T, d config.Dialect, name, out string) {
+	bare := quotedRE.ReplaceAllString(out, "''")
+	assert.NotRegexp(t, sqliteTypeRE, bare, name)
+	switch d {
+	case config.Postgres:
+		assert.NotRegexp(t, postgresArgsRE, bare, name)
+	case config.MySQL:
+		assert.NotRegexp(t, indexIfRE, bare, name)
+		assert.NotRegexp(t, mysqlKeyColRE, bare, name)
+	}
+}
@@ -0,0 +1,286 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+// Package cli connects the bot to a terminal or a local Unix socket so that
+// plugins can be exercised without a chat service.
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/velour/catbase/bot"
+	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/bot/user"
+	"github.com/velour/catbase/config"
+)
+
+type CLI struct {
+	config *config.Config
+
+	in  io.Reader
+	out io.Writer
+
+	// mu guards everything below
+	mu      sync.Mutex
+	nick    string
+	channel string
+	sent    int
+	seen    map[string]map[string]bool
+	writers map[io.Writer]bool
+
+	event bot.Callback
+}
+
+func init() {
+	config.Register(
+		config.Key{Name: "cli.nick", Description: "who you speak as, defaults to $USER"},
+		config.Key{Name: "cli.channel", Description: "channel you speak in, defaults to the first of channels"},
+		config.Key{Name: "cli.socket", Description: "Unix socket to accept sessions on instead of stdin"},
+	)
+}
+
+// New creates a connector reading from stdin and writing to stdout
+func New(c *config.Config) *CLI {
+	return NewIO(c, os.Stdin, os.Stdout)
+}
+
+// NewIO creates a connector for an arbitrary reader and writer
+func NewIO(c *config.Config, in io.Reader, out io.Writer) *CLI {
+	channel := "#cli"
+	if chs := bot.NetworkChannels(c, "cli"); len(chs) > 0 {
+		channel = chs[0]
+	}
+	nick := os.Getenv("USER")
+	if nick == "" {
+		nick = "user"
+	}
+	return &CLI{
+		config:  c,
+		in:      in,
+		out:     out,
+		nick:    c.Get("cli.nick", nick),
+		channel: c.Get("cli.channel", channel),
+		seen:    map[string]map[string]bool{},
+		writers: map[io.Writer]bool{out: true},
+	}
+}
+
+func (c *CLI) RegisterEvent(f bot.Callback) {
+	c.event = f
+}
+
+// Serve starts reading input in the background.
+// If cli.socket is set, sessions are accepted on that Unix socket instead of stdin.
+func (c *CLI) Serve() error {
+	if c.event == nil {
+		return fmt.Errorf("Missing an event handler")
+	}
+
+	if path := c.config.Get("cli.socket", ""); path != "" {
+		os.Remove(path)
+		l, err := net.Listen("unix", path)
+		if err != nil {
+			return err
+		}
+		log.Printf("Listening for CLI sessions on %s", path)
+		go c.accept(l)
+		return nil
+	}
+
+	go func() {
+		if err := c.serve(c.in, c.out); err != nil {
+			log.Println(err)
+		}
+		log.Println("Input closed, exiting.")
+		os.Exit(0)
+	}()
+	return nil
+}
+
+func (c *CLI) accept(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			log.Printf("CLI socket error: %s", err)
+			return
+		}
+		go func() {
+			defer conn.Close()
+			if err := c.serve(conn, conn); err != nil {
+				log.Println(err)
+			}
+		}()
+	}
+}
+
+// serve reads lines from r until EOF, writing any bot output to w as well
+func (c *CLI) serve(r io.Reader, w io.Writer) error {
+	c.mu.Lock()
+	c.writers[w] = true
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.writers, w)
+		c.mu.Unlock()
+	}()
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		c.handleLine(w, scanner.Text())
+	}
+	return scanner.Err()
+}
+
+// handleLine turns one line of input into a bot event.
+// Lines starting with / are local commands:
+//
+//	/nick <name>          change who you are speaking as
+//	/join <channel>       change the channel you are speaking in
+//	/me <action>          send an action
+//	/reply <id> <text>    reply to a message the bot sent
+func (c *CLI) handleLine(w io.Writer, line string) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return
+	}
+
+	var kind bot.Kind = bot.Message
+	action := false
+	var args []interface{}
+
+	if strings.HasPrefix(line, "/") {
+		parts := strings.SplitN(line, " ", 2)
+		rest := ""
+		if len(parts) == 2 {
+			rest = strings.TrimSpace(parts[1])
+		}
+		switch parts[0] {
+		case "/nick":
+			c.mu.Lock()
+			c.nick = rest
+			c.mu.Unlock()
+			fmt.Fprintf(w, "-- you are now %s\n", rest)
+			return
+		case "/join":
+			c.mu.Lock()
+			c.channel = rest
+			c.mu.Unlock()
+			fmt.Fprintf(w, "-- now talking in %s\n", rest)
+			return
+		case "/me":
+			action = true
+			line = rest
+		case "/reply":
+			replyParts := strings.SplitN(rest, " ", 2)
+			if len(replyParts) != 2 {
+				fmt.Fprintln(w, "-- usage: /reply <id> <text>")
+				return
+			}
+			kind = bot.Reply
+			args = append(args, replyParts[0])
+			line = replyParts[1]
+		default:
+			fmt.Fprintf(w, "-- unknown command %s\n", parts[0])
+			return
+		}
+	}
+
+	c.event(kind, c.buildMessage(line, action), args...)
+}
+
+func (c *CLI) buildMessage(text string, action bool) msg.Message {
+	c.mu.Lock()
+	nick, channel := c.nick, c.channel
+	if c.seen[channel] == nil {
+		c.seen[channel] = map[string]bool{}
+	}
+	c.seen[channel][nick] = true
+	c.mu.Unlock()
+
+	isCmd, body := false, text
+	if !action {
+		isCmd, body = bot.IsCmd(c.config, text)
+	}
+
+	return msg.Message{
+		User: &user.User{
+			ID:   nick,
+			Name: nick,
+		},
+		Channel: channel,
+		Body:    body,
+		Raw:     text,
+		Command: isCmd,
+		Action:  action,
+		Time:    time.Now(),
+		Host:    "localhost",
+	}
+}
+
+func (c *CLI) Send(kind bot.Kind, out bot.Outgoing) (string, error) {
+	nick := c.botNick()
+	switch kind {
+	case bot.Message:
+		return c.print(out.Channel, "<%s> %s", nick, out.Text)
+	case bot.Action:
+		return c.print(out.Channel, "* %s %s", nick, out.Text)
+	case bot.Reply:
+		return c.print(out.Channel, "<%s> (reply to %s) %s", nick, replyTarget(out), out.Text)
+	case bot.Reaction:
+		return c.print(out.Channel, "%s reacted :%s: to %s", nick, out.Reaction, replyTarget(out))
+	case bot.Edit:
+		return c.print(out.Channel, "<%s> (edit of %s) %s", nick, out.EditID, out.Text)
+	}
+	return "", fmt.Errorf("%w: cli cannot send %s", bot.ErrUnsupported, kind)
+}
+
+func replyTarget(out bot.Outgoing) string {
+	switch {
+	case out.ReplyTo != "":
+		return out.ReplyTo
+	case out.Target != nil:
+		return fmt.Sprintf("%q", out.Target.Body)
+	}
+	return "?"
+}
+
+// print writes a line of bot output to every session and returns its identifier
+func (c *CLI) print(channel, format string, args ...interface{}) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sent++
+	id := fmt.Sprintf("m-%d", c.sent)
+	line := fmt.Sprintf("%s [%s] %s\n", id, channel, fmt.Sprintf(format, args...))
+	for w := range c.writers {
+		if _, err := io.WriteString(w, line); err != nil {
+			return "", err
+		}
+	}
+	return id, nil
+}
+
+func (c *CLI) botNick() string {
+	return c.config.Get("Nick", "")
+}
+
+func (c *CLI) GetEmojiList() map[string]string {
+	return map[string]string{}
+}
+
+// Who lists everyone who has spoken in a channel, plus the bot
+func (c *CLI) Who(channel string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	names := []string{c.botNick()}
+	for n := range c.seen[channel] {
+		names = append(names, n)
+	}
+	return names
+}
@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/velour/catbase/bot"
+	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/config"
+)
+
+type event struct {
+	kind bot.Kind
+	msg  msg.Message
+	args []interface{}
+}
+
+func setup(t *testing.T, input string) (*CLI, *bytes.Buffer, *[]event) {
+	cfg := config.ReadConfig(":memory:")
+	cfg.Set("nick", "catbase")
+	cfg.Set("cli.nick", "tester")
+	cfg.Set("cli.channel", "#test")
+	out := &bytes.Buffer{}
+	c := NewIO(cfg, strings.NewReader(input), out)
+	events := []event{}
+	c.RegisterEvent(func(k bot.Kind, m msg.Message, args ...interface{}) bool {
+		events = append(events, event{k, m, args})
+		return true
+	})
+	return c, out, &events
+}
+
+func TestMessages(t *testing.T) {
+	c, out, events := setup(t, "hello there\n!count beers\n/me waves\n")
+	assert.Nil(t, c.serve(c.in, out))
+	assert.Len(t, *events, 3)
+
+	first := (*events)[0].msg
+	assert.Equal(t, "hello there", first.Body)
+	assert.Equal(t, "tester", first.User.Name)
+	assert.Equal(t, "#test", first.Channel)
+	assert.False(t, first.Command)
+
+	second := (*events)[1].msg
+	assert.Equal(t, "count beers", second.Body)
+	assert.True(t, second.Command)
+
+	third := (*events)[2].msg
+	assert.Equal(t, "waves", third.Body)
+	assert.True(t, third.Action)
+}
+
+func TestLocalCommands(t *testing.T) {
+	c, out, events := setup(t, "/nick other\n/join #elsewhere\nhi\n/reply m-1 yes\n")
+	assert.Nil(t, c.serve(c.in, out))
+	assert.Len(t, *events, 2)
+	assert.Equal(t, "other", (*events)[0].msg.User.Name)
+	assert.Equal(t, "#elsewhere", (*events)[0].msg.Channel)
+	assert.Equal(t, bot.Kind(bot.Reply), (*events)[1].kind)
+	assert.Equal(t, []interface{}{"m-1"}, (*events)[1].args)
+	assert.Contains(t, c.Who("#elsewhere"), "other")
+}
+
+func TestSend(t *testing.T) {
+	c, out, _ := setup(t, "")
+	id, err := c.Send(bot.Message, bot.Outgoing{Channel: "#test", Text: "hi"})
+	assert.Nil(t, err)
+	assert.Equal(t, "m-1", id)
+	c.Send(bot.Action, bot.Outgoing{Channel: "#test", Text: "dances"})
+	c.Send(bot.Reply, bot.Outgoing{Channel: "#test", Text: "yes", ReplyTo: id})
+	c.Send(bot.Reaction, bot.Outgoing{Channel: "#test", Reaction: "tada", Target: &msg.Message{Body: "party"}})
+	c.Send(bot.Edit, bot.Outgoing{Channel: "#test", Text: "hello", EditID: id})
+
+	expected := []string{
+		"m-1 [#test] <catbase> hi",
+		"m-2 [#test] * catbase dances",
+		"m-3 [#test] <catbase> (reply to m-1) yes",
+		"m-4 [#test] catbase reacted :tada: to \"party\"",
+		"m-5 [#test] <catbase> (edit of m-1) hello",
+	}
+	assert.Equal(t, strings.Join(expected, "\n")+"\n", out.String())
+}
@@ -0,0 +1,373 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+// Package discord connects the bot to Discord, listening on the gateway
+// websocket and sending through the REST API.
+package discord
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/velour/catbase/bot"
+	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/bot/user"
+	"github.com/velour/catbase/config"
+)
+
+// rawID is where the Discord message ID is kept in a msg.Message
+const rawID = "RAW_DISCORD_ID"
+
+type Discord struct {
+	config *config.Config
+
+	token string
+	// apiURL is the REST API base, tests point it at a fake
+	apiURL string
+	client *http.Client
+	// retry is how long to wait before reconnecting after the gateway drops
+	retry time.Duration
+
+	// mu guards everything below
+	mu     sync.Mutex
+	selfID string
+	// emoji maps custom emoji names to their image URLs, emojiIDs to their IDs
+	emoji    map[string]string
+	emojiIDs map[string]string
+	// guilds maps channel IDs to the guild they are in
+	guilds map[string]string
+
+	event bot.Callback
+}
+
+func init() {
+	config.Register(
+		config.Key{Name: "discord.token", Description: "bot token from the Discord developer portal", Secret: true},
+	)
+}
+
+func New(c *config.Config) *Discord {
+	token := c.Get("discord.token", "")
+	if token == "" {
+		log.Fatalf("No discord token found. Set DISCORDTOKEN env.")
+	}
+	return &Discord{
+		config:   c,
+		token:    token,
+		apiURL:   "https://discord.com/api/v10",
+		client:   &http.Client{Timeout: 30 * time.Second},
+		retry:    5 * time.Second,
+		emoji:    map[string]string{},
+		emojiIDs: map[string]string{},
+		guilds:   map[string]string{},
+	}
+}
+
+func (d *Discord) RegisterEvent(f bot.Callback) {
+	d.event = f
+}
+
+// Serve connects to the gateway in the background, reconnecting whenever it drops
+func (d *Discord) Serve() error {
+	if d.event == nil {
+		return fmt.Errorf("Missing an event handler")
+	}
+	go func() {
+		for {
+			if err := d.connect(); err != nil {
+				log.Printf("Discord gateway connection lost: %s", err)
+			}
+			time.Sleep(d.retry)
+		}
+	}()
+	return nil
+}
+
+// message is a Discord message object, with only the fields the bot uses
+type message struct {
+	ID        string `json:"id"`
+	ChannelID string `json:"channel_id"`
+	GuildID   string `json:"guild_id"`
+	Content   string `json:"content"`
+	Author    struct {
+		ID         string `json:"id"`
+		Username   string `json:"username"`
+		GlobalName string `json:"global_name"`
+	} `json:"author"`
+	Member *struct {
+		Nick string `json:"nick"`
+	} `json:"member"`
+	Mentions []struct {
+		ID         string `json:"id"`
+		Username   string `json:"username"`
+		GlobalName string `json:"global_name"`
+	} `json:"mentions"`
+	Timestamp        time.Time `json:"timestamp"`
+	MessageReference *struct {
+		MessageID string `json:"message_id"`
+	} `json:"message_reference"`
+}
+
+func (d *Discord) messageCreate(m message) {
+	d.mu.Lock()
+	self := d.selfID
+	if m.GuildID != "" {
+		d.guilds[m.ChannelID] = m.GuildID
+	}
+	d.mu.Unlock()
+
+	if m.Author.ID == self {
+		return
+	}
+	if m.MessageReference != nil && m.MessageReference.MessageID != "" {
+		d.event(bot.Reply, d.buildMessage(m, self), m.MessageReference.MessageID)
+		return
+	}
+	d.event(bot.Message, d.buildMessage(m, self))
+}
+
+var (
+	mentionRegex = regexp.MustCompile(`<@!?(\d+)>`)
+	emojiRegex   = regexp.MustCompile(`<a?:(\w+):\d+>`)
+)
+
+// fixText turns mentions and custom emoji into plain text. A message that
+// starts by mentioning the bot is addressed to it, like "nick: text".
+func (d *Discord) fixText(m message, self string) string {
+	text := strings.TrimSpace(m.Content)
+	for _, p := range []string{"<@" + self + ">", "<@!" + self + ">"} {
+		if self != "" && strings.HasPrefix(text, p) {
+			text = d.config.Get("Nick", "") + ":" + strings.TrimPrefix(text, p)
+		}
+	}
+	text = mentionRegex.ReplaceAllStringFunc(text, func(s string) string {
+		id := mentionRegex.FindStringSubmatch(s)[1]
+		for _, u := range m.Mentions {
+			if u.ID == id {
+				return "@" + displayName(u.GlobalName, u.Username)
+			}
+		}
+		return s
+	})
+	return emojiRegex.ReplaceAllString(text, ":$1:")
+}
+
+func displayName(names ...string) string {
+	for _, n := range names {
+		if n != "" {
+			return n
+		}
+	}
+	return ""
+}
+
+func (d *Discord) buildMessage(m message, self string) msg.Message {
+	text := d.fixText(m, self)
+
+	// the /me command in the Discord client sends the text in italics
+	isAction := len(text) > 2 && strings.HasPrefix(text, "_") && strings.HasSuffix(text, "_")
+	isCmd := false
+	if isAction {
+		text = text[1 : len(text)-1]
+	} else {
+		isCmd, text = bot.IsCmd(d.config, text)
+	}
+
+	nick := ""
+	if m.Member != nil {
+		nick = m.Member.Nick
+	}
+	parent := ""
+	if m.MessageReference != nil {
+		parent = m.MessageReference.MessageID
+	}
+
+	return msg.Message{
+		User: &user.User{
+			ID:   m.Author.ID,
+			Name: displayName(nick, m.Author.GlobalName, m.Author.Username),
+		},
+		Body:    text,
+		Raw:     m.Content,
+		Channel: m.ChannelID,
+		Command: isCmd,
+		Action:  isAction,
+		Time:    m.Timestamp,
+		AdditionalData: map[string]string{
+			rawID: m.ID,
+		},
+		// threads are channels of their own on Discord, so the channel
+		// already places answers in the thread
+		ID:       m.ID,
+		ParentID: parent,
+	}
+}
+
+func (d *Discord) Send(kind bot.Kind, out bot.Outgoing) (string, error) {
+	channel := out.Channel
+	// threads are channels of their own on Discord
+	if out.ThreadID != "" {
+		channel = out.ThreadID
+	}
+	switch kind {
+	case bot.Message:
+		return d.sendMessage(channel, out.Text, "")
+	case bot.Action:
+		return d.sendMessage(channel, "_"+out.Text+"_", "")
+	case bot.Reply:
+		ref := out.ReplyTo
+		if ref == "" && out.Target != nil {
+			ref = out.Target.AdditionalData[rawID]
+		}
+		if ref == "" {
+			return "", fmt.Errorf("Reply needs an identifier or message to reply to")
+		}
+		return d.sendMessage(channel, out.Text, ref)
+	case bot.Reaction:
+		if out.Target == nil {
+			return "", fmt.Errorf("Reaction needs a message to react to")
+		}
+		return "", d.react(channel, out.Target.AdditionalData[rawID], out.Reaction)
+	case bot.Edit:
+		return d.edit(channel, out.EditID, out.Text)
+	}
+	return "", fmt.Errorf("%w: Discord cannot send %s", bot.ErrUnsupported, kind)
+}
+
+type messageRef struct {
+	MessageID string `json:"message_id"`
+}
+
+func (d *Discord) sendMessage(channel, text, replyTo string) (string, error) {
+	log.Printf("Sending message to %s: %s", channel, text)
+	body := struct {
+		Content          string      `json:"content"`
+		MessageReference *messageRef `json:"message_reference,omitempty"`
+	}{Content: text}
+	if replyTo != "" {
+		body.MessageReference = &messageRef{replyTo}
+	}
+	var sent struct {
+		ID string `json:"id"`
+	}
+	err := d.rest("POST", "/channels/"+channel+"/messages", body, &sent)
+	return sent.ID, err
+}
+
+func (d *Discord) edit(channel, id, text string) (string, error) {
+	log.Printf("Editing in (%s) %s: %s", id, channel, text)
+	body := struct {
+		Content string `json:"content"`
+	}{text}
+	var sent struct {
+		ID string `json:"id"`
+	}
+	err := d.rest("PATCH", "/channels/"+channel+"/messages/"+id, body, &sent)
+	return sent.ID, err
+}
+
+// react adds a reaction, either a custom emoji of the guild by name or a
+// Unicode emoji
+func (d *Discord) react(channel, id, reaction string) error {
+	log.Printf("Reacting in %s: %s", channel, reaction)
+	name := strings.Trim(reaction, ":")
+	d.mu.Lock()
+	if emojiID, ok := d.emojiIDs[name]; ok {
+		name += ":" + emojiID
+	}
+	d.mu.Unlock()
+	return d.rest("PUT", "/channels/"+channel+"/messages/"+id+"/reactions/"+url.PathEscape(name)+"/@me", nil, nil)
+}
+
+// rest calls the REST API and decodes the response into out if it isn't nil.
+// A request that hits a rate limit is tried once more after the wait Discord asks for.
+func (d *Discord) rest(method, path string, body, out interface{}) error {
+	var buf []byte
+	if body != nil {
+		var err error
+		if buf, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	for try := 0; ; try++ {
+		req, err := http.NewRequest(method, d.apiURL+path, bytes.NewReader(buf))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bot "+d.token)
+		req.Header.Set("User-Agent", "DiscordBot (https://github.com/velour/catbase, 1)")
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		resp, err := d.client.Do(req)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode == http.StatusTooManyRequests && try == 0 {
+			var limit struct {
+				RetryAfter float64 `json:"retry_after"`
+			}
+			json.NewDecoder(resp.Body).Decode(&limit)
+			resp.Body.Close()
+			log.Printf("Discord rate limited %s %s, waiting %.2fs", method, path, limit.RetryAfter)
+			time.Sleep(time.Duration(limit.RetryAfter * float64(time.Second)))
+			continue
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+			return fmt.Errorf("discord %s %s: %s %s", method, path, resp.Status, msg)
+		}
+		if out == nil {
+			return nil
+		}
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+}
+
+func (d *Discord) GetEmojiList() map[string]string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	emoji := make(map[string]string, len(d.emoji))
+	for k, v := range d.emoji {
+		emoji[k] = v
+	}
+	return emoji
+}
+
+// Who lists the members of the guild a channel is in
+func (d *Discord) Who(channel string) []string {
+	d.mu.Lock()
+	guild := d.guilds[channel]
+	d.mu.Unlock()
+	if guild == "" {
+		log.Printf("Don't know which guild %s is in", channel)
+		return []string{d.config.Get("Nick", "")}
+	}
+
+	var members []struct {
+		Nick string `json:"nick"`
+		User struct {
+			Username   string `json:"username"`
+			GlobalName string `json:"global_name"`
+		} `json:"user"`
+	}
+	if err := d.rest("GET", "/guilds/"+guild+"/members?limit=1000", nil, &members); err != nil {
+		log.Println(err)
+		return []string{d.config.Get("Nick", "")}
+	}
+	names := []string{}
+	for _, m := range members {
+		names = append(names, displayName(m.Nick, m.User.GlobalName, m.User.Username))
+	}
+	return names
+}
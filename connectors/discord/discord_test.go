@@ -0,0 +1,230 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+package discord
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/velour/catbase/bot"
+	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/config"
+)
+
+// fake is a local stand in for Discord. Its gateway replays the frames in
+// testdata/gateway.jsonl and its REST API records what it is sent.
+type fake struct {
+	*httptest.Server
+	t *testing.T
+
+	mu        sync.Mutex
+	requests  []string
+	identify  identify
+	heartbeat bool
+	limited   bool
+}
+
+func newFake(t *testing.T) *fake {
+	f := &fake{t: t}
+	mux := http.NewServeMux()
+	f.Server = httptest.NewServer(mux)
+	mux.HandleFunc("/api/gateway/bot", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"url": "ws" + strings.TrimPrefix(f.URL, "http") + "/gateway",
+		})
+	})
+	mux.HandleFunc("/gateway", f.gateway)
+	mux.HandleFunc("/api/", f.rest)
+	return f
+}
+
+func (f *fake) gateway(w http.ResponseWriter, r *http.Request) {
+	t := f.t
+	assert.Equal(t, "10", r.URL.Query().Get("v"))
+	conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+
+	conn.WriteJSON(map[string]interface{}{"op": opHello, "d": map[string]int{"heartbeat_interval": 50}})
+	var p struct {
+		Op int      `json:"op"`
+		D  identify `json:"d"`
+	}
+	if !assert.NoError(t, conn.ReadJSON(&p)) || !assert.Equal(t, opIdentify, p.Op) {
+		return
+	}
+	f.mu.Lock()
+	f.identify = p.D
+	f.mu.Unlock()
+
+	frames, err := ioutil.ReadFile("testdata/gateway.jsonl")
+	assert.NoError(t, err)
+	for _, frame := range bytes.Split(bytes.TrimSpace(frames), []byte("\n")) {
+		assert.NoError(t, conn.WriteMessage(websocket.TextMessage, frame))
+	}
+
+	// wait for a heartbeat carrying the last sequence number before asking
+	// for a reconnect
+	var beat struct {
+		Op int   `json:"op"`
+		D  int64 `json:"d"`
+	}
+	if assert.NoError(t, conn.ReadJSON(&beat)) {
+		f.mu.Lock()
+		f.heartbeat = beat.Op == opHeartbeat && beat.D == 6
+		f.mu.Unlock()
+	}
+	conn.WriteJSON(map[string]int{"op": opHeartbeatAck})
+	conn.WriteJSON(map[string]int{"op": opReconnect})
+}
+
+func (f *fake) rest(w http.ResponseWriter, r *http.Request) {
+	assert.Equal(f.t, "Bot test-token", r.Header.Get("Authorization"))
+	body, _ := ioutil.ReadAll(r.Body)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.Method == "PUT" && !f.limited {
+		f.limited = true
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"message":"You are being rate limited.","retry_after":0.01,"global":false}`))
+		return
+	}
+	f.requests = append(f.requests, strings.TrimSpace(r.Method+" "+r.URL.RequestURI()+" "+string(body)))
+
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/api/guilds/"):
+		w.Write([]byte(`[{"user":{"id":"53908232506183680","username":"alice","global_name":"Alice"},"nick":"ally"},{"user":{"id":"53908099506183681","username":"bob"}}]`))
+	case r.Method == "PUT":
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Write([]byte(`{"id":"1100000000000000099"}`))
+	}
+}
+
+func newTestDiscord(f *fake) *Discord {
+	c := config.ReadConfig(":memory:")
+	c.Set("Nick", "catbase")
+	c.Set("discord.token", "test-token")
+	d := New(c)
+	d.apiURL = f.URL + "/api"
+	return d
+}
+
+type event struct {
+	kind bot.Kind
+	msg  msg.Message
+	args []interface{}
+}
+
+func TestGateway(t *testing.T) {
+	f := newFake(t)
+	defer f.Close()
+	d := newTestDiscord(f)
+	events := []event{}
+	d.RegisterEvent(func(kind bot.Kind, m msg.Message, args ...interface{}) bool {
+		events = append(events, event{kind, m, args})
+		return true
+	})
+
+	assert.NoError(t, d.connect(), "a reconnect request ends the connection cleanly")
+
+	assert.Equal(t, "test-token", f.identify.Token)
+	assert.NotZero(t, f.identify.Intents&(1<<15), "message content is asked for")
+	assert.True(t, f.heartbeat, "heartbeats carry the last sequence number")
+
+	if assert.Len(t, events, 3, "the bot's own message is skipped") {
+		m := events[0].msg
+		assert.Equal(t, bot.Kind(bot.Message), events[0].kind)
+		assert.Equal(t, "ally", m.User.Name)
+		assert.Equal(t, "53908232506183680", m.User.ID)
+		assert.Equal(t, "41771983423143940", m.Channel)
+		assert.True(t, m.Command, "mentioning the bot first addresses it")
+		assert.Equal(t, "remember @bob :partyparrot:", m.Body)
+		assert.Equal(t, "1100000000000000001", m.AdditionalData[rawID])
+		assert.Equal(t, "1100000000000000001", m.ID)
+		assert.Equal(t, time.Date(2026, 10, 17, 18, 0, 0, 0, time.UTC), m.Time.UTC())
+
+		assert.True(t, events[1].msg.Action)
+		assert.Equal(t, "waves", events[1].msg.Body)
+		assert.False(t, events[1].msg.Command)
+
+		assert.Equal(t, bot.Kind(bot.Reply), events[2].kind)
+		assert.Equal(t, []interface{}{"1100000000000000001"}, events[2].args)
+		assert.Equal(t, "1100000000000000001", events[2].msg.ParentID)
+	}
+
+	assert.Equal(t, map[string]string{
+		"catjam":      "https://cdn.discordapp.com/emojis/41771983429993937.gif",
+		"partyparrot": "https://cdn.discordapp.com/emojis/41771983429993938.png",
+	}, d.GetEmojiList())
+	assert.Equal(t, "41771983423143937", d.guilds["41771983423143950"], "threads belong to their guild")
+}
+
+func TestSend(t *testing.T) {
+	f := newFake(t)
+	defer f.Close()
+	d := newTestDiscord(f)
+	d.emojiIDs["partyparrot"] = "41771983429993938"
+	target := &msg.Message{AdditionalData: map[string]string{rawID: "1100000000000000001"}}
+
+	sends := []struct {
+		kind bot.Kind
+		out  bot.Outgoing
+	}{
+		{bot.Message, bot.Outgoing{Channel: "7", Text: "hi"}},
+		{bot.Message, bot.Outgoing{Channel: "7", Text: "in thread", ThreadID: "8"}},
+		{bot.Action, bot.Outgoing{Channel: "7", Text: "purrs"}},
+		{bot.Reply, bot.Outgoing{Channel: "7", Text: "yes", Target: target}},
+		{bot.Edit, bot.Outgoing{Channel: "7", Text: "fixed", EditID: "1100000000000000099"}},
+		{bot.Reaction, bot.Outgoing{Channel: "7", Reaction: ":partyparrot:", Target: target}},
+		{bot.Reaction, bot.Outgoing{Channel: "7", Reaction: "👍", Target: target}},
+	}
+	for _, s := range sends {
+		_, err := d.Send(s.kind, s.out)
+		assert.NoError(t, err, "%s", s.kind)
+	}
+	id, err := d.Send(bot.Message, bot.Outgoing{Channel: "7", Text: "id"})
+	assert.NoError(t, err)
+	assert.Equal(t, "1100000000000000099", id)
+
+	_, err = d.Send(bot.Reply, bot.Outgoing{Channel: "7", Text: "to nothing"})
+	assert.Error(t, err)
+	_, err = d.Send(bot.Help, bot.Outgoing{Channel: "7"})
+	assert.True(t, errors.Is(err, bot.ErrUnsupported))
+
+	assert.Equal(t, []string{
+		`POST /api/channels/7/messages {"content":"hi"}`,
+		`POST /api/channels/8/messages {"content":"in thread"}`,
+		`POST /api/channels/7/messages {"content":"_purrs_"}`,
+		`POST /api/channels/7/messages {"content":"yes","message_reference":{"message_id":"1100000000000000001"}}`,
+		`PATCH /api/channels/7/messages/1100000000000000099 {"content":"fixed"}`,
+		`PUT /api/channels/7/messages/1100000000000000001/reactions/partyparrot:41771983429993938/@me`,
+		`PUT /api/channels/7/messages/1100000000000000001/reactions/%F0%9F%91%8D/@me`,
+		`POST /api/channels/7/messages {"content":"id"}`,
+	}, f.requests, "the rate limited reaction is retried")
+}
+
+func TestWho(t *testing.T) {
+	f := newFake(t)
+	defer f.Close()
+	d := newTestDiscord(f)
+
+	assert.Equal(t, []string{"catbase"}, d.Who("41771983423143940"), "unknown channels only have the bot")
+	d.guilds["41771983423143940"] = "41771983423143937"
+	assert.Equal(t, []string{"ally", "bob"}, d.Who("41771983423143940"))
+	assert.Equal(t, "GET /api/guilds/41771983423143937/members?limit=1000", f.requests[0])
+}
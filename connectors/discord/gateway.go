@@ -0,0 +1,247 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+package discord
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Gateway opcodes, see https://discord.com/developers/docs/topics/opcodes-and-status-codes
+const (
+	opDispatch       = 0
+	opHeartbeat      = 1
+	opIdentify       = 2
+	opReconnect      = 7
+	opInvalidSession = 9
+	opHello          = 10
+	opHeartbeatAck   = 11
+)
+
+// intents are the events the bot asks for: guilds, members, emoji, guild
+// and direct messages, reactions and message content. Members and message
+// content have to be turned on for the application in the developer portal.
+const intents = 1<<0 | 1<<1 | 1<<3 | 1<<9 | 1<<10 | 1<<12 | 1<<15
+
+// payload is a frame received from the gateway
+type payload struct {
+	Op int             `json:"op"`
+	D  json.RawMessage `json:"d"`
+	S  *int64          `json:"s"`
+	T  string          `json:"t"`
+}
+
+type identify struct {
+	Token      string            `json:"token"`
+	Intents    int               `json:"intents"`
+	Properties map[string]string `json:"properties"`
+}
+
+// gateway is one connection to the gateway
+type gateway struct {
+	conn *websocket.Conn
+
+	// writeLock keeps heartbeats from interleaving with other frames
+	writeLock sync.Mutex
+	// seq is the last sequence number seen, 0 before any
+	seq int64
+	// acked is 1 when the last heartbeat has been acknowledged
+	acked int32
+}
+
+func (g *gateway) send(op int, d interface{}) error {
+	g.writeLock.Lock()
+	defer g.writeLock.Unlock()
+	return g.conn.WriteJSON(struct {
+		Op int         `json:"op"`
+		D  interface{} `json:"d"`
+	}{op, d})
+}
+
+func (g *gateway) heartbeat() error {
+	var seq interface{}
+	if s := atomic.LoadInt64(&g.seq); s != 0 {
+		seq = s
+	}
+	return g.send(opHeartbeat, seq)
+}
+
+// heartbeats beats every interval until done. A beat that was never
+// acknowledged means the connection is dead, so it is closed to make
+// the read loop give up.
+func (g *gateway) heartbeats(interval time.Duration, done <-chan struct{}) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-t.C:
+			if !atomic.CompareAndSwapInt32(&g.acked, 1, 0) {
+				log.Println("Discord heartbeat was not acknowledged, reconnecting")
+				g.conn.Close()
+				return
+			}
+			if err := g.heartbeat(); err != nil {
+				log.Printf("Discord heartbeat failed: %s", err)
+				return
+			}
+		}
+	}
+}
+
+// connect opens one gateway connection and handles events until Discord
+// asks for a reconnect or the connection breaks
+func (d *Discord) connect() error {
+	var gw struct {
+		URL string `json:"url"`
+	}
+	if err := d.rest("GET", "/gateway/bot", nil, &gw); err != nil {
+		return err
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(gw.URL+"?v=10&encoding=json", nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	g := &gateway{conn: conn, acked: 1}
+
+	var hello payload
+	if err := conn.ReadJSON(&hello); err != nil {
+		return err
+	}
+	if hello.Op != opHello {
+		return fmt.Errorf("expected hello from gateway, got op %d", hello.Op)
+	}
+	var h struct {
+		HeartbeatInterval int64 `json:"heartbeat_interval"`
+	}
+	if err := json.Unmarshal(hello.D, &h); err != nil {
+		return err
+	}
+
+	err = g.send(opIdentify, identify{
+		Token:   d.token,
+		Intents: intents,
+		Properties: map[string]string{
+			"os":      runtime.GOOS,
+			"browser": "catbase",
+			"device":  "catbase",
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go g.heartbeats(time.Duration(h.HeartbeatInterval)*time.Millisecond, done)
+
+	for {
+		var p payload
+		if err := conn.ReadJSON(&p); err != nil {
+			return err
+		}
+		if p.S != nil {
+			atomic.StoreInt64(&g.seq, *p.S)
+		}
+		switch p.Op {
+		case opDispatch:
+			d.dispatch(p.T, p.D)
+		case opHeartbeat:
+			if err := g.heartbeat(); err != nil {
+				return err
+			}
+		case opHeartbeatAck:
+			atomic.StoreInt32(&g.acked, 1)
+		case opReconnect:
+			log.Println("Discord asked for a reconnect")
+			return nil
+		case opInvalidSession:
+			return fmt.Errorf("invalid session")
+		}
+	}
+}
+
+type emoji struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Animated bool   `json:"animated"`
+}
+
+// dispatch handles the events the bot cares about
+func (d *Discord) dispatch(event string, data json.RawMessage) {
+	switch event {
+	case "READY":
+		var r struct {
+			User struct {
+				ID string `json:"id"`
+			} `json:"user"`
+		}
+		if err := json.Unmarshal(data, &r); err != nil {
+			log.Printf("Bad READY from discord: %s", err)
+			return
+		}
+		d.mu.Lock()
+		d.selfID = r.User.ID
+		d.mu.Unlock()
+		log.Println("Connected to discord")
+	case "GUILD_CREATE":
+		var g struct {
+			ID       string  `json:"id"`
+			Emojis   []emoji `json:"emojis"`
+			Channels []struct {
+				ID string `json:"id"`
+			} `json:"channels"`
+			Threads []struct {
+				ID string `json:"id"`
+			} `json:"threads"`
+		}
+		if err := json.Unmarshal(data, &g); err != nil {
+			log.Printf("Bad GUILD_CREATE from discord: %s", err)
+			return
+		}
+		d.mu.Lock()
+		for _, c := range append(g.Channels, g.Threads...) {
+			d.guilds[c.ID] = g.ID
+		}
+		d.mu.Unlock()
+		d.addEmoji(g.Emojis)
+	case "GUILD_EMOJIS_UPDATE":
+		var u struct {
+			Emojis []emoji `json:"emojis"`
+		}
+		if err := json.Unmarshal(data, &u); err != nil {
+			log.Printf("Bad GUILD_EMOJIS_UPDATE from discord: %s", err)
+			return
+		}
+		d.addEmoji(u.Emojis)
+	case "MESSAGE_CREATE":
+		var m message
+		if err := json.Unmarshal(data, &m); err != nil {
+			log.Printf("Bad MESSAGE_CREATE from discord: %s", err)
+			return
+		}
+		d.messageCreate(m)
+	}
+}
+
+func (d *Discord) addEmoji(emojis []emoji) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, e := range emojis {
+		ext := ".png"
+		if e.Animated {
+			ext = ".gif"
+		}
+		d.emoji[e.Name] = "https://cdn.discordapp.com/emojis/" + e.ID + ext
+		d.emojiIDs[e.Name] = e.ID
+	}
+}
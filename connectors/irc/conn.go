@@ -0,0 +1,168 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+package irc
+
+import (
+	"bufio"
+	"encoding/base64"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/velour/velour/irc"
+)
+
+// conn is one connection to the server. It is used instead of irc.Client
+// because that registers as soon as it connects, before SASL can start.
+type conn struct {
+	net.Conn
+	in *bufio.Reader
+	// partial holds a line cut off by a read deadline
+	partial string
+
+	writeLock sync.Mutex
+}
+
+func newConn(c net.Conn) *conn {
+	return &conn{Conn: c, in: bufio.NewReader(c)}
+}
+
+// read returns the next message and its tags, waiting at most timeout for it
+func (c *conn) read(timeout time.Duration) (irc.Msg, tags, error) {
+	for {
+		c.SetReadDeadline(time.Now().Add(timeout))
+		line, err := c.in.ReadString('\n')
+		if err != nil {
+			c.partial += line
+			return irc.Msg{}, nil, err
+		}
+		line = strings.TrimRight(c.partial+line, "\r\n")
+		c.partial = ""
+		t, line := parseTags(line)
+		if line == "" {
+			continue
+		}
+		m, err := irc.ParseMsg(line)
+		return m, t, err
+	}
+}
+
+func (c *conn) send(m irc.Msg, t tags) error {
+	raw, err := m.RawString()
+	if err != nil {
+		return err
+	}
+	if len(t) > 0 {
+		raw = "@" + t.String() + " " + raw
+	}
+	return c.sendRaw(raw)
+}
+
+// sendRaw writes a line as it is, for commands whose last argument
+// shouldn't have a colon
+func (c *conn) sendRaw(line string) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	c.SetWriteDeadline(time.Now().Add(time.Minute))
+	_, err := c.Write([]byte(line + "\r\n"))
+	return err
+}
+
+// tags are IRCv3 message tags, see https://ircv3.net/specs/extensions/message-tags
+type tags map[string]string
+
+var tagEscapes = strings.NewReplacer(`\`, `\\`, ";", `\:`, " ", `\s`, "\r", `\r`, "\n", `\n`)
+
+// parseTags splits the tags off the front of a line
+func parseTags(line string) (tags, string) {
+	if !strings.HasPrefix(line, "@") {
+		return nil, line
+	}
+	raw, rest := line[1:], ""
+	if i := strings.IndexByte(raw, ' '); i >= 0 {
+		raw, rest = raw[:i], strings.TrimLeft(raw[i+1:], " ")
+	}
+	t := tags{}
+	for _, tag := range strings.Split(raw, ";") {
+		kv := strings.SplitN(tag, "=", 2)
+		if kv[0] == "" {
+			continue
+		}
+		t[kv[0]] = ""
+		if len(kv) == 2 {
+			t[kv[0]] = unescapeTag(kv[1])
+		}
+	}
+	return t, rest
+}
+
+func unescapeTag(v string) string {
+	out := strings.Builder{}
+	for i := 0; i < len(v); i++ {
+		if v[i] != '\\' {
+			out.WriteByte(v[i])
+			continue
+		}
+		if i++; i == len(v) {
+			break
+		}
+		switch v[i] {
+		case ':':
+			out.WriteByte(';')
+		case 's':
+			out.WriteByte(' ')
+		case 'r':
+			out.WriteByte('\r')
+		case 'n':
+			out.WriteByte('\n')
+		default:
+			out.WriteByte(v[i])
+		}
+	}
+	return out.String()
+}
+
+// String formats tags for the front of a line, in a stable order
+func (t tags) String() string {
+	keys := []string{}
+	for k := range t {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := []string{}
+	for _, k := range keys {
+		if t[k] == "" {
+			parts = append(parts, k)
+		} else {
+			parts = append(parts, k+"="+tagEscapes.Replace(t[k]))
+		}
+	}
+	return strings.Join(parts, ";")
+}
+
+// hasCap checks the capabilities from CAP LS, which may have values, for one
+func hasCap(caps []string, name string) bool {
+	for _, c := range caps {
+		if c == name || strings.HasPrefix(c, name+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+// saslPlain encodes PLAIN credentials in the 400 byte AUTHENTICATE chunks,
+// ending with a + when the last chunk is a full one
+func saslPlain(account, pass string) []string {
+	enc := base64.StdEncoding.EncodeToString([]byte(account + "\x00" + account + "\x00" + pass))
+	chunks := []string{}
+	for len(enc) >= 400 {
+		chunks = append(chunks, enc[:400])
+		enc = enc[400:]
+	}
+	if enc == "" {
+		enc = "+"
+	}
+	return append(chunks, enc)
+}
@@ -3,11 +3,14 @@
 package irc
 
 import (
+	"crypto/tls"
 	"fmt"
-	"io"
 	"log"
-	"os"
+	"net"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/velour/catbase/bot"
@@ -19,8 +22,8 @@ import (
 
 const (
 	// DefaultPort is the port used to connect to
-	// the server if one is not specified.
-	defaultPort = "6667"
+	// the server if one is not specified, the TLS port.
+	defaultPort = "6697"
 
 	// InitialTimeout is the initial amount of time
 	// to delay before reconnecting.  Each failed
@@ -28,26 +31,96 @@ const (
 	// a connection is made successfully.
 	initialTimeout = 2 * time.Second
 
+	// MaxTimeout is the longest delay between reconnections
+	maxTimeout = 5 * time.Minute
+
 	// PingTime is the amount of inactive time
 	// to wait before sending a ping to the server.
 	pingTime = 120 * time.Second
 
 	actionPrefix = "\x01ACTION"
+
+	// echoTimeout is how long to wait for the echo of a sent message
+	echoTimeout = 5 * time.Second
+
+	// rawID is where the msgid of a message is kept in a msg.Message
+	rawID = "RAW_IRC_MSGID"
 )
 
+// wantCaps are the capabilities asked for when the server has them.
+// Replies and reactions are client tags, so message-tags is all they need.
+var wantCaps = []string{"message-tags", "server-time", "echo-message"}
+
 var throttle <-chan time.Time
 
 type Irc struct {
-	Client *irc.Client
 	config *config.Config
-	quit   chan bool
+
+	// dial opens the connection to the server, tests replace it
+	dial func(addr string) (net.Conn, error)
+	// initialTimeout is the first delay before reconnecting, tests shorten it
+	initialTimeout time.Duration
+
+	// mu guards everything below
+	mu   sync.Mutex
+	conn *conn
+	// nick is what the server calls us, which may not be the configured Nick
+	nick string
+	// members holds the nicks in each channel we are in
+	members map[string]map[string]bool
+	// names collects RPL_NAMREPLY until RPL_ENDOFNAMES replaces members
+	names map[string]map[string]bool
+	// caps are the IRCv3 capabilities the server acknowledged
+	caps map[string]bool
+	// echoes wait for the server to echo our messages back with their msgid
+	echoes []*pendingEcho
+
+	// sendLock keeps echoes in the order messages are written
+	sendLock sync.Mutex
 
 	event bot.Callback
+	// queue holds events for runEvents, which calls event off the read
+	// loop so a plugin that sends while handling one doesn't stop us
+	// reading the echo it waits for
+	queueLock sync.Mutex
+	queue     []func()
+	queued    chan struct{}
+}
+
+// pendingEcho is a message we sent that the server hasn't echoed yet
+type pendingEcho struct {
+	target, text string
+	id           chan string
+}
+
+func init() {
+	config.Register(
+		config.Key{Name: "Irc.Server", Default: "localhost", Description: "server to connect to, with the port if it isn't " + defaultPort},
+		config.Key{Name: "Irc.Pass", Description: "server password", Secret: true},
+		config.Key{Name: "Irc.InsecureTLS", Type: config.Bool, Default: "false", Description: "skip checking the server's certificate, letting anyone in the middle read the passwords we send"},
+		config.Key{Name: "Irc.SASLUser", Description: "account to log in to with SASL PLAIN, defaults to Nick"},
+		config.Key{Name: "Irc.SASLPass", Description: "password for SASL, which is used when set", Secret: true},
+		config.Key{Name: "Irc.NickServPass", Description: "password to identify to NickServ with when SASL isn't used", Secret: true},
+		config.Key{Name: "RatePerSec", Type: config.Int, Default: "5", Description: "most messages sent each second"},
+	)
 }
 
 func New(c *config.Config) *Irc {
 	i := Irc{}
 	i.config = c
+	i.dial = func(addr string) (net.Conn, error) {
+		insecure, _ := strconv.ParseBool(c.Get("Irc.InsecureTLS", ""))
+		if insecure {
+			log.Printf("Not checking the certificate of %s", addr)
+		}
+		return tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: insecure})
+	}
+	i.initialTimeout = initialTimeout
+	i.members = map[string]map[string]bool{}
+	i.names = map[string]map[string]bool{}
+	i.caps = map[string]bool{}
+	i.queued = make(chan struct{}, 1)
+	go i.runEvents()
 
 	return &i
 }
@@ -56,25 +129,94 @@ func (i *Irc) RegisterEvent(f bot.Callback) {
 	i.event = f
 }
 
-func (i *Irc) Send(kind bot.Kind, args ...interface{}) (string, error) {
+func (i *Irc) Send(kind bot.Kind, out bot.Outgoing) (string, error) {
 	switch kind {
-	case bot.Reply:
 	case bot.Message:
-		return i.sendMessage(args[0].(string), args[1].(string))
+		return i.sendMessage(out.Channel, out.Text, nil)
 	case bot.Action:
-		return i.sendAction(args[0].(string), args[1].(string))
-	default:
+		return i.sendAction(out.Channel, out.Text)
+	case bot.Reply:
+		ref := out.ReplyTo
+		if ref == "" && out.Target != nil {
+			ref = out.Target.AdditionalData[rawID]
+		}
+		if ref != "" && i.hasCap("message-tags") {
+			return i.sendMessage(out.Channel, out.Text, tags{"+draft/reply": ref})
+		}
+		// without tags the best we can do is address whoever we answer
+		if out.Target != nil && out.Target.User != nil {
+			return i.sendMessage(out.Channel, out.Target.User.Name+": "+out.Text, nil)
+		}
+		return i.sendMessage(out.Channel, out.Text, nil)
+	case bot.Reaction:
+		if out.Target == nil || out.Target.AdditionalData[rawID] == "" || !i.hasCap("message-tags") {
+			break
+		}
+		// built raw, the channel is TAGMSG's only argument and can't take a colon
+		echo, err := i.sendTagged(irc.Msg{Cmd: "TAGMSG", Raw: "TAGMSG " + out.Channel}, tags{
+			"+draft/react": out.Reaction,
+			"+draft/reply": out.Target.AdditionalData[rawID],
+		})
+		if err != nil {
+			return "", err
+		}
+		return i.waitEcho(echo)
+	case bot.Edit:
+		// IRC messages can't be changed, so send a correction in reply to the original
+		if out.EditID != "" && i.hasCap("message-tags") {
+			return i.sendMessage(out.Channel, "* "+out.Text, tags{"+draft/reply": out.EditID})
+		}
+		return i.sendMessage(out.Channel, "* "+out.Text, nil)
 	}
-	return "", nil
+	return "", fmt.Errorf("%w: IRC cannot send %s", bot.ErrUnsupported, kind)
+}
+
+func (i *Irc) hasCap(name string) bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.caps[name]
 }
 
 func (i *Irc) JoinChannel(channel string) {
 	log.Printf("Joining channel: %s", channel)
-	i.Client.Out <- irc.Msg{Cmd: irc.JOIN, Args: []string{channel}}
+	if err := i.send(irc.Msg{Cmd: irc.JOIN, Args: []string{channel}}); err != nil {
+		log.Printf("Could not join %s: %s", channel, err)
+	}
 }
 
-func (i *Irc) sendMessage(channel, message string) (string, error) {
-	for len(message) > 0 {
+// send writes a message to the current connection
+func (i *Irc) send(m irc.Msg) error {
+	_, err := i.sendTagged(m, nil)
+	return err
+}
+
+// sendTagged writes a message with tags to the current connection. When the
+// server echoes messages the msgid of the echo is sent on the returned
+// pendingEcho, which is nil otherwise.
+func (i *Irc) sendTagged(m irc.Msg, t tags) (*pendingEcho, error) {
+	i.sendLock.Lock()
+	defer i.sendLock.Unlock()
+	i.mu.Lock()
+	c := i.conn
+	var echo *pendingEcho
+	if c != nil && i.caps["echo-message"] && (m.Cmd == irc.PRIVMSG || m.Cmd == irc.NOTICE || m.Cmd == "TAGMSG") {
+		target, text := echoKey(m)
+		echo = &pendingEcho{target: target, text: text, id: make(chan string, 1)}
+		i.echoes = append(i.echoes, echo)
+	}
+	i.mu.Unlock()
+	if c == nil {
+		return nil, fmt.Errorf("not connected")
+	}
+	return echo, c.send(m, t)
+}
+
+// sendMessage sends text to channel, split to fit in IRC messages with the
+// tags on each one. The identifier is the msgid the server gave the first
+// message, if it echoes them.
+func (i *Irc) sendMessage(channel, message string, t tags) (string, error) {
+	var first *pendingEcho
+	for n := 0; len(message) > 0; n++ {
 		m := irc.Msg{
 			Cmd:  "PRIVMSG",
 			Args: []string{channel, message},
@@ -89,22 +231,72 @@ func (i *Irc) sendMessage(channel, message string) (string, error) {
 		}
 
 		if throttle == nil {
-			ratePerSec := i.config.GetInt("RatePerSec", 5)
+			ratePerSec := i.config.GetInt("RatePerSec", 0)
 			throttle = time.Tick(time.Second / time.Duration(ratePerSec))
 		}
 
 		<-throttle
 
-		i.Client.Out <- m
+		echo, err := i.sendTagged(m, t)
+		if err != nil {
+			return "", err
+		}
+		if n == 0 {
+			first = echo
+		}
+	}
+	return i.waitEcho(first)
+}
+
+// waitEcho waits for the msgid of an echoed message
+func (i *Irc) waitEcho(echo *pendingEcho) (string, error) {
+	if echo == nil {
+		return "NO_IRC_IDENTIFIERS", nil
+	}
+	select {
+	case id, ok := <-echo.id:
+		if ok {
+			return id, nil
+		}
+	case <-time.After(echoTimeout):
+		log.Println("The server never echoed a message")
+		i.mu.Lock()
+		i.removeEcho(echo)
+		i.mu.Unlock()
 	}
 	return "NO_IRC_IDENTIFIERS", nil
 }
 
+// removeEcho stops waiting for an echo, i.mu must be held
+func (i *Irc) removeEcho(echo *pendingEcho) {
+	for n, e := range i.echoes {
+		if e == echo {
+			i.echoes = append(i.echoes[:n], i.echoes[n+1:]...)
+			return
+		}
+	}
+}
+
+// echoKey gives the target and text a message will be echoed with
+func echoKey(m irc.Msg) (string, string) {
+	args := m.Args
+	if len(args) == 0 && m.Raw != "" {
+		args = strings.Fields(m.Raw)[1:]
+	}
+	switch len(args) {
+	case 0:
+		return "", ""
+	case 1:
+		return args[0], ""
+	}
+	return args[0], args[1]
+}
+
 // Sends action to channel
 func (i *Irc) sendAction(channel, message string) (string, error) {
 	message = actionPrefix + " " + message + "\x01"
 
-	return i.sendMessage(channel, message)
+	return i.sendMessage(channel, message, nil)
 }
 
 func (i *Irc) GetEmojiList() map[string]string {
@@ -112,81 +304,233 @@ func (i *Irc) GetEmojiList() map[string]string {
 	return make(map[string]string)
 }
 
+// Serve connects in the background, reconnecting whenever the connection is lost
 func (i *Irc) Serve() error {
 	if i.event == nil {
 		return fmt.Errorf("Missing an event handler")
 	}
+	go i.run()
+	return nil
+}
 
-	var err error
-	i.Client, err = irc.DialSSL(
-		i.config.Get("Irc.Server", "localhost"),
-		i.config.Get("Nick", "bot"),
-		i.config.Get("FullName", "bot"),
-		i.config.Get("Irc.Pass", ""),
-		true,
-	)
-	if err != nil {
-		return fmt.Errorf("%s", err)
+// run keeps the bot connected, doubling the delay after each failed
+// connection up to maxTimeout
+func (i *Irc) run() {
+	timeout := i.initialTimeout
+	for {
+		registered, err := i.connect()
+		if err != nil {
+			log.Printf("IRC connection lost: %s", err)
+		}
+		if registered {
+			timeout = i.initialTimeout
+		}
+		log.Printf("Reconnecting to IRC in %s", timeout)
+		time.Sleep(timeout)
+		if timeout *= 2; timeout > maxTimeout {
+			timeout = maxTimeout
+		}
 	}
+}
 
-	for _, c := range i.config.GetArray("channels", []string{}) {
-		i.JoinChannel(c)
+// connect makes one connection and handles messages until it is lost,
+// reporting whether registration finished
+func (i *Irc) connect() (bool, error) {
+	addr := i.config.Get("Irc.Server", "")
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, defaultPort)
 	}
+	nc, err := i.dial(addr)
+	if err != nil {
+		return false, err
+	}
+	c := newConn(nc)
+	defer c.Close()
 
-	i.quit = make(chan bool)
-	go i.handleConnection()
-	<-i.quit
-	return nil
-}
-
-func (i *Irc) handleConnection() {
-	t := time.NewTimer(pingTime)
+	nick, caps, err := i.register(c)
+	if err != nil {
+		return false, err
+	}
 
+	i.mu.Lock()
+	i.conn = c
+	i.nick = nick
+	i.caps = caps
+	i.members = map[string]map[string]bool{}
+	i.names = map[string]map[string]bool{}
+	i.mu.Unlock()
 	defer func() {
-		t.Stop()
-		close(i.Client.Out)
-		for err := range i.Client.Errors {
-			if err != io.EOF {
-				log.Println(err)
-			}
+		i.mu.Lock()
+		i.conn = nil
+		// nothing will be echoed on this connection now
+		for _, echo := range i.echoes {
+			close(echo.id)
 		}
+		i.echoes = nil
+		i.mu.Unlock()
 	}()
 
+	if pass := i.config.Get("Irc.NickServPass", ""); pass != "" && i.config.Get("Irc.SASLPass", "") == "" {
+		i.send(irc.Msg{Cmd: irc.PRIVMSG, Args: []string{"NickServ", "IDENTIFY " + pass}})
+	}
+	for _, ch := range bot.NetworkChannels(i.config, "irc") {
+		i.JoinChannel(ch)
+	}
+
+	pinged := false
 	for {
-		select {
-		case msg, ok := <-i.Client.In:
-			if !ok { // disconnect
-				i.quit <- true
-				return
+		m, t, err := c.read(pingTime)
+		if err, ok := err.(net.Error); ok && err.Timeout() && !pinged {
+			pinged = true
+			c.send(irc.Msg{Cmd: irc.PING, Args: []string{addr}}, nil)
+			continue
+		}
+		if err != nil {
+			return true, err
+		}
+		pinged = false
+		i.handleMsg(m, t)
+	}
+}
+
+// register logs in, negotiating IRCv3 capabilities and authenticating with
+// SASL first if Irc.SASLPass is set. It returns the nick the server accepted
+// and the capabilities it acknowledged.
+func (i *Irc) register(c *conn) (string, map[string]bool, error) {
+	nick := i.config.Get("Nick", "")
+	saslPass := i.config.Get("Irc.SASLPass", "")
+	caps := map[string]bool{}
+	// offered collects the capabilities in CAP LS, which may take several lines
+	offered := []string{}
+
+	c.sendRaw("CAP LS 302")
+	if pass := i.config.Get("Irc.Pass", ""); pass != "" {
+		c.send(irc.Msg{Cmd: "PASS", Args: []string{pass}}, nil)
+	}
+	c.send(irc.Msg{Cmd: irc.NICK, Args: []string{nick}}, nil)
+	c.send(irc.Msg{Cmd: irc.USER, Args: []string{nick, "0", "*", i.config.Get("FullName", "")}}, nil)
+
+	for {
+		m, _, err := c.read(pingTime)
+		if err != nil {
+			return "", nil, err
+		}
+		// CAP <nick> <subcommand> [*] :<capabilities>
+		sub, list, more := "", "", false
+		if m.Cmd == "CAP" && len(m.Args) >= 3 {
+			sub, list = m.Args[1], m.Args[len(m.Args)-1]
+			more = len(m.Args) > 3 && m.Args[2] == "*"
+		}
+
+		switch {
+		case m.Cmd == irc.RPL_WELCOME:
+			if len(m.Args) > 0 {
+				nick = m.Args[0]
+			}
+			return nick, caps, nil
+		case m.Cmd == irc.PING:
+			c.send(irc.Msg{Cmd: irc.PONG, Args: m.Args}, nil)
+		case m.Cmd == irc.ERR_NICKNAMEINUSE, m.Cmd == irc.ERR_NICKCOLLISION, m.Cmd == irc.ERR_UNAVAILRESOURCE:
+			nick += "_"
+			log.Printf("Nick is taken, trying %s", nick)
+			c.send(irc.Msg{Cmd: irc.NICK, Args: []string{nick}}, nil)
+		case m.Cmd == irc.ERR_ERRONEUSNICKNAME, m.Cmd == irc.ERR_NONICKNAMEGIVEN, m.Cmd == irc.ERR_RESTRICTED,
+			m.Cmd == irc.ERR_PASSWDMISMATCH, m.Cmd == irc.ERR_YOUREBANNEDCREEP, m.Cmd == irc.ERROR:
+			return "", nil, fmt.Errorf("registration failed: %s", m.Raw)
+
+		case sub == "LS":
+			offered = append(offered, strings.Fields(list)...)
+			if more {
+				continue
+			}
+			req := []string{}
+			for _, want := range wantCaps {
+				if hasCap(offered, want) {
+					req = append(req, want)
+				}
+			}
+			if saslPass != "" {
+				if !hasCap(offered, "sasl") {
+					return "", nil, fmt.Errorf("server does not support SASL")
+				}
+				req = append(req, "sasl")
+			}
+			if len(req) == 0 {
+				c.sendRaw("CAP END")
+			} else {
+				c.sendRaw("CAP REQ :" + strings.Join(req, " "))
+			}
+		case sub == "ACK":
+			for _, name := range strings.Fields(list) {
+				caps[name] = true
+			}
+			if more {
+				continue
+			}
+			if caps["sasl"] {
+				c.sendRaw("AUTHENTICATE PLAIN")
+			} else {
+				c.sendRaw("CAP END")
 			}
-			t.Stop()
-			t = time.NewTimer(pingTime)
-			i.handleMsg(msg)
-
-		case <-t.C:
-			i.Client.Out <- irc.Msg{Cmd: irc.PING, Args: []string{i.Client.Server}}
-			t = time.NewTimer(pingTime)
-
-		case err, ok := <-i.Client.Errors:
-			if ok && err != io.EOF {
-				log.Println(err)
-				i.quit <- true
-				return
+		case sub == "NAK":
+			if saslPass != "" {
+				return "", nil, fmt.Errorf("server refused SASL")
+			}
+			log.Printf("Server refused capabilities: %s", list)
+			c.sendRaw("CAP END")
+
+		case m.Cmd == "AUTHENTICATE", m.Cmd == rplSASLSuccess, m.Cmd == errSASLFail,
+			m.Cmd == errSASLTooLong, m.Cmd == errSASLAborted, m.Cmd == errSASLAlready:
+			if err := i.sasl(c, m, saslPass); err != nil {
+				return "", nil, err
 			}
 		}
 	}
 }
 
+// SASL numerics, which the irc package doesn't know
+const (
+	rplSASLSuccess = "903"
+	errSASLFail    = "904"
+	errSASLTooLong = "905"
+	errSASLAborted = "906"
+	errSASLAlready = "907"
+)
+
+// sasl takes one step of SASL PLAIN authentication, see https://ircv3.net/specs/extensions/sasl-3.1
+func (i *Irc) sasl(c *conn, m irc.Msg, pass string) error {
+	switch {
+	case m.Cmd == "AUTHENTICATE" && len(m.Args) > 0 && m.Args[0] == "+":
+		account := i.config.Get("Irc.SASLUser", i.config.Get("Nick", ""))
+		for _, chunk := range saslPlain(account, pass) {
+			if err := c.sendRaw("AUTHENTICATE " + chunk); err != nil {
+				return err
+			}
+		}
+		return nil
+	case m.Cmd == rplSASLSuccess || m.Cmd == errSASLAlready:
+		return c.sendRaw("CAP END")
+	case m.Cmd == errSASLFail || m.Cmd == errSASLTooLong || m.Cmd == errSASLAborted:
+		return fmt.Errorf("SASL authentication failed: %s", m.Raw)
+	}
+	return nil
+}
+
 // HandleMsg handles IRC messages from the server.
-func (i *Irc) handleMsg(msg irc.Msg) {
-	botMsg := i.buildMessage(msg)
+func (i *Irc) handleMsg(msg irc.Msg, t tags) {
+	if i.isEcho(msg, t) {
+		return
+	}
+	i.dropEcho(msg)
+	i.track(msg)
+	botMsg := i.buildMessage(msg, t)
 
 	switch msg.Cmd {
 	case irc.ERROR:
 		log.Println(1, "Received error: "+msg.Raw)
 
 	case irc.PING:
-		i.Client.Out <- irc.Msg{Cmd: irc.PONG}
+		i.send(irc.Msg{Cmd: irc.PONG, Args: msg.Args})
 
 	case irc.PONG:
 		// OK, ignore
@@ -227,17 +571,27 @@ func (i *Irc) handleMsg(msg irc.Msg) {
 	case irc.NICK:
 		fallthrough
 
+	case irc.QUIT:
+		fallthrough
+
 	case irc.RPL_WHOREPLY:
 		fallthrough
 
 	case irc.RPL_ENDOFWHO:
-		i.event(bot.Event, botMsg)
+		i.dispatch(bot.Event, botMsg)
 
 	case irc.PRIVMSG:
-		i.event(bot.Message, botMsg)
+		if parent := t["+draft/reply"]; parent != "" {
+			i.dispatch(bot.Reply, botMsg, parent)
+		} else {
+			i.dispatch(bot.Message, botMsg)
+		}
 
-	case irc.QUIT:
-		os.Exit(1)
+	case "TAGMSG":
+		if react, parent := t["+draft/react"], t["+draft/reply"]; react != "" && parent != "" {
+			botMsg.Body = react
+			i.dispatch(bot.Reaction, botMsg, parent)
+		}
 
 	default:
 		cmd := irc.CmdNames[msg.Cmd]
@@ -245,17 +599,155 @@ func (i *Irc) handleMsg(msg irc.Msg) {
 	}
 }
 
+// dispatch queues an event for runEvents, keeping the order they came in
+func (i *Irc) dispatch(kind bot.Kind, m msg.Message, args ...interface{}) {
+	i.queueLock.Lock()
+	i.queue = append(i.queue, func() { i.event(kind, m, args...) })
+	i.queueLock.Unlock()
+	select {
+	case i.queued <- struct{}{}:
+	default:
+	}
+}
+
+// runEvents hands queued events to the bot one at a time
+func (i *Irc) runEvents() {
+	for range i.queued {
+		for {
+			i.queueLock.Lock()
+			if len(i.queue) == 0 {
+				i.queueLock.Unlock()
+				break
+			}
+			fn := i.queue[0]
+			i.queue = i.queue[1:]
+			i.queueLock.Unlock()
+			fn()
+		}
+	}
+}
+
+// isEcho checks for one of our own messages echoed back by the server,
+// handing its msgid to whoever sent it
+func (i *Irc) isEcho(m irc.Msg, t tags) bool {
+	if m.Cmd != irc.PRIVMSG && m.Cmd != irc.NOTICE && m.Cmd != "TAGMSG" {
+		return false
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if !i.caps["echo-message"] || m.Origin != i.nick {
+		return false
+	}
+	target, text := echoKey(m)
+	for _, e := range i.echoes {
+		if strings.EqualFold(e.target, target) && e.text == text {
+			e.id <- t["msgid"]
+			i.removeEcho(e)
+			break
+		}
+	}
+	return true
+}
+
+// dropEcho gives up on the oldest message to a target the server says we
+// can't send to, since it will never be echoed
+func (i *Irc) dropEcho(m irc.Msg) {
+	if m.Cmd != irc.ERR_NOSUCHNICK && m.Cmd != irc.ERR_NOSUCHCHANNEL && m.Cmd != irc.ERR_CANNOTSENDTOCHAN || len(m.Args) < 2 {
+		return
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for _, e := range i.echoes {
+		if strings.EqualFold(e.target, m.Args[1]) {
+			close(e.id)
+			i.removeEcho(e)
+			return
+		}
+	}
+}
+
+// track keeps the member list of each channel up to date
+func (i *Irc) track(m irc.Msg) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	arg := func(n int) string {
+		if len(m.Args) > n {
+			return m.Args[n]
+		}
+		return ""
+	}
+
+	switch m.Cmd {
+	case irc.RPL_NAMREPLY:
+		// me = #channel :@op +voiced nick
+		ch := arg(2)
+		if i.names[ch] == nil {
+			i.names[ch] = map[string]bool{}
+		}
+		for _, n := range strings.Fields(arg(3)) {
+			i.names[ch][strings.TrimLeft(n, "~&@%+")] = true
+		}
+	case irc.RPL_ENDOFNAMES:
+		ch := arg(1)
+		if i.names[ch] != nil {
+			i.members[ch] = i.names[ch]
+			delete(i.names, ch)
+		}
+	case irc.JOIN:
+		ch := arg(0)
+		if m.Origin == i.nick || i.members[ch] == nil {
+			i.members[ch] = map[string]bool{}
+		}
+		i.members[ch][m.Origin] = true
+	case irc.PART:
+		i.leave(arg(0), m.Origin)
+	case irc.KICK:
+		i.leave(arg(0), arg(1))
+	case irc.NICK:
+		if m.Origin == i.nick {
+			i.nick = arg(0)
+		}
+		for _, members := range i.members {
+			if members[m.Origin] {
+				delete(members, m.Origin)
+				members[arg(0)] = true
+			}
+		}
+	case irc.QUIT:
+		for _, members := range i.members {
+			delete(members, m.Origin)
+		}
+	}
+}
+
+// leave removes nick from a channel, forgetting the channel if it was us
+func (i *Irc) leave(channel, nick string) {
+	if nick == i.nick {
+		delete(i.members, channel)
+		return
+	}
+	delete(i.members[channel], nick)
+}
+
 // Builds our internal message type out of a Conn & Line from irc
-func (i *Irc) buildMessage(inMsg irc.Msg) msg.Message {
+func (i *Irc) buildMessage(inMsg irc.Msg, t tags) msg.Message {
 	// Check for the user
 	u := user.User{
+		// The nick can be taken by anybody, user@host is harder to fake
+		ID:   inMsg.User + "@" + inMsg.Host,
 		Name: inMsg.Origin,
 	}
 
-	channel := inMsg.Args[0]
-	if channel == i.config.Get("Nick", "bot") {
+	channel := ""
+	if len(inMsg.Args) > 0 {
 		channel = inMsg.Args[0]
 	}
+	i.mu.Lock()
+	if channel == i.nick {
+		// a private message, answer whoever sent it
+		channel = inMsg.Origin
+	}
+	i.mu.Unlock()
 
 	isAction := false
 	var message string
@@ -276,20 +768,38 @@ func (i *Irc) buildMessage(inMsg irc.Msg) msg.Message {
 		iscmd, filteredMessage = bot.IsCmd(i.config, message)
 	}
 
+	when := time.Now()
+	if stamp, err := time.Parse(time.RFC3339Nano, t["time"]); err == nil {
+		when = stamp
+	}
+
 	msg := msg.Message{
-		User:    &u,
-		Channel: channel,
-		Body:    filteredMessage,
-		Raw:     message,
-		Command: iscmd,
-		Action:  isAction,
-		Time:    time.Now(),
-		Host:    inMsg.Host,
+		User:     &u,
+		Channel:  channel,
+		Body:     filteredMessage,
+		Raw:      message,
+		Command:  iscmd,
+		Action:   isAction,
+		Time:     when,
+		Host:     inMsg.Host,
+		ID:       t["msgid"],
+		ParentID: t["+draft/reply"],
+	}
+	if id := t["msgid"]; id != "" {
+		msg.AdditionalData = map[string]string{rawID: id}
 	}
 
 	return msg
 }
 
-func (i Irc) Who(channel string) []string {
-	return []string{}
+// Who lists the nicks in a channel
+func (i *Irc) Who(channel string) []string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	nicks := []string{}
+	for n := range i.members[channel] {
+		nicks = append(nicks, n)
+	}
+	sort.Strings(nicks)
+	return nicks
 }
@@ -0,0 +1,452 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+package irc
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/velour/catbase/bot"
+	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/config"
+)
+
+// fakeServer accepts connections from the bot and hands them to the test,
+// which plays the server's side line by line
+type fakeServer struct {
+	net.Listener
+	conns chan *fakeConn
+}
+
+type fakeConn struct {
+	net.Conn
+	t  *testing.T
+	in *bufio.Reader
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{l, make(chan *fakeConn, 1)}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			s.conns <- &fakeConn{c, t, bufio.NewReader(c)}
+		}
+	}()
+	return s
+}
+
+func (s *fakeServer) accept() *fakeConn {
+	select {
+	case c := <-s.conns:
+		return c
+	case <-time.After(5 * time.Second):
+		panic("the bot never connected")
+	}
+}
+
+// expect reads the next line from the bot and checks it
+func (c *fakeConn) expect(line string) {
+	c.t.Helper()
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	got, err := c.in.ReadString('\n')
+	assert.NoError(c.t, err)
+	assert.Equal(c.t, line, strings.TrimRight(got, "\r\n"))
+}
+
+func (c *fakeConn) send(lines ...string) {
+	for _, l := range lines {
+		fmt.Fprintf(c, "%s\r\n", l)
+	}
+}
+
+// sync waits until the bot has handled everything sent before it
+func (c *fakeConn) sync() {
+	c.t.Helper()
+	c.send("PING :sync")
+	c.expect("PONG :sync")
+}
+
+type event struct {
+	kind bot.Kind
+	msg  msg.Message
+	args []interface{}
+}
+
+func newTestIrc(s *fakeServer) (*Irc, chan event) {
+	c := config.ReadConfig(":memory:")
+	c.Set("Nick", "catbase")
+	c.Set("FullName", "Cat Base")
+	c.Set("channels", "#cats")
+	c.Set("Irc.Server", s.Addr().String())
+	c.Set("RatePerSec", "100")
+	i := New(c)
+	i.dial = func(addr string) (net.Conn, error) {
+		return net.Dial("tcp", addr)
+	}
+	i.initialTimeout = 10 * time.Millisecond
+	events := make(chan event, 10)
+	i.RegisterEvent(func(kind bot.Kind, m msg.Message, args ...interface{}) bool {
+		if kind != bot.Event {
+			events <- event{kind, m, args}
+		}
+		return true
+	})
+	return i, events
+}
+
+func next(t *testing.T, events chan event) event {
+	t.Helper()
+	select {
+	case e := <-events:
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event")
+	}
+	return event{}
+}
+
+func TestSASLAndReconnect(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.Close()
+	i, events := newTestIrc(s)
+	i.config.Set("Irc.SASLPass", "hunter2")
+	assert.NoError(t, i.Serve())
+
+	for n := 0; n < 2; n++ {
+		c := s.accept()
+		c.expect("CAP LS 302")
+		c.expect("NICK :catbase")
+		c.expect("USER catbase 0 * :Cat Base")
+		c.send(":irc.example.org CAP * LS :multi-prefix sasl=PLAIN,EXTERNAL")
+		c.expect("CAP REQ :sasl")
+		c.send(":irc.example.org CAP * ACK :sasl")
+		c.expect("AUTHENTICATE PLAIN")
+		c.send("AUTHENTICATE +")
+		// catbase\0catbase\0hunter2
+		c.expect("AUTHENTICATE Y2F0YmFzZQBjYXRiYXNlAGh1bnRlcjI=")
+		c.send(":irc.example.org 903 catbase :SASL authentication successful")
+		c.expect("CAP END")
+		c.send(":irc.example.org 001 catbase :Welcome")
+		c.expect("JOIN :#cats")
+		c.send(":alice!al@example.org PRIVMSG #cats :!hi")
+
+		e := next(t, events)
+		assert.Equal(t, "hi", e.msg.Body)
+		assert.Equal(t, "al@example.org", e.msg.User.ID)
+		// a user quitting must not take the bot down
+		c.send(":bob!b@example.org QUIT :bye")
+		c.sync()
+		c.Close()
+	}
+}
+
+func TestSASLUnsupported(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.Close()
+	i, _ := newTestIrc(s)
+	i.config.Set("Irc.SASLPass", "hunter2")
+
+	go func() {
+		c := s.accept()
+		defer c.Close()
+		c.expect("CAP LS 302")
+		c.expect("NICK :catbase")
+		c.expect("USER catbase 0 * :Cat Base")
+		c.send(":irc.example.org CAP * LS :multi-prefix")
+	}()
+	registered, err := i.connect()
+	assert.False(t, registered)
+	assert.Error(t, err, "the password is never sent without SASL")
+}
+
+func TestNickServAndTakenNick(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.Close()
+	i, _ := newTestIrc(s)
+	i.config.Set("Irc.NickServPass", "hunter2")
+	i.config.Set("channels", "")
+	assert.NoError(t, i.Serve())
+
+	c := s.accept()
+	defer c.Close()
+	c.expect("CAP LS 302")
+	c.expect("NICK :catbase")
+	c.expect("USER catbase 0 * :Cat Base")
+	c.send(":irc.example.org 433 * catbase :Nickname is already in use")
+	c.expect("NICK :catbase_")
+	c.send(":irc.example.org 001 catbase_ :Welcome")
+	c.expect("PRIVMSG NickServ :IDENTIFY hunter2")
+	c.sync()
+	i.mu.Lock()
+	assert.Equal(t, "catbase_", i.nick)
+	i.mu.Unlock()
+}
+
+func TestMembers(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.Close()
+	i, _ := newTestIrc(s)
+	assert.NoError(t, i.Serve())
+
+	c := s.accept()
+	defer c.Close()
+	c.expect("CAP LS 302")
+	c.expect("NICK :catbase")
+	c.expect("USER catbase 0 * :Cat Base")
+	// servers without IRCv3 don't answer CAP at all
+	c.send(":irc.example.org 421 * CAP :Unknown command")
+	c.send(":irc.example.org 001 catbase :Welcome")
+	c.expect("JOIN :#cats")
+	c.send(
+		":catbase!cb@example.org JOIN #cats",
+		":irc.example.org 353 catbase = #cats :catbase @alice +bob",
+		":irc.example.org 353 catbase = #cats :carol",
+		":irc.example.org 366 catbase #cats :End of /NAMES list.",
+	)
+	c.sync()
+	assert.Equal(t, []string{"alice", "bob", "carol", "catbase"}, i.Who("#cats"))
+
+	c.send(
+		":dave!d@example.org JOIN #cats",
+		":bob!b@example.org PART #cats :later",
+		":alice!al@example.org NICK alicia",
+		":carol!c@example.org QUIT :bye",
+	)
+	c.sync()
+	assert.Equal(t, []string{"alicia", "catbase", "dave"}, i.Who("#cats"))
+
+	c.send(":alicia!al@example.org KICK #cats dave :rude")
+	c.sync()
+	assert.Equal(t, []string{"alicia", "catbase"}, i.Who("#cats"))
+
+	c.send(":catbase!cb@example.org PART #cats")
+	c.sync()
+	assert.Empty(t, i.Who("#cats"))
+	assert.Empty(t, i.Who("#nowhere"))
+}
+
+func TestTags(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.Close()
+	i, events := newTestIrc(s)
+	assert.NoError(t, i.Serve())
+
+	c := s.accept()
+	defer c.Close()
+	c.expect("CAP LS 302")
+	c.expect("NICK :catbase")
+	c.expect("USER catbase 0 * :Cat Base")
+	c.send(
+		":irc.example.org CAP * LS * :multi-prefix message-tags",
+		":irc.example.org CAP * LS :server-time echo-message",
+	)
+	c.expect("CAP REQ :message-tags server-time echo-message")
+	c.send(":irc.example.org CAP * ACK :message-tags server-time echo-message")
+	c.expect("CAP END")
+	c.send(":irc.example.org 001 catbase :Welcome")
+	c.expect("JOIN :#cats")
+
+	c.send(
+		`@msgid=abc;time=2026-10-17T18:00:00.000Z :alice!al@example.org PRIVMSG #cats :cats are great`,
+		`@msgid=def;+draft/reply=abc :bob!b@example.org PRIVMSG #cats :they\sare`,
+		`@msgid=ghi;+draft/reply=abc;+draft/react=👍 :carol!c@example.org TAGMSG #cats`,
+	)
+	e := next(t, events)
+	assert.Equal(t, bot.Kind(bot.Message), e.kind)
+	assert.Equal(t, "abc", e.msg.AdditionalData[rawID])
+	assert.Equal(t, "abc", e.msg.ID)
+	assert.Equal(t, time.Date(2026, 10, 17, 18, 0, 0, 0, time.UTC), e.msg.Time)
+	original := e.msg
+
+	e = next(t, events)
+	assert.Equal(t, bot.Kind(bot.Reply), e.kind)
+	assert.Equal(t, `they\sare`, e.msg.Body, "only tag values are escaped")
+	assert.Equal(t, []interface{}{"abc"}, e.args)
+	assert.Equal(t, "def", e.msg.ID)
+	assert.Equal(t, "abc", e.msg.ParentID)
+
+	e = next(t, events)
+	assert.Equal(t, bot.Kind(bot.Reaction), e.kind)
+	assert.Equal(t, "👍", e.msg.Body)
+	assert.Equal(t, []interface{}{"abc"}, e.args)
+
+	// the fake echoes what the bot sends with a msgid, like a server with echo-message
+	type sent struct {
+		id  string
+		err error
+	}
+	send := func(kind bot.Kind, out bot.Outgoing, line, id string) string {
+		t.Helper()
+		done := make(chan sent)
+		go func() {
+			id, err := i.Send(kind, out)
+			done <- sent{id, err}
+		}()
+		c.expect(line)
+		_, rest := parseTags(line)
+		c.send("@msgid=" + id + " :catbase!cb@example.org " + rest)
+		r := <-done
+		assert.NoError(t, r.err)
+		return r.id
+	}
+
+	id := send(bot.Message, bot.Outgoing{Channel: "#cats", Text: "hello"}, "PRIVMSG #cats :hello", "m1")
+	assert.Equal(t, "m1", id)
+	id = send(bot.Reply, bot.Outgoing{Channel: "#cats", Text: "yes", Target: &original},
+		"@+draft/reply=abc PRIVMSG #cats :yes", "m2")
+	assert.Equal(t, "m2", id)
+	send(bot.Reaction, bot.Outgoing{Channel: "#cats", Reaction: "👍", Target: &original},
+		"@+draft/react=👍;+draft/reply=abc TAGMSG #cats", "m3")
+	id = send(bot.Edit, bot.Outgoing{Channel: "#cats", Text: "hello there", EditID: "m1"},
+		"@+draft/reply=m1 PRIVMSG #cats :* hello there", "m4")
+	assert.Equal(t, "m4", id)
+
+	c.sync()
+	select {
+	case e := <-events:
+		t.Errorf("echoes should not be events, got %+v", e)
+	default:
+	}
+}
+
+func TestEchoQueue(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.Close()
+	i, _ := newTestIrc(s)
+	assert.NoError(t, i.Serve())
+
+	c := s.accept()
+	defer c.Close()
+	c.expect("CAP LS 302")
+	c.expect("NICK :catbase")
+	c.expect("USER catbase 0 * :Cat Base")
+	c.send(":irc.example.org CAP * LS :echo-message")
+	c.expect("CAP REQ :echo-message")
+	c.send(":irc.example.org CAP * ACK :echo-message")
+	c.expect("CAP END")
+	c.send(":irc.example.org 001 catbase :Welcome")
+	c.expect("JOIN :#cats")
+
+	send := func(channel, text string) chan string {
+		ids := make(chan string, 1)
+		go func() {
+			id, err := i.Send(bot.Message, bot.Outgoing{Channel: channel, Text: text})
+			assert.NoError(t, err)
+			ids <- id
+		}()
+		c.expect("PRIVMSG " + channel + " :" + text)
+		return ids
+	}
+
+	// a message the server refuses is never echoed, and doesn't take the
+	// msgid of the next one
+	lost := send("#dogs", "woof")
+	c.send(":irc.example.org 404 catbase #dogs :Cannot send to channel")
+	assert.Equal(t, "NO_IRC_IDENTIFIERS", <-lost)
+	found := send("#cats", "meow")
+	c.send("@msgid=m1 :catbase!cb@example.org PRIVMSG #cats :meow")
+	assert.Equal(t, "m1", <-found)
+
+	// echoes are matched to what was sent, not taken in turn
+	first := send("#cats", "one")
+	second := send("#cats", "two")
+	c.send("@msgid=m3 :catbase!cb@example.org PRIVMSG #cats :two")
+	assert.Equal(t, "m3", <-second)
+	c.send("@msgid=m2 :catbase!cb@example.org PRIVMSG #cats :one")
+	assert.Equal(t, "m2", <-first)
+
+	c.sync()
+	i.mu.Lock()
+	assert.Empty(t, i.echoes)
+	i.mu.Unlock()
+}
+
+func TestSendFromEvent(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.Close()
+	i, _ := newTestIrc(s)
+	ids := make(chan string, 1)
+	i.RegisterEvent(func(kind bot.Kind, m msg.Message, args ...interface{}) bool {
+		if kind == bot.Message && m.Body == "ping" {
+			id, err := i.Send(bot.Message, bot.Outgoing{Channel: m.Channel, Text: "pong"})
+			assert.NoError(t, err)
+			ids <- id
+		}
+		return true
+	})
+	assert.NoError(t, i.Serve())
+
+	c := s.accept()
+	defer c.Close()
+	c.expect("CAP LS 302")
+	c.expect("NICK :catbase")
+	c.expect("USER catbase 0 * :Cat Base")
+	c.send(":irc.example.org CAP * LS :echo-message")
+	c.expect("CAP REQ :echo-message")
+	c.send(":irc.example.org CAP * ACK :echo-message")
+	c.expect("CAP END")
+	c.send(":irc.example.org 001 catbase :Welcome")
+	c.expect("JOIN :#cats")
+
+	c.send(":alice!a@example.org PRIVMSG #cats :ping")
+	c.expect("PRIVMSG #cats :pong")
+	// the reply is still waiting for its echo, which has to be read
+	// while the handler that sent it hasn't returned
+	c.sync()
+	c.send("@msgid=m1 :catbase!cb@example.org PRIVMSG #cats :pong")
+	select {
+	case id := <-ids:
+		assert.Equal(t, "m1", id)
+	case <-time.After(echoTimeout / 2):
+		t.Fatal("the echo of a message sent while handling an event was never read")
+	}
+}
+
+func TestTagEscaping(t *testing.T) {
+	tg, rest := parseTags(`@a=x\:y\sz\\;b;c= :n!u@h PRIVMSG #c :hi`)
+	assert.Equal(t, tags{"a": `x;y z\`, "b": "", "c": ""}, tg)
+	assert.Equal(t, ":n!u@h PRIVMSG #c :hi", rest)
+	assert.Equal(t, `a=x\:y\sz\\;b;c`, tg.String())
+}
+
+func TestSaslPlainChunks(t *testing.T) {
+	assert.Equal(t, []string{"YQBhAGI="}, saslPlain("a", "b"))
+	// 300 bytes encode to exactly 400, which needs a + after
+	long := saslPlain(strings.Repeat("a", 149), "")
+	assert.Len(t, long, 2)
+	assert.Len(t, long[0], 400)
+	assert.Equal(t, "+", long[1])
+}
+
+func TestDialChecksCertificate(t *testing.T) {
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+	addr := strings.TrimPrefix(srv.URL, "https://")
+
+	c := config.ReadConfig(":memory:")
+	c.Set("Irc.InsecureTLS", "false")
+	i := New(c)
+	_, err := i.dial(addr)
+	assert.Error(t, err, "a self-signed certificate should be refused")
+
+	c.Set("Irc.InsecureTLS", "true")
+	conn, err := i.dial(addr)
+	if assert.NoError(t, err) {
+		conn.Close()
+	}
+}
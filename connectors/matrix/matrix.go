@@ -0,0 +1,415 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+// Package matrix connects the bot to a Matrix homeserver with the
+// client-server API, long polling /sync for events.
+package matrix
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/velour/catbase/bot"
+	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/bot/user"
+	"github.com/velour/catbase/config"
+)
+
+// rawID is where the Matrix event ID is kept in a msg.Message
+const rawID = "RAW_MATRIX_EVENT_ID"
+
+type Matrix struct {
+	config *config.Config
+
+	// homeserver is the base URL of the client-server API
+	homeserver string
+	userID     string
+	token      string
+	client     *http.Client
+	// pollTimeout is how long the homeserver may hold a /sync open
+	pollTimeout time.Duration
+	// retry is how long to wait after a failed /sync
+	retry time.Duration
+
+	// txn numbers sent events, which homeservers use to drop retried sends
+	txnPrefix string
+	txn       int64
+
+	// since is the sync token, only used by the sync loop
+	since string
+
+	// mu guards names
+	mu sync.Mutex
+	// names maps user IDs to display names
+	names map[string]string
+
+	event bot.Callback
+}
+
+func init() {
+	config.Register(
+		config.Key{Name: "matrix.homeserver", Description: "base URL of the homeserver, like https://matrix.example.org"},
+		config.Key{Name: "matrix.userid", Description: "full user ID of the bot, like @catbase:example.org"},
+		config.Key{Name: "matrix.token", Description: "access token of the bot's account", Secret: true},
+	)
+}
+
+func New(c *config.Config) *Matrix {
+	homeserver := strings.TrimSuffix(c.Get("matrix.homeserver", ""), "/")
+	token := c.Get("matrix.token", "")
+	if homeserver == "" || token == "" {
+		log.Fatalf("No matrix homeserver or token found. Set MATRIXHOMESERVER and MATRIXTOKEN env.")
+	}
+	return &Matrix{
+		config:      c,
+		homeserver:  homeserver,
+		userID:      c.Get("matrix.userid", ""),
+		token:       token,
+		client:      &http.Client{Timeout: time.Minute},
+		pollTimeout: 30 * time.Second,
+		retry:       5 * time.Second,
+		txnPrefix:   fmt.Sprintf("catbase%d", time.Now().UnixNano()),
+		names:       map[string]string{},
+	}
+}
+
+func (m *Matrix) RegisterEvent(f bot.Callback) {
+	m.event = f
+}
+
+// Serve joins the configured rooms and starts syncing in the background
+func (m *Matrix) Serve() error {
+	if m.event == nil {
+		return fmt.Errorf("Missing an event handler")
+	}
+	if err := m.join(); err != nil {
+		return err
+	}
+	go func() {
+		for {
+			if err := m.sync(); err != nil {
+				log.Printf("Matrix sync failed: %s", err)
+				time.Sleep(m.retry)
+			}
+		}
+	}()
+	return nil
+}
+
+// join asks the homeserver who the bot is if it wasn't configured, then
+// joins every room in channels
+func (m *Matrix) join() error {
+	if m.userID == "" {
+		var who struct {
+			UserID string `json:"user_id"`
+		}
+		if err := m.api("GET", "/account/whoami", nil, &who); err != nil {
+			return err
+		}
+		m.userID = who.UserID
+	}
+	for _, room := range bot.NetworkChannels(m.config, "matrix") {
+		if err := m.api("POST", "/join/"+url.PathEscape(room), struct{}{}, nil); err != nil {
+			log.Printf("Could not join %s: %s", room, err)
+		}
+	}
+	return nil
+}
+
+// event is a room event, with only the fields the bot uses
+type event struct {
+	Type           string          `json:"type"`
+	EventID        string          `json:"event_id"`
+	Sender         string          `json:"sender"`
+	StateKey       *string         `json:"state_key"`
+	OriginServerTS int64           `json:"origin_server_ts"`
+	Content        json.RawMessage `json:"content"`
+}
+
+type relatesTo struct {
+	RelType   string `json:"rel_type,omitempty"`
+	EventID   string `json:"event_id,omitempty"`
+	Key       string `json:"key,omitempty"`
+	InReplyTo *struct {
+		EventID string `json:"event_id"`
+	} `json:"m.in_reply_to,omitempty"`
+	IsFallingBack bool `json:"is_falling_back,omitempty"`
+}
+
+type content struct {
+	MsgType    string     `json:"msgtype,omitempty"`
+	Body       string     `json:"body,omitempty"`
+	RelatesTo  *relatesTo `json:"m.relates_to,omitempty"`
+	NewContent *content   `json:"m.new_content,omitempty"`
+}
+
+type syncResponse struct {
+	NextBatch string `json:"next_batch"`
+	Rooms     struct {
+		Join map[string]struct {
+			State struct {
+				Events []event `json:"events"`
+			} `json:"state"`
+			Timeline struct {
+				Events []event `json:"events"`
+			} `json:"timeline"`
+		} `json:"join"`
+	} `json:"rooms"`
+}
+
+// sync makes one /sync request and handles what it returns. The first sync
+// only learns names, so the bot doesn't answer messages from before it started.
+func (m *Matrix) sync() error {
+	q := url.Values{}
+	if m.since == "" {
+		q.Set("filter", `{"room":{"timeline":{"limit":1}}}`)
+	} else {
+		q.Set("since", m.since)
+		q.Set("timeout", fmt.Sprint(m.pollTimeout.Milliseconds()))
+	}
+	var resp syncResponse
+	if err := m.api("GET", "/sync?"+q.Encode(), nil, &resp); err != nil {
+		return err
+	}
+
+	first := m.since == ""
+	for room, r := range resp.Rooms.Join {
+		for _, ev := range r.State.Events {
+			m.handleEvent(room, ev, true)
+		}
+		for _, ev := range r.Timeline.Events {
+			m.handleEvent(room, ev, first)
+		}
+	}
+	m.since = resp.NextBatch
+	return nil
+}
+
+// handleEvent passes on an event, or only remembers the names in it if stateOnly
+func (m *Matrix) handleEvent(room string, ev event, stateOnly bool) {
+	if ev.Type == "m.room.member" && ev.StateKey != nil {
+		var member struct {
+			DisplayName string `json:"displayname"`
+		}
+		json.Unmarshal(ev.Content, &member)
+		m.mu.Lock()
+		m.names[*ev.StateKey] = member.DisplayName
+		m.mu.Unlock()
+		return
+	}
+	if stateOnly || ev.Sender == m.userID {
+		return
+	}
+
+	var c content
+	if err := json.Unmarshal(ev.Content, &c); err != nil {
+		log.Printf("Bad %s event from matrix: %s", ev.Type, err)
+		return
+	}
+	rel := c.RelatesTo
+	switch {
+	case ev.Type == "m.reaction" && rel != nil && rel.RelType == "m.annotation":
+		m.event(bot.Reaction, m.buildMessage(room, ev, rel, rel.Key, false), rel.EventID)
+	case ev.Type != "m.room.message":
+	case rel != nil && rel.RelType == "m.replace" && c.NewContent != nil:
+		m.event(bot.Edit, m.buildMessage(room, ev, rel, c.NewContent.Body, c.NewContent.MsgType == "m.emote"), rel.EventID)
+	case c.MsgType == "m.notice":
+		// notices are from other bots, answering them can loop forever
+	case rel != nil && rel.InReplyTo != nil && !rel.IsFallingBack:
+		body := stripReplyFallback(c.Body)
+		m.event(bot.Reply, m.buildMessage(room, ev, rel, body, c.MsgType == "m.emote"), rel.InReplyTo.EventID)
+	default:
+		m.event(bot.Message, m.buildMessage(room, ev, rel, c.Body, c.MsgType == "m.emote"))
+	}
+}
+
+// stripReplyFallback removes the quote of the original that clients put
+// at the top of replies for clients that don't understand them
+func stripReplyFallback(body string) string {
+	lines := strings.Split(body, "\n")
+	i := 0
+	for i < len(lines) && strings.HasPrefix(lines[i], ">") {
+		i++
+	}
+	if i > 0 && i < len(lines) && lines[i] == "" {
+		return strings.Join(lines[i+1:], "\n")
+	}
+	return body
+}
+
+func (m *Matrix) buildMessage(room string, ev event, rel *relatesTo, text string, isAction bool) msg.Message {
+	isCmd := false
+	if !isAction {
+		isCmd, text = bot.IsCmd(m.config, text)
+	}
+	thread, parent := "", ""
+	if rel != nil {
+		if rel.RelType == "m.thread" {
+			thread = rel.EventID
+		}
+		// replies in threads point at the newest message as a fallback
+		// for clients without threads, that isn't a real reply
+		if rel.InReplyTo != nil && !rel.IsFallingBack {
+			parent = rel.InReplyTo.EventID
+		}
+	}
+	return msg.Message{
+		User: &user.User{
+			ID:   ev.Sender,
+			Name: m.name(ev.Sender),
+		},
+		Body:    text,
+		Raw:     text,
+		Channel: room,
+		Command: isCmd,
+		Action:  isAction,
+		Time:    time.Unix(0, ev.OriginServerTS*int64(time.Millisecond)),
+		AdditionalData: map[string]string{
+			rawID: ev.EventID,
+		},
+		ID:       ev.EventID,
+		ThreadID: thread,
+		ParentID: parent,
+	}
+}
+
+// name finds the display name of a user, or the local part of their ID
+func (m *Matrix) name(userID string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if n := m.names[userID]; n != "" {
+		return n
+	}
+	local := strings.TrimPrefix(userID, "@")
+	if i := strings.Index(local, ":"); i >= 0 {
+		local = local[:i]
+	}
+	return local
+}
+
+func (m *Matrix) Send(kind bot.Kind, out bot.Outgoing) (string, error) {
+	c := content{MsgType: "m.text", Body: out.Text}
+	if out.ThreadID != "" {
+		c.RelatesTo = &relatesTo{RelType: "m.thread", EventID: out.ThreadID}
+	}
+	switch kind {
+	case bot.Message:
+	case bot.Action:
+		c.MsgType = "m.emote"
+	case bot.Reply:
+		ref := out.ReplyTo
+		if ref == "" && out.Target != nil {
+			ref = out.Target.AdditionalData[rawID]
+		}
+		if ref == "" {
+			return "", fmt.Errorf("Reply needs an identifier or message to reply to")
+		}
+		if c.RelatesTo == nil {
+			c.RelatesTo = &relatesTo{}
+		}
+		c.RelatesTo.InReplyTo = &struct {
+			EventID string `json:"event_id"`
+		}{ref}
+	case bot.Reaction:
+		if out.Target == nil {
+			return "", fmt.Errorf("Reaction needs a message to react to")
+		}
+		return m.sendEvent(out.Channel, "m.reaction", content{RelatesTo: &relatesTo{
+			RelType: "m.annotation",
+			EventID: out.Target.AdditionalData[rawID],
+			Key:     out.Reaction,
+		}})
+	case bot.Edit:
+		c = content{
+			MsgType:    "m.text",
+			Body:       "* " + out.Text,
+			NewContent: &content{MsgType: "m.text", Body: out.Text},
+			RelatesTo:  &relatesTo{RelType: "m.replace", EventID: out.EditID},
+		}
+	default:
+		return "", fmt.Errorf("%w: Matrix cannot send %s", bot.ErrUnsupported, kind)
+	}
+	return m.sendEvent(out.Channel, "m.room.message", c)
+}
+
+func (m *Matrix) sendEvent(room, eventType string, c content) (string, error) {
+	log.Printf("Sending %s to %s: %s", eventType, room, c.Body)
+	txn := fmt.Sprintf("%s.%d", m.txnPrefix, atomic.AddInt64(&m.txn, 1))
+	var sent struct {
+		EventID string `json:"event_id"`
+	}
+	path := "/rooms/" + url.PathEscape(room) + "/send/" + eventType + "/" + txn
+	err := m.api("PUT", path, c, &sent)
+	return sent.EventID, err
+}
+
+// api calls the client-server API and decodes the response into out if it isn't nil
+func (m *Matrix) api(method, path string, body, out interface{}) error {
+	var r io.Reader
+	if body != nil {
+		buf, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(buf)
+	}
+	req, err := http.NewRequest(method, m.homeserver+"/_matrix/client/v3"+path, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+m.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("matrix %s %s: %s %s", method, path, resp.Status, msg)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// GetEmojiList is empty, Matrix has no custom emoji
+func (m *Matrix) GetEmojiList() map[string]string {
+	return map[string]string{}
+}
+
+// Who lists the members who have joined a room
+func (m *Matrix) Who(room string) []string {
+	var members struct {
+		Joined map[string]struct {
+			DisplayName string `json:"display_name"`
+		} `json:"joined"`
+	}
+	if err := m.api("GET", "/rooms/"+url.PathEscape(room)+"/joined_members", nil, &members); err != nil {
+		log.Println(err)
+		return []string{m.config.Get("Nick", "")}
+	}
+	names := []string{}
+	for id, member := range members.Joined {
+		if member.DisplayName != "" {
+			names = append(names, member.DisplayName)
+		} else {
+			names = append(names, m.name(id))
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,200 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+package matrix
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/velour/catbase/bot"
+	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/config"
+)
+
+// homeserver is a local stand in for a homeserver that answers /sync from
+// testdata and records everything else it is sent
+type homeserver struct {
+	*httptest.Server
+	t *testing.T
+
+	mu       sync.Mutex
+	requests []string
+}
+
+func newHomeserver(t *testing.T) *homeserver {
+	h := &homeserver{t: t}
+	h.Server = httptest.NewServer(http.HandlerFunc(h.serve))
+	return h
+}
+
+func (h *homeserver) serve(w http.ResponseWriter, r *http.Request) {
+	assert.Equal(h.t, "Bearer syt_test", r.Header.Get("Authorization"))
+	path := strings.TrimPrefix(r.URL.EscapedPath(), "/_matrix/client/v3")
+	switch {
+	case path == "/sync" && r.URL.Query().Get("since") == "":
+		http.ServeFile(w, r, "testdata/sync_initial.json")
+		return
+	case path == "/sync":
+		assert.Equal(h.t, "s72594_4483_1934", r.URL.Query().Get("since"))
+		http.ServeFile(w, r, "testdata/sync.json")
+		return
+	}
+
+	body, _ := ioutil.ReadAll(r.Body)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.requests = append(h.requests, strings.TrimSpace(r.Method+" "+path+" "+string(body)))
+	switch {
+	case path == "/account/whoami":
+		w.Write([]byte(`{"user_id":"@catbase:example.org"}`))
+	case strings.HasSuffix(path, "/joined_members"):
+		w.Write([]byte(`{"joined":{"@alice:example.org":{"display_name":"Alice"},"@bob:example.org":{},"@catbase:example.org":{"display_name":"catbase"}}}`))
+	case strings.Contains(path, "/send/"):
+		w.Write([]byte(`{"event_id":"$sent"}`))
+	default:
+		w.Write([]byte(`{}`))
+	}
+}
+
+func newTestMatrix(h *homeserver) *Matrix {
+	c := config.ReadConfig(":memory:")
+	c.Set("Nick", "catbase")
+	c.Set("matrix.homeserver", h.URL+"/")
+	c.Set("matrix.token", "syt_test")
+	m := New(c)
+	m.txnPrefix = "t"
+	return m
+}
+
+type received struct {
+	kind bot.Kind
+	msg  msg.Message
+	args []interface{}
+}
+
+func TestJoin(t *testing.T) {
+	h := newHomeserver(t)
+	defer h.Close()
+	m := newTestMatrix(h)
+	m.config.Set("channels", "#cats:example.org;;!dogs:example.org")
+
+	assert.NoError(t, m.join())
+	assert.Equal(t, "@catbase:example.org", m.userID)
+	assert.Equal(t, []string{
+		"GET /account/whoami",
+		"POST /join/%23cats:example.org {}",
+		"POST /join/%21dogs:example.org {}",
+	}, h.requests)
+}
+
+func TestSync(t *testing.T) {
+	h := newHomeserver(t)
+	defer h.Close()
+	m := newTestMatrix(h)
+	m.userID = "@catbase:example.org"
+	events := []received{}
+	m.RegisterEvent(func(kind bot.Kind, message msg.Message, args ...interface{}) bool {
+		events = append(events, received{kind, message, args})
+		return true
+	})
+
+	assert.NoError(t, m.sync())
+	assert.Empty(t, events, "messages from before the first sync are skipped")
+	assert.NoError(t, m.sync())
+	assert.Equal(t, "s72595_4483_1934", m.since)
+
+	if !assert.Len(t, events, 6, "the bot's own message and notices are skipped") {
+		return
+	}
+	text := events[0]
+	assert.Equal(t, bot.Kind(bot.Message), text.kind)
+	assert.Equal(t, "Alice", text.msg.User.Name, "names are learned from member state")
+	assert.Equal(t, "@alice:example.org", text.msg.User.ID)
+	assert.Equal(t, "!cats:example.org", text.msg.Channel)
+	assert.True(t, text.msg.Command)
+	assert.Equal(t, "remember cats are great", text.msg.Body)
+	assert.Equal(t, "$text", text.msg.AdditionalData[rawID])
+	assert.Equal(t, "$text", text.msg.ID)
+	assert.Equal(t, int64(1792263600), text.msg.Time.Unix())
+
+	assert.True(t, events[1].msg.Action)
+	assert.Equal(t, "Bobby", events[1].msg.User.Name, "names are learned from the timeline too")
+
+	assert.Equal(t, bot.Kind(bot.Reply), events[2].kind)
+	assert.Equal(t, "they are", events[2].msg.Body, "the quoted fallback is removed")
+	assert.Equal(t, []interface{}{"$text"}, events[2].args)
+	assert.Equal(t, "$text", events[2].msg.ParentID)
+
+	assert.Equal(t, bot.Kind(bot.Edit), events[3].kind)
+	assert.Equal(t, "they really are", events[3].msg.Body)
+	assert.Equal(t, []interface{}{"$reply"}, events[3].args)
+
+	assert.Equal(t, bot.Kind(bot.Reaction), events[4].kind)
+	assert.Equal(t, "👍", events[4].msg.Body)
+	assert.Equal(t, "carol", events[4].msg.User.Name, "unknown users go by their local part")
+	assert.Equal(t, []interface{}{"$text"}, events[4].args)
+
+	threaded := events[5]
+	assert.Equal(t, bot.Kind(bot.Message), threaded.kind)
+	assert.Equal(t, "$text", threaded.msg.ThreadID)
+	assert.Equal(t, "", threaded.msg.ParentID, "the reply fallback in threads isn't a real reply")
+}
+
+func TestSend(t *testing.T) {
+	h := newHomeserver(t)
+	defer h.Close()
+	m := newTestMatrix(h)
+	target := &msg.Message{AdditionalData: map[string]string{rawID: "$text"}}
+
+	sends := []struct {
+		kind bot.Kind
+		out  bot.Outgoing
+	}{
+		{bot.Message, bot.Outgoing{Channel: "!cats:example.org", Text: "hi"}},
+		{bot.Action, bot.Outgoing{Channel: "!cats:example.org", Text: "purrs"}},
+		{bot.Reply, bot.Outgoing{Channel: "!cats:example.org", Text: "yes", Target: target}},
+		{bot.Message, bot.Outgoing{Channel: "!cats:example.org", Text: "threaded", ThreadID: "$root"}},
+		{bot.Edit, bot.Outgoing{Channel: "!cats:example.org", Text: "fixed", EditID: "$sent"}},
+		{bot.Reaction, bot.Outgoing{Channel: "!cats:example.org", Reaction: "👍", Target: target}},
+	}
+	for _, s := range sends {
+		id, err := m.Send(s.kind, s.out)
+		assert.NoError(t, err, "%s", s.kind)
+		assert.Equal(t, "$sent", id)
+	}
+	_, err := m.Send(bot.Reply, bot.Outgoing{Channel: "!cats:example.org", Text: "to nothing"})
+	assert.Error(t, err)
+	_, err = m.Send(bot.Help, bot.Outgoing{Channel: "!cats:example.org"})
+	assert.True(t, errors.Is(err, bot.ErrUnsupported))
+
+	assert.Equal(t, []string{
+		`PUT /rooms/%21cats:example.org/send/m.room.message/t.1 {"msgtype":"m.text","body":"hi"}`,
+		`PUT /rooms/%21cats:example.org/send/m.room.message/t.2 {"msgtype":"m.emote","body":"purrs"}`,
+		`PUT /rooms/%21cats:example.org/send/m.room.message/t.3 {"msgtype":"m.text","body":"yes","m.relates_to":{"m.in_reply_to":{"event_id":"$text"}}}`,
+		`PUT /rooms/%21cats:example.org/send/m.room.message/t.4 {"msgtype":"m.text","body":"threaded","m.relates_to":{"rel_type":"m.thread","event_id":"$root"}}`,
+		`PUT /rooms/%21cats:example.org/send/m.room.message/t.5 {"msgtype":"m.text","body":"* fixed","m.relates_to":{"rel_type":"m.replace","event_id":"$sent"},"m.new_content":{"msgtype":"m.text","body":"fixed"}}`,
+		`PUT /rooms/%21cats:example.org/send/m.reaction/t.6 {"m.relates_to":{"rel_type":"m.annotation","event_id":"$text","key":"👍"}}`,
+	}, h.requests)
+}
+
+func TestWho(t *testing.T) {
+	h := newHomeserver(t)
+	defer h.Close()
+	m := newTestMatrix(h)
+
+	assert.Equal(t, []string{"Alice", "bob", "catbase"}, m.Who("!cats:example.org"))
+	assert.Equal(t, []string{"GET /rooms/%21cats:example.org/joined_members"}, h.requests)
+}
+
+func TestStripReplyFallback(t *testing.T) {
+	assert.Equal(t, "reply", stripReplyFallback("> <@a:b> one\n> two\n\nreply"))
+	assert.Equal(t, "> just a quote", stripReplyFallback("> just a quote"))
+	assert.Equal(t, "plain", stripReplyFallback("plain"))
+}
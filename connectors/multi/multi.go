@@ -0,0 +1,185 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+// Package multi runs several connectors as one, so a single bot with one set
+// of plugins and one database can sit on several chat networks. Channels and
+// user IDs are namespaced by network, like irc:#cats and slackapp:C123.
+package multi
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/velour/catbase/bot"
+	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/config"
+)
+
+type Multi struct {
+	config *config.Config
+
+	conns map[string]bot.Connector
+	// mirrors maps a channel to the others it is mirrored with
+	mirrors map[string][]string
+
+	event bot.Callback
+}
+
+func init() {
+	config.Register(
+		config.Key{Name: "multi.networks", Type: config.Array, Description: "connector types to run at once when type is multi, which name their channels like irc:#cats"},
+		config.Key{Name: "multi.mirrors", Type: config.Array, Description: "groups of channels that see each other's messages, separated by commas like irc:#cats,slackapp:C123"},
+	)
+}
+
+// New runs the connectors in conns, keyed by the network name their channels get
+func New(c *config.Config, conns map[string]bot.Connector) *Multi {
+	m := &Multi{
+		config:  c,
+		conns:   conns,
+		mirrors: map[string][]string{},
+	}
+	for _, group := range c.GetArray("multi.mirrors", []string{}) {
+		channels := strings.Split(group, ",")
+		for i := range channels {
+			channels[i] = strings.TrimSpace(channels[i])
+		}
+		for _, ch := range channels {
+			for _, other := range channels {
+				if other != ch {
+					m.mirrors[ch] = append(m.mirrors[ch], other)
+				}
+			}
+		}
+	}
+	return m
+}
+
+func (m *Multi) RegisterEvent(f bot.Callback) {
+	m.event = f
+	for name, conn := range m.conns {
+		conn.RegisterEvent(m.receive(name))
+	}
+}
+
+// receive namespaces events from one network before the bot sees them
+func (m *Multi) receive(network string) bot.Callback {
+	return func(kind bot.Kind, message msg.Message, args ...interface{}) bool {
+		message.Channel = network + ":" + message.Channel
+		if message.User != nil {
+			u := *message.User
+			u.ID = network + ":" + u.ID
+			message.User = &u
+		}
+		if kind == bot.Message {
+			m.relay(network, message)
+		}
+		return m.event(kind, message, args...)
+	}
+}
+
+// relay copies a message from a user to the channels mirroring its channel
+func (m *Multi) relay(network string, message msg.Message) {
+	name := ""
+	if message.User != nil {
+		name = message.User.Name
+	}
+	text := fmt.Sprintf("[%s] <%s> %s", network, name, message.Raw)
+	if message.Action {
+		text = fmt.Sprintf("[%s] * %s %s", network, name, message.Raw)
+	}
+	for _, ch := range m.mirrors[message.Channel] {
+		if _, err := m.send(bot.Message, bot.Outgoing{Channel: ch, Text: text}); err != nil {
+			log.Printf("Could not mirror %s to %s: %s", message.Channel, ch, err)
+		}
+	}
+}
+
+// Send delivers to the network a channel is on. What the bot says in a
+// mirrored channel is said in the channels mirroring it too.
+func (m *Multi) Send(kind bot.Kind, out bot.Outgoing) (string, error) {
+	id, err := m.send(kind, out)
+	if err != nil {
+		return id, err
+	}
+	switch kind {
+	case bot.Message, bot.Action, bot.Reply:
+		var mirrorKind bot.Kind = bot.Message
+		if kind == bot.Action {
+			mirrorKind = bot.Action
+		}
+		for _, ch := range m.mirrors[out.Channel] {
+			if _, err := m.send(mirrorKind, bot.Outgoing{Channel: ch, Text: out.Text}); err != nil {
+				log.Printf("Could not mirror to %s: %s", ch, err)
+			}
+		}
+	}
+	return id, nil
+}
+
+// send delivers to a single network, taking the namespace off the channel
+func (m *Multi) send(kind bot.Kind, out bot.Outgoing) (string, error) {
+	network, channel := bot.SplitChannel(out.Channel)
+	conn, ok := m.conns[network]
+	if !ok {
+		return "", fmt.Errorf("no network for channel %q", out.Channel)
+	}
+	out.Channel = channel
+	if out.Target != nil {
+		target := *out.Target
+		_, target.Channel = bot.SplitChannel(target.Channel)
+		if target.User != nil {
+			u := *target.User
+			u.ID = strings.TrimPrefix(u.ID, network+":")
+			target.User = &u
+		}
+		out.Target = &target
+	}
+	return conn.Send(kind, out)
+}
+
+// GetEmojiList has the emoji of every network
+func (m *Multi) GetEmojiList() map[string]string {
+	emoji := map[string]string{}
+	for _, name := range m.networks() {
+		for k, v := range m.conns[name].GetEmojiList() {
+			if _, ok := emoji[k]; !ok {
+				emoji[k] = v
+			}
+		}
+	}
+	return emoji
+}
+
+// Serve starts every network at once, since some connectors serve until they
+// disconnect. A network that fails is logged and the others carry on.
+func (m *Multi) Serve() error {
+	for _, name := range m.networks() {
+		go func(name string, conn bot.Connector) {
+			if err := conn.Serve(); err != nil {
+				log.Printf("Could not serve %s: %s", name, err)
+			}
+		}(name, m.conns[name])
+	}
+	return nil
+}
+
+func (m *Multi) Who(channel string) []string {
+	network, ch := bot.SplitChannel(channel)
+	conn, ok := m.conns[network]
+	if !ok {
+		return []string{}
+	}
+	return conn.Who(ch)
+}
+
+// networks lists the network names in a stable order
+func (m *Multi) networks() []string {
+	names := []string{}
+	for name := range m.conns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,142 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+package multi
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/velour/catbase/bot"
+	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/bot/user"
+	"github.com/velour/catbase/config"
+)
+
+// fakeConn records what is sent through it and lets tests raise events
+type fakeConn struct {
+	event bot.Callback
+	sent  []string
+	emoji map[string]string
+	who   []string
+	// served is closed once Serve is called, which then blocks until block is
+	// closed, if it is set
+	served chan struct{}
+	block  chan struct{}
+}
+
+func (f *fakeConn) RegisterEvent(cb bot.Callback)   { f.event = cb }
+func (f *fakeConn) GetEmojiList() map[string]string { return f.emoji }
+func (f *fakeConn) Who(channel string) []string     { return append([]string{channel}, f.who...) }
+
+func (f *fakeConn) Serve() error {
+	close(f.served)
+	if f.block != nil {
+		<-f.block
+		return fmt.Errorf("disconnected")
+	}
+	return nil
+}
+
+func (f *fakeConn) Send(kind bot.Kind, out bot.Outgoing) (string, error) {
+	line := fmt.Sprintf("%s %s %s", kind, out.Channel, out.Text)
+	if out.Target != nil {
+		line += fmt.Sprintf(" (to %s in %s)", out.Target.User.ID, out.Target.Channel)
+	}
+	f.sent = append(f.sent, line)
+	return fmt.Sprintf("id%d", len(f.sent)), nil
+}
+
+type event struct {
+	kind bot.Kind
+	msg  msg.Message
+}
+
+func setup(t *testing.T) (*Multi, *fakeConn, *fakeConn, *[]event) {
+	c := config.ReadConfig(":memory:")
+	c.Set("multi.networks", "irc;;slackapp")
+	c.Set("multi.mirrors", "irc:#cats, slackapp:C123")
+	irc := &fakeConn{emoji: map[string]string{}, served: make(chan struct{})}
+	slack := &fakeConn{emoji: map[string]string{"parrot": "https://example.org/parrot.gif"}, who: []string{"carol"}, served: make(chan struct{})}
+	m := New(c, map[string]bot.Connector{"irc": irc, "slackapp": slack})
+	events := []event{}
+	m.RegisterEvent(func(kind bot.Kind, message msg.Message, args ...interface{}) bool {
+		events = append(events, event{kind, message})
+		return true
+	})
+	return m, irc, slack, &events
+}
+
+func waitServed(t *testing.T, f *fakeConn) {
+	t.Helper()
+	select {
+	case <-f.served:
+	case <-time.After(5 * time.Second):
+		t.Fatal("never served")
+	}
+}
+
+func TestServeBlocking(t *testing.T) {
+	m, irc, slack, _ := setup(t)
+	// irc sorts first and serves until it disconnects
+	irc.block = make(chan struct{})
+	defer close(irc.block)
+
+	assert.NoError(t, m.Serve())
+	waitServed(t, irc)
+	waitServed(t, slack)
+}
+
+func TestNamespacing(t *testing.T) {
+	m, irc, slack, events := setup(t)
+	assert.NoError(t, m.Serve())
+	waitServed(t, irc)
+	waitServed(t, slack)
+
+	irc.event(bot.Message, msg.Message{User: &user.User{ID: "al@example.org", Name: "alice"}, Channel: "#dogs", Body: "hi", Raw: "hi"})
+	slack.event(bot.Message, msg.Message{User: &user.User{ID: "U1", Name: "bob"}, Channel: "C999", Body: "hi", Raw: "hi"})
+	if assert.Len(t, *events, 2) {
+		assert.Equal(t, "irc:#dogs", (*events)[0].msg.Channel)
+		assert.Equal(t, "irc:al@example.org", (*events)[0].msg.User.ID)
+		assert.Equal(t, "slackapp:C999", (*events)[1].msg.Channel)
+		assert.Equal(t, "slackapp:U1", (*events)[1].msg.User.ID)
+	}
+
+	id, err := m.Send(bot.Reply, bot.Outgoing{Channel: "irc:#dogs", Text: "hello", Target: &(*events)[0].msg})
+	assert.NoError(t, err)
+	assert.Equal(t, "id1", id)
+	assert.Equal(t, []string{"Reply #dogs hello (to al@example.org in #dogs)"}, irc.sent)
+	assert.Empty(t, slack.sent, "unmirrored channels stay on their network")
+
+	_, err = m.Send(bot.Message, bot.Outgoing{Channel: "#dogs", Text: "where?"})
+	assert.Error(t, err)
+	_, err = m.Send(bot.Message, bot.Outgoing{Channel: "discord:1", Text: "where?"})
+	assert.Error(t, err)
+
+	assert.Equal(t, []string{"C999", "carol"}, m.Who("slackapp:C999"), "Who asks the channel's network")
+	assert.Empty(t, m.Who("nowhere"))
+	assert.Equal(t, map[string]string{"parrot": "https://example.org/parrot.gif"}, m.GetEmojiList())
+}
+
+func TestMirrors(t *testing.T) {
+	m, irc, slack, events := setup(t)
+
+	irc.event(bot.Message, msg.Message{User: &user.User{ID: "al@example.org", Name: "alice"}, Channel: "#cats", Body: "hi", Raw: "!hi"})
+	irc.event(bot.Message, msg.Message{User: &user.User{ID: "al@example.org", Name: "alice"}, Channel: "#cats", Body: "waves", Raw: "waves", Action: true})
+	assert.Len(t, *events, 2, "mirrored messages still reach the bot")
+	assert.Equal(t, []string{
+		"Message C123 [irc] <alice> !hi",
+		"Message C123 [irc] * alice waves",
+	}, slack.sent)
+	assert.Empty(t, irc.sent)
+
+	// what the bot says in one mirrored channel is said in the others
+	slack.sent = nil
+	m.Send(bot.Action, bot.Outgoing{Channel: "slackapp:C123", Text: "purrs"})
+	m.Send(bot.Reply, bot.Outgoing{Channel: "irc:#cats", Text: "yes", ReplyTo: "abc"})
+	m.Send(bot.Reaction, bot.Outgoing{Channel: "irc:#cats", Reaction: "+1", Target: &msg.Message{User: &user.User{ID: "irc:x"}, Channel: "irc:#cats"}})
+	assert.Equal(t, []string{"Action C123 purrs", "Message C123 yes"}, slack.sent)
+	assert.Equal(t, []string{"Action #cats purrs", "Reply #cats yes", "Reaction #cats  (to x in #cats)"}, irc.sent)
+}
@@ -0,0 +1,96 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+package slack
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/velour/catbase/bot"
+	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/config"
+)
+
+// fakeRTM hands out a websocket that sends the given events and then closes
+func fakeRTM(t *testing.T, events ...string) *httptest.Server {
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	mux.HandleFunc("/api/rtm.connect", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer xoxb-test", r.Header.Get("Authorization"))
+		fmt.Fprintf(w, `{"ok":true,"url":"ws%s/rtm","self":{"id":"U0CATBASE"}}`, strings.TrimPrefix(srv.URL, "http"))
+	})
+	mux.HandleFunc("/api/emoji.list", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok":true,"emoji":{}}`))
+	})
+	mux.HandleFunc("/api/users.info", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "U1", r.FormValue("user"))
+		w.Write([]byte(`{"ok":true,"user":{"id":"U1","name":"alice"}}`))
+	})
+	mux.HandleFunc("/rtm", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer conn.Close()
+		for _, ev := range events {
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(ev)); !assert.NoError(t, err) {
+				return
+			}
+		}
+	})
+	return srv
+}
+
+func TestServe(t *testing.T) {
+	ts := fmt.Sprintf("%d.000100", time.Now().Add(time.Minute).Unix())
+	srv := fakeRTM(t,
+		`{"type":"hello"}`,
+		`{"type":"message","channel":"C1","user":"U1","text":"!hi","ts":"1400000000.000100"}`,
+		`{"type":"message","channel":"C1","user":"U1","text":"!hi catbase","ts":"`+ts+`"}`,
+		`{"type":"message","channel":"C1","bot_id":"B0CATBASE","text":"me","ts":"`+ts+`1"}`,
+	)
+	defer srv.Close()
+
+	c := config.ReadConfig(":memory:")
+	c.Set("Nick", "catbase")
+	c.Set("slack.token", "xoxb-test")
+	c.Set("slack.botid", "B0CATBASE")
+	c.Set("slack.apiurl", srv.URL+"/api/")
+	s := New(c)
+	got := []msg.Message{}
+	s.RegisterEvent(func(kind bot.Kind, m msg.Message, args ...interface{}) bool {
+		assert.EqualValues(t, bot.Message, kind)
+		got = append(got, m)
+		return true
+	})
+
+	assert.Error(t, s.Serve(), "Serve returns when the socket closes")
+	assert.Equal(t, "U0CATBASE", s.id)
+	if assert.Len(t, got, 1, "backlog and the bot's own messages are dropped") {
+		assert.Equal(t, "alice", got[0].User.Name)
+		assert.Equal(t, "hi catbase", got[0].Body)
+		assert.True(t, got[0].Command)
+	}
+}
+
+func TestServeConnectFails(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok":false,"error":"invalid_auth"}`))
+	}))
+	defer srv.Close()
+
+	c := config.ReadConfig(":memory:")
+	c.Set("slack.token", "xoxb-test")
+	c.Set("slack.apiurl", srv.URL+"/api/")
+	err := New(c).Serve()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "invalid_auth")
+	}
+}
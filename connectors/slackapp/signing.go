@@ -0,0 +1,54 @@
+package slackapp
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// replayWindow is how far a request's timestamp may be from now,
+// older requests may have been captured and sent again
+const replayWindow = 5 * time.Minute
+
+var errUnsigned = errors.New("missing signature headers")
+
+// verifySignature checks that Slack signed a request body with our signing secret
+// and that the request is recent. See https://api.slack.com/authentication/verifying-requests-from-slack
+func verifySignature(secret string, header http.Header, body []byte, now time.Time) error {
+	signature := header.Get("X-Slack-Signature")
+	stamp := header.Get("X-Slack-Request-Timestamp")
+	if signature == "" || stamp == "" {
+		return errUnsigned
+	}
+
+	ts, err := strconv.ParseInt(stamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("bad timestamp %q", stamp)
+	}
+	age := now.Sub(time.Unix(ts, 0))
+	if age > replayWindow || age < -replayWindow {
+		return fmt.Errorf("timestamp %s is outside the replay window", stamp)
+	}
+
+	if !strings.HasPrefix(signature, "v0=") {
+		return fmt.Errorf("unknown signature version in %q", signature)
+	}
+	given, err := hex.DecodeString(strings.TrimPrefix(signature, "v0="))
+	if err != nil {
+		return fmt.Errorf("bad signature %q", signature)
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:", stamp)
+	mac.Write(body)
+	if !hmac.Equal(given, mac.Sum(nil)) {
+		return errors.New("signature does not match")
+	}
+	return nil
+}
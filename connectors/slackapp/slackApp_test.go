@@ -1,58 +1,119 @@
 package slackapp
 
 import (
-	"container/ring"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/velour/catbase/bot"
+	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/config"
+	"github.com/velour/catbase/connectors/slackcore"
 )
 
-func TestDedupeNoDupes(t *testing.T) {
-	buf := ring.New(3)
-	for i := 0; i < 3; i++ {
-		buf.Value = ""
-		buf = buf.Next()
-	}
-	s := SlackApp{msgIDBuffer: buf}
-	expected := []bool{
-		false,
-		false,
-		false,
-		false,
-		false,
-	}
+// The example request from Slack's documentation on verifying requests
+const (
+	docSecret    = "8f742231b10e8888abcd99yyyzzz85a5"
+	docTimestamp = 1531420618
+	docSignature = "v0=a2114d57b48eac39b9ad189dd8316235a7b4a8d21a10bd27519666489c69b503"
+)
+
+func readTestdata(t *testing.T, name string) []byte {
+	body, err := ioutil.ReadFile("testdata/" + name)
+	assert.NoError(t, err)
+	return body
+}
+
+func signedHeader(secret string, ts int64, body []byte) http.Header {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%d:", ts)
+	mac.Write(body)
+	h := http.Header{}
+	h.Set("X-Slack-Request-Timestamp", strconv.FormatInt(ts, 10))
+	h.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+	return h
+}
+
+func TestVerifySignatureRecorded(t *testing.T) {
+	body := readTestdata(t, "slash_command.txt")
+	h := http.Header{}
+	h.Set("X-Slack-Request-Timestamp", strconv.Itoa(docTimestamp))
+	h.Set("X-Slack-Signature", docSignature)
+	now := time.Unix(docTimestamp+30, 0)
 
-	actuals := []bool{}
-	actuals = append(actuals, s.checkRingOrAdd("a"))
-	actuals = append(actuals, s.checkRingOrAdd("b"))
-	actuals = append(actuals, s.checkRingOrAdd("c"))
-	actuals = append(actuals, s.checkRingOrAdd("d"))
-	actuals = append(actuals, s.checkRingOrAdd("e"))
+	assert.NoError(t, verifySignature(docSecret, h, body, now))
+	assert.Error(t, verifySignature("wrong secret", h, body, now))
+	assert.Error(t, verifySignature(docSecret, h, append(body, '&'), now))
+}
+
+func TestVerifySignatureReplay(t *testing.T) {
+	body := readTestdata(t, "slash_command.txt")
+	h := http.Header{}
+	h.Set("X-Slack-Request-Timestamp", strconv.Itoa(docTimestamp))
+	h.Set("X-Slack-Signature", docSignature)
 
-	assert.ElementsMatch(t, expected, actuals)
+	assert.Error(t, verifySignature(docSecret, h, body, time.Unix(docTimestamp, 0).Add(6*time.Minute)))
+	assert.Error(t, verifySignature(docSecret, h, body, time.Unix(docTimestamp, 0).Add(-6*time.Minute)))
+	assert.Equal(t, errUnsigned, verifySignature(docSecret, http.Header{}, body, time.Now()))
 }
 
-func TestDedupeWithDupes(t *testing.T) {
-	buf := ring.New(3)
-	for i := 0; i < 3; i++ {
-		buf.Value = ""
-		buf = buf.Next()
+func serveEvent(s *SlackApp, h http.Header, body []byte) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("POST", "/evt", bytes.NewReader(body))
+	for k, v := range h {
+		r.Header[k] = v
 	}
-	s := SlackApp{msgIDBuffer: buf}
-	expected := []bool{
-		false,
-		false,
-		true,
-		false,
-		true,
+	w := httptest.NewRecorder()
+	s.serveEvent(w, r)
+	return w
+}
+
+func TestServeEventChallenge(t *testing.T) {
+	s := &SlackApp{signingSecret: docSecret}
+	body := readTestdata(t, "url_verification.json")
+
+	w := serveEvent(s, signedHeader(docSecret, time.Now().Unix(), body), body)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "3eZbrw1aBm2rZgRNFdxV2595E9CY3gmdALWMmHkvFXO7tYXAYM8P", w.Body.String())
+}
+
+func TestServeEventRejectsEarly(t *testing.T) {
+	c := config.ReadConfig(":memory:")
+	c.Set("slack.token", "xoxb-test")
+	c.Set("slack.botid", "B0CATBASE")
+	s := &SlackApp{Core: slackcore.New(c), signingSecret: docSecret}
+	s.RegisterEvent(func(bot.Kind, msg.Message, ...interface{}) bool {
+		t.Error("the bot's own message should be dropped")
+		return true
+	})
+	body := readTestdata(t, "bot_message.json")
+
+	for name, h := range map[string]http.Header{
+		"unsigned":     {},
+		"wrong secret": signedHeader("nope", time.Now().Unix(), body),
+		"replayed":     signedHeader(docSecret, time.Now().Add(-time.Hour).Unix(), body),
+	} {
+		w := serveEvent(s, h, body)
+		assert.Equal(t, 401, w.Code, name)
 	}
+	assert.False(t, s.Seen("1355517523.000005"), "rejected events should not be looked at")
 
-	actuals := []bool{}
-	actuals = append(actuals, s.checkRingOrAdd("a"))
-	actuals = append(actuals, s.checkRingOrAdd("b"))
-	actuals = append(actuals, s.checkRingOrAdd("a"))
-	actuals = append(actuals, s.checkRingOrAdd("d"))
-	actuals = append(actuals, s.checkRingOrAdd("d"))
+	w := serveEvent(s, signedHeader(docSecret, time.Now().Unix(), body), body)
+	assert.Equal(t, 200, w.Code)
+}
 
-	assert.ElementsMatch(t, expected, actuals)
+func TestServeEventBadBody(t *testing.T) {
+	s := &SlackApp{signingSecret: docSecret}
+	body := []byte("not json")
+	w := serveEvent(s, signedHeader(docSecret, time.Now().Unix(), body), body)
+	assert.Equal(t, 400, w.Code)
 }
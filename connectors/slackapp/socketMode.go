@@ -0,0 +1,119 @@
+package slackapp
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/nlopes/slack/slackevents"
+
+	"github.com/velour/catbase/config"
+)
+
+// SocketMode is a SlackApp that gets its events over a websocket it opens
+// itself, so catbase can run somewhere Slack can't reach /evt
+type SocketMode struct {
+	*SlackApp
+
+	appToken string
+	// retry is how long to wait before reconnecting after a connection drops
+	retry time.Duration
+}
+
+func init() {
+	config.Register(
+		config.Key{Name: "slack.apptoken", Description: "app level token with connections:write, for socket mode", Secret: true},
+	)
+}
+
+func NewSocketMode(c *config.Config) *SocketMode {
+	token := c.Get("slack.apptoken", "")
+	if token == "" {
+		log.Fatalf("No slack app token found. Set SLACKAPPTOKEN env.")
+	}
+	return &SocketMode{
+		SlackApp: New(c),
+		appToken: token,
+		retry:    5 * time.Second,
+	}
+}
+
+func (s *SocketMode) Serve() error {
+	s.Start()
+	go s.run()
+	return nil
+}
+
+// run keeps a socket open for as long as the bot runs
+func (s *SocketMode) run() {
+	for {
+		if err := s.connect(); err != nil {
+			log.Printf("Socket mode connection lost: %s", err)
+		}
+		time.Sleep(s.retry)
+	}
+}
+
+// socketEnvelope is a message from Slack over the socket
+type socketEnvelope struct {
+	Type         string          `json:"type"`
+	EnvelopeID   string          `json:"envelope_id"`
+	RetryAttempt int             `json:"retry_attempt"`
+	Reason       string          `json:"reason"`
+	Payload      json.RawMessage `json:"payload"`
+}
+
+// openConnection asks Slack for a websocket URL to connect to
+func (s *SocketMode) openConnection() (string, error) {
+	var r struct {
+		URL string `json:"url"`
+	}
+	err := s.APIAs(s.appToken, "apps.connections.open", nil, &r)
+	return r.URL, err
+}
+
+// connect opens one socket and handles envelopes until Slack asks for a
+// reconnect or the connection breaks
+func (s *SocketMode) connect() error {
+	url, err := s.openConnection()
+	if err != nil {
+		return err
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	for {
+		var env socketEnvelope
+		if err := conn.ReadJSON(&env); err != nil {
+			return err
+		}
+		// Slack sends envelopes again if they aren't acknowledged within
+		// a few seconds, so do that before anything slow
+		if env.EnvelopeID != "" {
+			if err := conn.WriteJSON(map[string]string{"envelope_id": env.EnvelopeID}); err != nil {
+				return err
+			}
+		}
+
+		switch env.Type {
+		case "hello":
+			log.Println("Connected to slack in socket mode")
+		case "disconnect":
+			log.Printf("Slack asked for a reconnect: %s", env.Reason)
+			return nil
+		case "events_api":
+			ev, err := slackevents.ParseEvent(env.Payload, slackevents.OptionNoVerifyToken())
+			if err != nil {
+				log.Printf("Could not parse socket mode event: %s", err)
+				continue
+			}
+			s.handleEvent(ev)
+		default:
+			log.Printf("Unhandled socket mode envelope: %s", env.Type)
+		}
+	}
+}
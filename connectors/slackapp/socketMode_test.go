@@ -0,0 +1,118 @@
+package slackapp
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/velour/catbase/bot"
+	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/config"
+	"github.com/velour/catbase/connectors/slackcore"
+)
+
+// fakeSocketMode replays the envelopes in testdata/socket_mode.jsonl to
+// whoever connects and records the acknowledgements it gets back
+func fakeSocketMode(t *testing.T, acks chan<- string) *httptest.Server {
+	envelopes := bytes.Split(bytes.TrimSpace(readTestdata(t, "socket_mode.jsonl")), []byte("\n"))
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	mux.HandleFunc("/api/apps.connections.open", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer xapp-test", r.Header.Get("Authorization"))
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"ok":  true,
+			"url": "ws" + strings.TrimPrefix(srv.URL, "http") + "/link",
+		})
+	})
+	mux.HandleFunc("/api/users.info", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer xoxb-test", r.Header.Get("Authorization"))
+		assert.Equal(t, "U2147483697", r.FormValue("user"))
+		w.Write([]byte(`{"ok":true,"user":{"id":"U2147483697","name":"alice"}}`))
+	})
+	mux.HandleFunc("/link", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer conn.Close()
+		for _, env := range envelopes {
+			if err := conn.WriteMessage(websocket.TextMessage, env); !assert.NoError(t, err) {
+				return
+			}
+			var e socketEnvelope
+			json.Unmarshal(env, &e)
+			if e.EnvelopeID == "" {
+				continue
+			}
+			var ack map[string]string
+			if err := conn.ReadJSON(&ack); !assert.NoError(t, err) {
+				return
+			}
+			acks <- ack["envelope_id"]
+		}
+	})
+	return srv
+}
+
+func newTestSocketMode(apiURL string) *SocketMode {
+	c := config.ReadConfig(":memory:")
+	c.Set("Nick", "catbase")
+	c.Set("slack.token", "xoxb-test")
+	c.Set("slack.apiurl", apiURL)
+	return &SocketMode{
+		SlackApp: &SlackApp{Core: slackcore.New(c)},
+		appToken: "xapp-test",
+	}
+}
+
+func TestSocketModeReplay(t *testing.T) {
+	acks := make(chan string, 10)
+	srv := fakeSocketMode(t, acks)
+	defer srv.Close()
+
+	s := newTestSocketMode(srv.URL + "/api/")
+	got := []msg.Message{}
+	s.RegisterEvent(func(kind bot.Kind, m msg.Message, args ...interface{}) bool {
+		assert.EqualValues(t, bot.Message, kind)
+		got = append(got, m)
+		return true
+	})
+
+	assert.NoError(t, s.connect(), "a disconnect envelope ends the connection cleanly")
+	close(acks)
+
+	ids := []string{}
+	for id := range acks {
+		ids = append(ids, id)
+	}
+	assert.Equal(t, []string{
+		"dbdd0ef3-1543-4f94-bfb4-133d0e6c1545",
+		"b6b2f0a1-6a8e-4a2b-8f0c-0c1c2d3e4f50",
+	}, ids, "every envelope is acknowledged, retries too")
+
+	if assert.Len(t, got, 1, "the retried envelope is deduplicated") {
+		assert.Equal(t, "alice", got[0].User.Name)
+		assert.Equal(t, "C2147483705", got[0].Channel)
+		assert.True(t, got[0].Command)
+		assert.Equal(t, "hello catbase", got[0].Body)
+	}
+}
+
+func TestSocketModeOpenFails(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok":false,"error":"invalid_auth"}`))
+	}))
+	defer srv.Close()
+
+	s := newTestSocketMode(srv.URL + "/api/")
+	err := s.connect()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "invalid_auth")
+	}
+}
@@ -1,4 +1,4 @@
-package slackapp
+package slackcore
 
 import (
 	"unicode/utf8"
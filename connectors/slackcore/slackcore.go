@@ -0,0 +1,462 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+// Package slackcore is the part of the bot's Slack support that doesn't
+// depend on how events arrive. It talks to the Web API, sends messages and
+// turns Slack messages into msg.Messages; the slack (RTM) and slackapp
+// (Events API) connectors are transports on top of it.
+package slackcore
+
+import (
+	"container/ring"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/velour/catbase/bot"
+	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/bot/user"
+	"github.com/velour/catbase/config"
+)
+
+// RawTS is where the Slack timestamp, which doubles as the message ID,
+// is kept in a msg.Message
+const RawTS = "RAW_SLACK_TIMESTAMP"
+
+// RawBotID is where the bot_id of a message posted by an app is kept
+const RawBotID = "RAW_SLACK_BOT_ID"
+
+// Core is the state shared by every Slack transport
+type Core struct {
+	config *config.Config
+	client *http.Client
+
+	// apiURL is the base of the Web API, tests point it at a fake
+	apiURL    string
+	token     string
+	userToken string
+
+	lastRecieved time.Time
+	// myBotID and myUserID are who our own posts come from
+	myBotID  string
+	myUserID string
+
+	// mu guards users and msgIDBuffer
+	mu          sync.Mutex
+	users       map[string]string
+	msgIDBuffer *ring.Ring
+
+	emoji map[string]string
+
+	event bot.Callback
+}
+
+// Message is an incoming Slack message, however it arrived
+type Message struct {
+	Channel  string `json:"channel"`
+	User     string `json:"user"`
+	Username string `json:"username"`
+	Text     string `json:"text"`
+	SubType  string `json:"subtype"`
+	BotID    string `json:"bot_id"`
+	Hidden   bool   `json:"hidden"`
+	TS       string `json:"ts"`
+	ThreadTS string `json:"thread_ts"`
+}
+
+func init() {
+	config.Register(
+		config.Key{Name: "slack.token", Description: "bot token", Secret: true},
+		config.Key{Name: "slack.usertoken", Description: "user token for the emoji list and channel members, the bot token is used if unset", Secret: true},
+		config.Key{Name: "slack.apiurl", Default: "https://slack.com/api/", Description: "base URL of the Slack Web API"},
+		config.Key{Name: "slack.botid", Description: "bot ID, to ignore its own messages, asked of Slack at start if unset"},
+		config.Key{Name: "IconURL", Default: "https://placekitten.com/128/128", Description: "avatar for the bot's messages"},
+		config.Key{Name: "ringSize", Type: config.Int, Default: "5", Description: "recent event IDs kept to drop duplicates"},
+	)
+}
+
+func New(c *config.Config) *Core {
+	token := c.Get("slack.token", "NONE")
+	if token == "NONE" {
+		log.Fatalf("No slack token found. Set SLACKTOKEN env.")
+	}
+	userToken := c.Get("slack.usertoken", "NONE")
+	if userToken == "NONE" {
+		userToken = token
+	}
+	apiURL := c.Get("slack.apiurl", "")
+	if !strings.HasSuffix(apiURL, "/") {
+		apiURL += "/"
+	}
+
+	idBuf := ring.New(c.GetInt("ringSize", 0))
+	for i := 0; i < idBuf.Len(); i++ {
+		idBuf.Value = ""
+		idBuf = idBuf.Next()
+	}
+
+	return &Core{
+		config:      c,
+		client:      &http.Client{Timeout: time.Minute},
+		apiURL:      apiURL,
+		token:       token,
+		userToken:   userToken,
+		myBotID:     c.Get("slack.botid", ""),
+		users:       make(map[string]string),
+		msgIDBuffer: idBuf,
+		emoji:       make(map[string]string),
+	}
+}
+
+// Start readies the core for events, anything sent before it is backlog
+func (c *Core) Start() {
+	c.identify()
+	c.populateEmojiList()
+	c.lastRecieved = time.Now()
+}
+
+// Config is the bot's configuration
+func (c *Core) Config() *config.Config {
+	return c.config
+}
+
+func (c *Core) RegisterEvent(f bot.Callback) {
+	c.event = f
+}
+
+// API calls a Web API method with the bot token
+func (c *Core) API(method string, params url.Values, out interface{}) error {
+	return c.APIAs(c.token, method, params, out)
+}
+
+// APIAs calls a Web API method with the given token and decodes the
+// response into out if it isn't nil. Responses that aren't ok are errors.
+func (c *Core) APIAs(token, method string, params url.Values, out interface{}) error {
+	req, err := http.NewRequest("POST", c.apiURL+method, strings.NewReader(params.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("Error reading Slack API body: %s", err)
+	}
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("slack %s: %s", method, resp.Status)
+	}
+
+	var status struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &status); err != nil {
+		return fmt.Errorf("Error parsing %s response: %s", method, err)
+	}
+	if !status.OK {
+		return fmt.Errorf("slack %s: %s", method, status.Error)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(body, out)
+}
+
+func (c *Core) Send(kind bot.Kind, out bot.Outgoing) (string, error) {
+	switch kind {
+	case bot.Message:
+		return c.sendMessage(out.Channel, out.Text, out.ThreadID, false)
+	case bot.Action:
+		// chat.meMessage can't post in a thread, so there actions are
+		// ordinary messages in italics
+		return c.sendMessage(out.Channel, "_"+out.Text+"_", out.ThreadID, out.ThreadID == "")
+	case bot.Edit:
+		return c.edit(out.Channel, out.Text, out.EditID)
+	case bot.Reply:
+		switch {
+		case out.ReplyTo != "":
+			return c.sendMessage(out.Channel, out.Text, out.ReplyTo, false)
+		case out.Target != nil:
+			return c.sendMessage(out.Channel, out.Text, out.Target.AdditionalData[RawTS], false)
+		}
+		return "", fmt.Errorf("Reply needs an identifier or message to reply to")
+	case bot.Reaction:
+		if out.Target == nil {
+			return "", fmt.Errorf("Reaction needs a message to react to")
+		}
+		return c.react(out.Channel, out.Reaction, *out.Target)
+	}
+	return "", fmt.Errorf("%w: Slack cannot send %s", bot.ErrUnsupported, kind)
+}
+
+// sendMessage posts a message, in a thread if threadTS is set
+func (c *Core) sendMessage(channel, message, threadTS string, meMessage bool) (string, error) {
+	log.Printf("Sending message to %s: %s", channel, message)
+	method := "chat.postMessage"
+	if meMessage {
+		method = "chat.meMessage"
+	}
+	params := url.Values{
+		"username": {c.config.Get("Nick", "")},
+		"icon_url": {c.config.Get("IconURL", "")},
+		"channel":  {channel},
+		"text":     {message},
+	}
+	if threadTS != "" {
+		params.Set("thread_ts", threadTS)
+	}
+
+	var mr struct {
+		Timestamp string `json:"ts"`
+		Message   struct {
+			BotID string `json:"bot_id"`
+		} `json:"message"`
+	}
+	if err := c.API(method, params, &mr); err != nil {
+		log.Printf("Error sending Slack message: %s", err)
+		return "", err
+	}
+	if mr.Message.BotID != "" {
+		c.mu.Lock()
+		c.myBotID = mr.Message.BotID
+		c.mu.Unlock()
+	}
+	return mr.Timestamp, nil
+}
+
+func (c *Core) react(channel, reaction string, message msg.Message) (string, error) {
+	log.Printf("Reacting in %s: %s", channel, reaction)
+	err := c.API("reactions.add", url.Values{
+		"name":      {reaction},
+		"channel":   {channel},
+		"timestamp": {message.AdditionalData[RawTS]},
+	}, nil)
+	return "", err
+}
+
+func (c *Core) edit(channel, newMessage, identifier string) (string, error) {
+	log.Printf("Editing in (%s) %s: %s", identifier, channel, newMessage)
+	var mr struct {
+		Timestamp string `json:"ts"`
+	}
+	err := c.API("chat.update", url.Values{
+		"channel": {channel},
+		"text":    {newMessage},
+		"ts":      {identifier},
+	}, &mr)
+	return mr.Timestamp, err
+}
+
+// identify asks Slack who the token belongs to, so our own posts can be
+// told apart from a user who shares our name
+func (c *Core) identify() {
+	var auth struct {
+		UserID string `json:"user_id"`
+		BotID  string `json:"bot_id"`
+	}
+	if err := c.API("auth.test", nil, &auth); err != nil {
+		log.Printf("Error asking Slack who I am: %s", err)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.myUserID = auth.UserID
+	if c.myBotID == "" {
+		c.myBotID = auth.BotID
+	}
+}
+
+// FromMe matches a message on the bot and user IDs we post as
+func (c *Core) FromMe(m msg.Message) (bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if id := m.AdditionalData[RawBotID]; id != "" && c.myBotID != "" {
+		return id == c.myBotID, true
+	}
+	if m.User != nil && m.User.ID != "" && c.myUserID != "" {
+		return m.User.ID == c.myUserID, true
+	}
+	return false, false
+}
+
+func (c *Core) GetEmojiList() map[string]string {
+	return c.emoji
+}
+
+func (c *Core) populateEmojiList() {
+	var list struct {
+		Emoji map[string]string `json:"emoji"`
+	}
+	if err := c.APIAs(c.userToken, "emoji.list", nil, &list); err != nil {
+		log.Printf("Error retrieving emoji list from Slack: %s", err)
+		return
+	}
+	c.emoji = list.Emoji
+}
+
+// Seen reports whether a message with this timestamp was already received,
+// remembering it if not. Slack sends events again when it isn't sure they
+// arrived.
+func (c *Core) Seen(ts string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	found := false
+	c.msgIDBuffer.Do(func(p interface{}) {
+		if p.(string) == ts {
+			found = true
+		}
+	})
+	if found {
+		return true
+	}
+	c.msgIDBuffer.Value = ts
+	c.msgIDBuffer = c.msgIDBuffer.Next()
+	return false
+}
+
+// Receive hands a message from a transport to the bot
+func (c *Core) Receive(m Message) {
+	if c.Seen(m.TS) {
+		log.Printf("Got a duplicate message from server: %s", m.TS)
+		return
+	}
+	c.mu.Lock()
+	isItMe := (m.BotID != "" && m.BotID == c.myBotID) || (m.User != "" && m.User == c.myUserID)
+	c.mu.Unlock()
+	switch {
+	case isItMe || m.Hidden:
+		log.Printf("THAT MESSAGE WAS HIDDEN: %+v", m.TS)
+	case m.ThreadTS != "":
+		//we're throwing away some information here by not parsing the correct reply object type, but that's okay
+		c.event(bot.Reply, c.buildMessage(m), m.ThreadTS)
+	default:
+		msg := c.buildMessage(m)
+		if msg.Time.Before(c.lastRecieved) {
+			log.Printf("Ignoring message: lastRecieved: %v msg: %v", c.lastRecieved, msg.Time)
+			return
+		}
+		c.lastRecieved = msg.Time
+		c.event(bot.Message, msg)
+	}
+}
+
+// I think it's horseshit that I have to do this
+func slackTStoTime(t string) time.Time {
+	ts := strings.SplitN(t, ".", 2)
+	sec, _ := strconv.ParseInt(ts[0], 10, 64)
+	var nsec int64
+	if len(ts) > 1 {
+		nsec, _ = strconv.ParseInt(ts[1], 10, 64)
+	}
+	return time.Unix(sec, nsec)
+}
+
+// Convert a Message to a msg.Message
+func (c *Core) buildMessage(m Message) msg.Message {
+	text := html.UnescapeString(m.Text)
+
+	text = fixText(c.getUser, text)
+
+	isCmd, text := bot.IsCmd(c.config, text)
+
+	isAction := m.SubType == "me_message"
+
+	u, _ := c.getUser(m.User)
+	if m.Username != "" {
+		u = m.Username
+	}
+
+	// Slack threads are flat, everything in one answers its first message,
+	// which carries its own ts as thread_ts
+	thread := m.ThreadTS
+	if thread == m.TS {
+		thread = ""
+	}
+
+	data := map[string]string{
+		RawTS: m.TS,
+	}
+	if m.BotID != "" {
+		data[RawBotID] = m.BotID
+	}
+
+	return msg.Message{
+		User: &user.User{
+			ID:   m.User,
+			Name: u,
+		},
+		Body:           text,
+		Raw:            m.Text,
+		Channel:        m.Channel,
+		Command:        isCmd,
+		Action:         isAction,
+		Time:           slackTStoTime(m.TS),
+		AdditionalData: data,
+		ID:             m.TS,
+		ThreadID:       thread,
+		ParentID:       thread,
+	}
+}
+
+// Get username for Slack user ID
+func (c *Core) getUser(id string) (string, error) {
+	c.mu.Lock()
+	name, ok := c.users[id]
+	c.mu.Unlock()
+	if ok {
+		return name, nil
+	}
+
+	log.Printf("User %s not already found, requesting info", id)
+	var userInfo struct {
+		User struct {
+			Name string `json:"name"`
+		} `json:"user"`
+	}
+	if err := c.API("users.info", url.Values{"user": {id}}, &userInfo); err != nil {
+		return "UNKNOWN", err
+	}
+	c.mu.Lock()
+	c.users[id] = userInfo.User.Name
+	c.mu.Unlock()
+	return userInfo.User.Name, nil
+}
+
+// Who gets usernames out of a channel
+func (c *Core) Who(id string) []string {
+	log.Println("Who is queried for ", id)
+	var members struct {
+		Members []string `json:"members"`
+	}
+	err := c.APIAs(c.userToken, "conversations.members", url.Values{
+		"channel": {id},
+		"limit":   {"200"},
+	}, &members)
+	if err != nil {
+		log.Println(err)
+		return []string{}
+	}
+
+	handles := []string{}
+	for _, m := range members.Members {
+		u, err := c.getUser(m)
+		if err != nil {
+			log.Printf("Couldn't get user %s: %s", m, err)
+			continue
+		}
+		handles = append(handles, u)
+	}
+	return handles
+}
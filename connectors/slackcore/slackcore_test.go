@@ -0,0 +1,274 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+package slackcore
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/velour/catbase/bot"
+	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/bot/user"
+	"github.com/velour/catbase/config"
+)
+
+// webAPI is a local stand in for the Slack Web API that records the
+// methods it is called with
+type webAPI struct {
+	*httptest.Server
+	t *testing.T
+
+	mu       sync.Mutex
+	requests []string
+}
+
+func newWebAPI(t *testing.T) *webAPI {
+	a := &webAPI{t: t}
+	a.Server = httptest.NewServer(http.HandlerFunc(a.serve))
+	return a
+}
+
+func (a *webAPI) serve(w http.ResponseWriter, r *http.Request) {
+	method := strings.TrimPrefix(r.URL.Path, "/api/")
+	r.ParseForm()
+	switch method {
+	case "emoji.list", "conversations.members":
+		assert.Equal(a.t, "Bearer xoxp-test", r.Header.Get("Authorization"), method)
+	default:
+		assert.Equal(a.t, "Bearer xoxb-test", r.Header.Get("Authorization"), method)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if method != "users.info" {
+		a.requests = append(a.requests, method+" "+r.PostForm.Encode())
+	}
+	switch method {
+	case "chat.postMessage", "chat.meMessage":
+		w.Write([]byte(`{"ok":true,"channel":"C1","ts":"1500000000.000200","message":{"bot_id":"B0CATBASE"}}`))
+	case "chat.update":
+		w.Write([]byte(`{"ok":true,"channel":"C1","ts":"1500000000.000100"}`))
+	case "reactions.add":
+		w.Write([]byte(`{"ok":true}`))
+	case "auth.test":
+		w.Write([]byte(`{"ok":true,"user_id":"U0CATBASE","bot_id":"B0CATBASE"}`))
+	case "emoji.list":
+		w.Write([]byte(`{"ok":true,"emoji":{"catbase":"https://example.com/catbase.png"}}`))
+	case "users.info":
+		switch r.PostForm.Get("user") {
+		case "U1":
+			w.Write([]byte(`{"ok":true,"user":{"id":"U1","name":"alice"}}`))
+		case "U2":
+			w.Write([]byte(`{"ok":true,"user":{"id":"U2","name":"bob"}}`))
+		default:
+			w.Write([]byte(`{"ok":false,"error":"user_not_found"}`))
+		}
+	case "conversations.members":
+		w.Write([]byte(`{"ok":true,"members":["U1","U2","U404"]}`))
+	default:
+		w.Write([]byte(`{"ok":false,"error":"unknown_method"}`))
+	}
+}
+
+func (a *webAPI) sent() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.requests
+}
+
+func newTestCore(a *webAPI) *Core {
+	c := config.ReadConfig(":memory:")
+	c.Set("Nick", "catbase")
+	c.Set("IconURL", "https://example.com/icon.png")
+	c.Set("slack.token", "xoxb-test")
+	c.Set("slack.usertoken", "xoxp-test")
+	c.Set("slack.apiurl", a.URL+"/api")
+	c.Set("ringSize", "3")
+	return New(c)
+}
+
+type received struct {
+	kind bot.Kind
+	msg  msg.Message
+	args []interface{}
+}
+
+func record(c *Core) *[]received {
+	got := &[]received{}
+	c.RegisterEvent(func(kind bot.Kind, m msg.Message, args ...interface{}) bool {
+		*got = append(*got, received{kind, m, args})
+		return true
+	})
+	return got
+}
+
+func TestSend(t *testing.T) {
+	a := newWebAPI(t)
+	defer a.Close()
+	c := newTestCore(a)
+	target := msg.Message{AdditionalData: map[string]string{RawTS: "1500000000.000100"}}
+
+	id, err := c.Send(bot.Message, bot.Outgoing{Channel: "C1", Text: "hi"})
+	assert.NoError(t, err)
+	assert.Equal(t, "1500000000.000200", id)
+	assert.Equal(t, "B0CATBASE", c.myBotID, "the bot learns its ID from what it sends")
+
+	_, err = c.Send(bot.Action, bot.Outgoing{Channel: "C1", Text: "waves"})
+	assert.NoError(t, err)
+	_, err = c.Send(bot.Action, bot.Outgoing{Channel: "C1", Text: "waves back", ThreadID: "1500000000.000100"})
+	assert.NoError(t, err)
+	_, err = c.Send(bot.Message, bot.Outgoing{Channel: "C1", Text: "in a thread", ThreadID: "1500000000.000100"})
+	assert.NoError(t, err)
+	_, err = c.Send(bot.Reply, bot.Outgoing{Channel: "C1", Text: "to you", Target: &target})
+	assert.NoError(t, err)
+	id, err = c.Send(bot.Edit, bot.Outgoing{Channel: "C1", Text: "fixed", EditID: "1500000000.000100"})
+	assert.NoError(t, err)
+	assert.Equal(t, "1500000000.000100", id)
+	_, err = c.Send(bot.Reaction, bot.Outgoing{Channel: "C1", Reaction: "catbase", Target: &target})
+	assert.NoError(t, err)
+
+	_, err = c.Send(bot.Reply, bot.Outgoing{Channel: "C1", Text: "to nobody"})
+	assert.Error(t, err)
+	_, err = c.Send(bot.Reaction, bot.Outgoing{Channel: "C1", Reaction: "catbase"})
+	assert.Error(t, err)
+	_, err = c.Send(bot.Help, bot.Outgoing{Channel: "C1"})
+	assert.True(t, errors.Is(err, bot.ErrUnsupported))
+
+	assert.Equal(t, []string{
+		"chat.postMessage channel=C1&icon_url=https%3A%2F%2Fexample.com%2Ficon.png&text=hi&username=catbase",
+		"chat.meMessage channel=C1&icon_url=https%3A%2F%2Fexample.com%2Ficon.png&text=_waves_&username=catbase",
+		"chat.postMessage channel=C1&icon_url=https%3A%2F%2Fexample.com%2Ficon.png&text=_waves+back_&thread_ts=1500000000.000100&username=catbase",
+		"chat.postMessage channel=C1&icon_url=https%3A%2F%2Fexample.com%2Ficon.png&text=in+a+thread&thread_ts=1500000000.000100&username=catbase",
+		"chat.postMessage channel=C1&icon_url=https%3A%2F%2Fexample.com%2Ficon.png&text=to+you&thread_ts=1500000000.000100&username=catbase",
+		"chat.update channel=C1&text=fixed&ts=1500000000.000100",
+		"reactions.add channel=C1&name=catbase&timestamp=1500000000.000100",
+	}, a.sent())
+}
+
+func TestAPIError(t *testing.T) {
+	a := newWebAPI(t)
+	defer a.Close()
+	c := newTestCore(a)
+
+	err := c.API("chat.unknown", nil, nil)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "unknown_method")
+	}
+}
+
+func TestStartAndWho(t *testing.T) {
+	a := newWebAPI(t)
+	defer a.Close()
+	c := newTestCore(a)
+
+	self, known := c.FromMe(msg.Message{User: &user.User{ID: "U0CATBASE", Name: "catbase"}})
+	assert.False(t, known, "nothing is known about us before Start")
+
+	c.Start()
+	assert.Equal(t, map[string]string{"catbase": "https://example.com/catbase.png"}, c.GetEmojiList())
+	assert.Equal(t, "U0CATBASE", c.myUserID)
+	assert.Equal(t, "B0CATBASE", c.myBotID)
+
+	self, known = c.FromMe(msg.Message{User: &user.User{ID: "U0CATBASE", Name: "Cat Base"}})
+	assert.True(t, self && known)
+	self, known = c.FromMe(msg.Message{User: &user.User{ID: "U2", Name: "catbase"}})
+	assert.True(t, !self && known, "a user with our name isn't us")
+	self, known = c.FromMe(msg.Message{User: &user.User{}, AdditionalData: map[string]string{RawBotID: "B0CATBASE"}})
+	assert.True(t, self && known)
+
+	who := c.Who("C1")
+	sort.Strings(who)
+	assert.Equal(t, []string{"alice", "bob"}, who, "unknown users are left out")
+}
+
+func TestReceive(t *testing.T) {
+	a := newWebAPI(t)
+	defer a.Close()
+	c := newTestCore(a)
+	c.myBotID = "B0CATBASE"
+	got := record(c)
+
+	c.Receive(Message{Channel: "C1", User: "U1", Text: "!hi <@U2> see <https://example.com|example.com> &amp; more", TS: "1500000000.000100"})
+	c.Receive(Message{Channel: "C1", User: "U1", Text: "!hi again", TS: "1500000000.000100"})
+	c.Receive(Message{Channel: "C1", User: "U1", Text: "waves", SubType: "me_message", TS: "1500000001.000100"})
+	c.Receive(Message{Channel: "C1", BotID: "B0CATBASE", Text: "me", TS: "1500000002.000100"})
+	c.Receive(Message{Channel: "C1", User: "U2", Username: "bobbot", Text: "old", TS: "1400000000.000100"})
+	c.Receive(Message{Channel: "C1", User: "U2", Text: "in a thread", TS: "1500000003.000100", ThreadTS: "1500000000.000100"})
+	c.Receive(Message{Channel: "C1", BotID: "B0CATBASE", Text: "me in a thread", TS: "1500000004.000100", ThreadTS: "1500000000.000100"})
+
+	if assert.Len(t, *got, 3) {
+		m := (*got)[0]
+		assert.EqualValues(t, bot.Message, m.kind)
+		assert.Equal(t, "alice", m.msg.User.Name)
+		assert.Equal(t, "U1", m.msg.User.ID)
+		assert.Equal(t, "C1", m.msg.Channel)
+		assert.True(t, m.msg.Command)
+		assert.Equal(t, "hi bob see https://example.com & more", m.msg.Body)
+		assert.Equal(t, "1500000000.000100", m.msg.AdditionalData[RawTS])
+		assert.Equal(t, time.Unix(1500000000, 100), m.msg.Time)
+		assert.Equal(t, "1500000000.000100", m.msg.ID)
+		assert.Equal(t, "", m.msg.ThreadID)
+
+		assert.True(t, (*got)[1].msg.Action)
+
+		m = (*got)[2]
+		assert.EqualValues(t, bot.Reply, m.kind)
+		assert.Equal(t, "bob", m.msg.User.Name)
+		assert.Equal(t, []interface{}{"1500000000.000100"}, m.args)
+		assert.Equal(t, "1500000003.000100", m.msg.ID)
+		assert.Equal(t, "1500000000.000100", m.msg.ThreadID)
+		assert.Equal(t, "1500000000.000100", m.msg.ParentID)
+	}
+}
+
+func TestDedupeNoDupes(t *testing.T) {
+	a := newWebAPI(t)
+	defer a.Close()
+	c := newTestCore(a)
+	expected := []bool{
+		false,
+		false,
+		false,
+		false,
+		false,
+	}
+
+	actuals := []bool{}
+	actuals = append(actuals, c.Seen("a"))
+	actuals = append(actuals, c.Seen("b"))
+	actuals = append(actuals, c.Seen("c"))
+	actuals = append(actuals, c.Seen("d"))
+	actuals = append(actuals, c.Seen("e"))
+
+	assert.ElementsMatch(t, expected, actuals)
+}
+
+func TestDedupeWithDupes(t *testing.T) {
+	a := newWebAPI(t)
+	defer a.Close()
+	c := newTestCore(a)
+	expected := []bool{
+		false,
+		false,
+		true,
+		false,
+		true,
+	}
+
+	actuals := []bool{}
+	actuals = append(actuals, c.Seen("a"))
+	actuals = append(actuals, c.Seen("b"))
+	actuals = append(actuals, c.Seen("a"))
+	actuals = append(actuals, c.Seen("d"))
+	actuals = append(actuals, c.Seen("d"))
+
+	assert.ElementsMatch(t, expected, actuals)
+}
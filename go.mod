@@ -1,13 +1,17 @@
 module github.com/velour/catbase
 
+go 1.16
+
 require (
+	github.com/BurntSushi/toml v0.3.1
 	github.com/PuerkitoBio/goquery v1.5.0 // indirect
 	github.com/boltdb/bolt v1.3.1
 	github.com/chrissexton/leftpad v0.0.0-20181207133115-1e93189d2fff
 	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/go-sql-driver/mysql v1.4.1 // indirect
-	github.com/gorilla/websocket v1.4.0 // indirect
+	github.com/go-sql-driver/mysql v1.5.0
+	github.com/gorilla/websocket v1.4.0
 	github.com/jmoiron/sqlx v1.2.0
+	github.com/lib/pq v1.0.0
 	github.com/mattn/go-sqlite3 v1.10.0
 	github.com/mitchellh/mapstructure v1.1.2 // indirect
 	github.com/mmcdole/gofeed v1.0.0-beta2
@@ -4,14 +4,21 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
 	"math/rand"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/velour/catbase/bot"
+	"github.com/velour/catbase/bot/migrate"
 	"github.com/velour/catbase/config"
+	"github.com/velour/catbase/connectors/cli"
+	"github.com/velour/catbase/connectors/discord"
 	"github.com/velour/catbase/connectors/irc"
+	"github.com/velour/catbase/connectors/matrix"
+	"github.com/velour/catbase/connectors/multi"
 	"github.com/velour/catbase/connectors/slack"
 	"github.com/velour/catbase/connectors/slackapp"
 	"github.com/velour/catbase/plugins/admin"
@@ -24,6 +31,7 @@ import (
 	"github.com/velour/catbase/plugins/emojifyme"
 	"github.com/velour/catbase/plugins/fact"
 	"github.com/velour/catbase/plugins/first"
+	"github.com/velour/catbase/plugins/history"
 	"github.com/velour/catbase/plugins/inventory"
 	"github.com/velour/catbase/plugins/leftpad"
 	"github.com/velour/catbase/plugins/nerdepedia"
@@ -45,6 +53,16 @@ var (
 	key    = flag.String("set", "", "Configuration key to set")
 	val    = flag.String("val", "", "Configuration value to set")
 	initDB = flag.Bool("init", false, "Initialize the configuration DB")
+
+	cfgFile   = flag.String("config", "", "TOML file whose settings override the configuration DB")
+	exportCfg = flag.String("export-config", "", "Write the configuration DB to a TOML file and exit")
+	exportSec = flag.Bool("export-secrets", false, "Include secret keys such as tokens in -export-config")
+	importCfg = flag.String("import-config", "", "Store the settings in a TOML file in the configuration DB and exit")
+
+	migrateStatus = flag.Bool("migrate-status", false, "Show which plugin schema migrations have been applied and exit")
+
+	dbDriver = flag.String("db.driver", "sqlite3", "Database to use: sqlite3, postgres or mysql (or set DBDRIVER)")
+	dbDSN    = flag.String("db.dsn", "", "Connection string for postgres or mysql (or set DBDSN)")
 )
 
 func main() {
@@ -54,7 +72,43 @@ func main() {
 		"Database file to load. (Defaults to catbase.db)")
 	flag.Parse() // parses the logging flags.
 
-	c := config.ReadConfig(*dbpath)
+	c := openConfig(*dbpath)
+
+	if *exportCfg != "" {
+		if err := exportConfig(c, *exportCfg, *exportSec); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Exported config to %s", *exportCfg)
+		return
+	}
+	if *importCfg != "" {
+		f, err := os.Open(*importCfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		n, err := c.Import(f)
+		f.Close()
+		if err != nil {
+			log.Fatalf("%s: %s", *importCfg, err)
+		}
+		log.Printf("Imported %d keys from %s", n, *importCfg)
+		return
+	}
+	if *migrateStatus {
+		states, err := migrate.Status(c.DB)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, s := range states {
+			fmt.Println(s)
+		}
+		return
+	}
+	if *cfgFile != "" {
+		if err := c.LoadFile(*cfgFile); err != nil {
+			log.Fatal(err)
+		}
+	}
 
 	if *key != "" && *val != "" {
 		c.Set(*key, *val)
@@ -68,21 +122,91 @@ func main() {
 		return
 	}
 
-	var client bot.Connector
+	client := newConnector(c, c.Get("type", ""))
+
+	b := bot.New(c, client)
+
+	addPlugins(b)
+
+	if err := client.Serve(); err != nil {
+		log.Fatal(err)
+	}
 
-	switch c.Get("type", "slackapp") {
+	addr := c.Get("HttpAddr", "")
+	log.Fatal(http.ListenAndServe(addr, nil))
+}
+
+// newConnector makes the connector for a type, which for multi is all of
+// the types in multi.networks at once
+func newConnector(c *config.Config, kind string) bot.Connector {
+	switch kind {
 	case "irc":
-		client = irc.New(c)
+		return irc.New(c)
 	case "slack":
-		client = slack.New(c)
+		return slack.New(c)
 	case "slackapp":
-		client = slackapp.New(c)
-	default:
-		log.Fatalf("Unknown connection type: %s", c.Get("type", "UNSET"))
+		return slackapp.New(c)
+	case "socketmode":
+		return slackapp.NewSocketMode(c)
+	case "discord":
+		return discord.New(c)
+	case "matrix":
+		return matrix.New(c)
+	case "cli":
+		return cli.New(c)
+	case "multi":
+		conns := map[string]bot.Connector{}
+		for _, network := range c.GetArray("multi.networks", []string{}) {
+			if network == "multi" {
+				log.Fatal("multi can't be one of multi.networks")
+			}
+			conns[network] = newConnector(c, network)
+		}
+		if len(conns) == 0 {
+			log.Fatal("Set multi.networks to the connectors to run")
+		}
+		return multi.New(c, conns)
 	}
+	log.Fatalf("Unknown connection type: %s", kind)
+	return nil
+}
 
-	b := bot.New(c, client)
+// openConfig connects to the database chosen by -db.driver and -db.dsn,
+// or by the DBDRIVER and DBDSN environment variables, falling back to the
+// SQLite file given by -db
+func openConfig(dbpath string) *config.Config {
+	driver, dsn := *dbDriver, *dbDSN
+	if v, ok := os.LookupEnv("DBDRIVER"); ok {
+		driver = v
+	}
+	if v, ok := os.LookupEnv("DBDSN"); ok {
+		dsn = v
+	}
+	if driver == config.SQLite.Name && dsn == "" {
+		return config.ReadConfig(dbpath)
+	}
+	c, err := config.Open(driver, dsn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Using %s database.", driver)
+	return c
+}
 
+func exportConfig(c *config.Config, path string, secrets bool) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := c.Export(f, secrets); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// addPlugins registers every plugin with the bot in priority order
+func addPlugins(b bot.Bot) {
 	b.AddPlugin(admin.New(b))
 	b.AddPlugin(emojifyme.New(b))
 	b.AddPlugin(first.New(b))
@@ -92,6 +216,7 @@ func main() {
 	b.AddPlugin(picker.New(b))
 	b.AddPlugin(beers.New(b))
 	b.AddPlugin(remember.New(b))
+	b.AddPlugin(history.New(b))
 	b.AddPlugin(your.New(b))
 	b.AddPlugin(counter.New(b))
 	b.AddPlugin(reminder.New(b))
@@ -109,11 +234,4 @@ func main() {
 	// catches anything left, will always return true
 	b.AddPlugin(fact.New(b))
 	b.AddPlugin(db.New(b))
-
-	if err := client.Serve(); err != nil {
-		log.Fatal(err)
-	}
-
-	addr := c.Get("HttpAddr", "127.0.0.1:1337")
-	log.Fatal(http.ListenAndServe(addr, nil))
 }
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/velour/catbase/bot/transcript"
+)
+
+// TestTranscripts replays every script in testdata/transcripts through the
+// full plugin list and compares what the bot said with the golden file.
+// Run with -update to accept new output.
+func TestTranscripts(t *testing.T) {
+	scripts, err := filepath.Glob("testdata/transcripts/*.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, script := range scripts {
+		script := script
+		t.Run(filepath.Base(script), func(t *testing.T) {
+			f, err := os.Open(script)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			lines, err := transcript.Parse(f, time.Now().UTC())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			h := transcript.New()
+			// Keep the random plugins quiet so the output is stable
+			h.Config.Set("reaction.generalchance", "0")
+			h.Config.Set("emojify.chance", "0")
+			h.Config.Set("admins", "root")
+			addPlugins(h.Bot())
+
+			golden := strings.TrimSuffix(script, ".txt") + ".golden"
+			transcript.Golden(t, golden, h.Run(lines))
+		})
+	}
+}
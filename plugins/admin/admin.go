@@ -4,13 +4,19 @@ package admin
 
 import (
 	"fmt"
+	"html/template"
 	"log"
+	"net/http"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/velour/catbase/bot"
+	"github.com/velour/catbase/bot/audit"
 	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/bot/msglog"
+	"github.com/velour/catbase/bot/user"
 	"github.com/velour/catbase/config"
 )
 
@@ -33,14 +39,19 @@ func New(b bot.Bot) *AdminPlugin {
 	}
 	b.Register(p, bot.Message, p.message)
 	b.Register(p, bot.Help, p.help)
+	b.RequireRole(p, bot.Moderator, `^shut up$`)
+	b.RequireRole(p, bot.Trusted, `^(get|config)\s`)
+	b.RequireRole(p, bot.Admin, `^(set|plugin|role)\s`)
+
+	p.registerWeb()
 	return p
 }
 
-var forbiddenKeys = map[string]bool{
-	"twitch.authorization": true,
-	"twitch.clientid":      true,
-	"untappd.token":        true,
-	"slack.token":          true,
+func init() {
+	config.Register(
+		config.Key{Name: "quietDuration", Type: config.Int, Default: "5", Description: "minutes to stay quiet after being told to shut up"},
+		config.Key{Name: "Audit.WebLimit", Type: config.Int, Default: "500", Description: "most audit entries shown on the web"},
+	)
 }
 
 // Message responds to the bot hook on recieving messages.
@@ -62,9 +73,9 @@ func (p *AdminPlugin) message(k bot.Kind, message msg.Message, args ...interface
 	}
 
 	if strings.ToLower(body) == "shut up" {
-		dur := time.Duration(p.cfg.GetInt("quietDuration", 5)) * time.Minute
+		dur := time.Duration(p.cfg.GetInt("quietDuration", 0)) * time.Minute
 		log.Printf("Going to sleep for %v, %v", dur, time.Now().Add(dur))
-		p.Bot.Send(bot.Message, message.Channel, "Okay. I'll be back later.")
+		p.Bot.Send(bot.Message, message, "Okay. I'll be back later.")
 		p.quiet = true
 		go func() {
 			select {
@@ -77,26 +88,261 @@ func (p *AdminPlugin) message(k bot.Kind, message msg.Message, args ...interface
 	}
 
 	parts := strings.Split(body, " ")
-	if parts[0] == "set" && len(parts) > 2 && forbiddenKeys[parts[1]] {
-		p.Bot.Send(bot.Message, message.Channel, "You cannot access that key")
+	if parts[0] == "set" && len(parts) > 2 && config.IsSecret(parts[1]) {
+		p.Bot.Send(bot.Message, message, "You cannot access that key")
 		return true
 	} else if parts[0] == "set" && len(parts) > 2 {
-		p.cfg.Set(parts[1], strings.Join(parts[2:], " "))
-		p.Bot.Send(bot.Message, message.Channel, fmt.Sprintf("Set %s", parts[1]))
+		value := strings.Join(parts[2:], " ")
+		if err := config.Validate(parts[1], value); err != nil {
+			p.Bot.Send(bot.Message, message, fmt.Sprintf("I can't set that: %s", err))
+			return true
+		}
+		e := audit.New(message, "admin", "set", parts[1])
+		e.Before = p.cfg.Get(parts[1], "")
+		e.After = value
+		if err := p.cfg.Set(parts[1], e.After); err != nil {
+			p.Bot.Send(bot.Message, message, fmt.Sprintf("I can't set that: %s", err))
+			return true
+		}
+		audit.Log(p.db, e)
+		p.Bot.Send(bot.Message, message, fmt.Sprintf("Set %s", parts[1]))
 		return true
 	}
-	if parts[0] == "get" && len(parts) == 2 && forbiddenKeys[parts[1]] {
-		p.Bot.Send(bot.Message, message.Channel, "You cannot access that key")
+	if parts[0] == "get" && len(parts) == 2 && config.IsSecret(parts[1]) {
+		p.Bot.Send(bot.Message, message, "You cannot access that key")
 		return true
 	} else if parts[0] == "get" && len(parts) == 2 {
 		v := p.cfg.Get(parts[1], "<unknown>")
-		p.Bot.Send(bot.Message, message.Channel, fmt.Sprintf("%s: %s", parts[1], v))
+		p.Bot.Send(bot.Message, message, fmt.Sprintf("%s: %s", parts[1], v))
 		return true
 	}
+	if parts[0] == "config" && len(parts) > 1 && parts[1] == "list" {
+		return p.listConfig(message, parts[2:])
+	}
+	if parts[0] == "plugin" && len(parts) > 1 {
+		return p.handlePlugin(message, parts[1:])
+	}
+	if parts[0] == "role" && len(parts) > 1 {
+		return p.handleRole(message, parts[1:])
+	}
 
 	return false
 }
 
+// listConfig shows the declared keys for a plugin, or which plugins have keys
+func (p *AdminPlugin) listConfig(message msg.Message, parts []string) bool {
+	ch := message.Channel
+	if len(parts) == 0 {
+		seen := map[string]bool{}
+		plugins := []string{}
+		for _, k := range config.Keys("") {
+			if !seen[k.Plugin()] {
+				seen[k.Plugin()] = true
+				plugins = append(plugins, k.Plugin())
+			}
+		}
+		sort.Strings(plugins)
+		p.Bot.Send(bot.Message, ch, "I have settings for: "+strings.Join(plugins, ", ")+". Try config list <plugin>.")
+		return true
+	}
+	if len(parts) != 1 {
+		return false
+	}
+	keys := config.Keys(parts[0])
+	if len(keys) == 0 {
+		p.Bot.Send(bot.Message, ch, fmt.Sprintf("%s has no settings I know about.", parts[0]))
+		return true
+	}
+	for _, k := range keys {
+		value := p.cfg.Get(k.Name, k.Default)
+		if k.Secret {
+			value = "<secret>"
+		}
+		line := fmt.Sprintf("%s (%s", k.Name, k.Type)
+		if k.Default != "" {
+			line += ", default " + k.Default
+		}
+		line += fmt.Sprintf(") = %s", value)
+		if src := p.cfg.Source(k.Name); src != "" {
+			line += " [" + src + "]"
+		}
+		if k.Description != "" {
+			line += ": " + k.Description
+		}
+		p.Bot.Send(bot.Message, ch, line)
+	}
+	return true
+}
+
+// handlePlugin manages which plugins run where:
+//
+//	plugin disable <name> [in <channel>]
+//	plugin enable <name> [in <channel>]
+//	plugin only <name> in <channel> [<channel>...]
+//	plugin everywhere <name>
+//	plugin list
+func (p *AdminPlugin) handlePlugin(message msg.Message, parts []string) bool {
+	ch := message.Channel
+
+	if parts[0] == "list" {
+		status := []string{}
+		gate := bot.NewPluginGate(p.cfg, ch)
+		for _, name := range p.Bot.PluginNames() {
+			if !gate.Enabled(name) {
+				name += " (off)"
+			}
+			status = append(status, name)
+		}
+		p.Bot.Send(bot.Message, ch, "Plugins here: "+strings.Join(status, ", "))
+		return true
+	}
+
+	if len(parts) < 2 {
+		return false
+	}
+	name := strings.ToLower(parts[1])
+	if !p.knownPlugin(name) {
+		p.Bot.Send(bot.Message, ch, fmt.Sprintf("I don't have a plugin called %s.", name))
+		return true
+	}
+
+	channels := []string{}
+	if len(parts) > 3 && parts[2] == "in" {
+		channels = parts[3:]
+	} else if len(parts) != 2 {
+		return false
+	}
+
+	switch parts[0] {
+	case "disable", "enable":
+		enable := parts[0] == "enable"
+		if !enable && name == "admin" {
+			p.Bot.Send(bot.Message, ch, "I can't disable admin, you'd never get it back.")
+			return true
+		}
+		if len(channels) > 1 {
+			return false
+		}
+		where, scope := "everywhere", ""
+		if len(channels) == 1 {
+			where, scope = "in "+channels[0], channels[0]
+		}
+		if enable && scope != "" && bot.PluginDisabledEverywhere(p.cfg, name) {
+			p.Bot.Send(bot.Message, ch, fmt.Sprintf("%s is disabled everywhere, enable it everywhere first and disable it in the channels you don't want it in.", name))
+			return true
+		}
+		if err := bot.SetPluginEnabled(p.cfg, name, scope, enable); err != nil {
+			log.Printf("[admin]: could not %s %s: %s", parts[0], name, err)
+			p.Bot.Send(bot.Message, ch, "I couldn't save that.")
+			return true
+		}
+		e := audit.New(message, "admin", "plugin "+parts[0], name)
+		e.After = where
+		audit.Log(p.db, e)
+		reply := fmt.Sprintf("%sd %s %s.", strings.Title(parts[0]), name, where)
+		if enable && scope != "" && !bot.PluginEnabled(p.cfg, name, scope) {
+			reply += fmt.Sprintf(" It is still off there, it only runs in %s.",
+				strings.Join(p.cfg.GetArray("Plugin."+name+".Channels", []string{}), ", "))
+		}
+		p.Bot.Send(bot.Message, ch, reply)
+		return true
+	case "only":
+		if len(channels) == 0 {
+			return false
+		}
+		if name == "admin" {
+			p.Bot.Send(bot.Message, ch, "I can't restrict admin, you'd never get it back elsewhere.")
+			return true
+		}
+		if err := bot.SetPluginChannels(p.cfg, name, channels); err != nil {
+			log.Printf("[admin]: could not restrict %s: %s", name, err)
+			p.Bot.Send(bot.Message, ch, "I couldn't save that.")
+			return true
+		}
+		e := audit.New(message, "admin", "plugin only", name)
+		e.After = strings.Join(channels, ", ")
+		audit.Log(p.db, e)
+		p.Bot.Send(bot.Message, ch, fmt.Sprintf("%s will only run in %s.", name, strings.Join(channels, ", ")))
+		return true
+	case "everywhere":
+		if len(channels) != 0 {
+			return false
+		}
+		if err := bot.SetPluginChannels(p.cfg, name, []string{}); err != nil {
+			log.Printf("[admin]: could not restrict %s: %s", name, err)
+			p.Bot.Send(bot.Message, ch, "I couldn't save that.")
+			return true
+		}
+		audit.Log(p.db, audit.New(message, "admin", "plugin everywhere", name))
+		p.Bot.Send(bot.Message, ch, fmt.Sprintf("%s will run in every channel.", name))
+		return true
+	}
+	return false
+}
+
+// handleRole shows or changes the role of a user:
+//
+//	role <nick|id:ID>
+//	role <nick|id:ID> <everyone|trusted|moderator|admin>
+//
+// Nicks are resolved to the ID they last spoke with.
+func (p *AdminPlugin) handleRole(message msg.Message, parts []string) bool {
+	if len(parts) > 2 {
+		return false
+	}
+	ch := message.Channel
+	who := parts[0]
+	id := strings.TrimPrefix(who, "id:")
+	if id == who {
+		entries, err := p.Bot.History(msglog.Query{User: who, Limit: 1})
+		if err != nil || len(entries) == 0 || entries[0].User.ID == "" {
+			p.Bot.Send(bot.Message, ch, fmt.Sprintf("I haven't seen %s, try id:<user id>.", who))
+			return true
+		}
+		id = entries[0].User.ID
+	}
+
+	if len(parts) == 1 {
+		role := p.Bot.UserRole(&user.User{ID: id})
+		if role == bot.Everyone {
+			p.Bot.Send(bot.Message, ch, fmt.Sprintf("%s has no role.", who))
+		} else {
+			p.Bot.Send(bot.Message, ch, fmt.Sprintf("%s is %s.", who, role))
+		}
+		return true
+	}
+
+	role, err := bot.ParseRole(parts[1])
+	if err != nil {
+		p.Bot.Send(bot.Message, ch, err.Error())
+		return true
+	}
+	e := audit.New(message, "admin", "role", id)
+	e.Before = p.Bot.UserRole(&user.User{ID: id}).String()
+	e.After = role.String()
+	if err := p.Bot.SetRole(id, role); err != nil {
+		log.Printf("[admin]: could not set role of %s: %s", id, err)
+		p.Bot.Send(bot.Message, ch, "I couldn't save that.")
+		return true
+	}
+	audit.Log(p.db, e)
+	if role == bot.Everyone {
+		p.Bot.Send(bot.Message, ch, fmt.Sprintf("%s no longer has a role.", who))
+	} else {
+		p.Bot.Send(bot.Message, ch, fmt.Sprintf("%s is now %s.", who, role))
+	}
+	return true
+}
+
+func (p *AdminPlugin) knownPlugin(name string) bool {
+	for _, n := range p.Bot.PluginNames() {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
 func (p *AdminPlugin) handleVariables(message msg.Message) bool {
 	if parts := strings.SplitN(message.Body, "!=", 2); len(parts) == 2 {
 		variable := strings.ToLower(strings.TrimSpace(parts[0]))
@@ -104,10 +350,10 @@ func (p *AdminPlugin) handleVariables(message msg.Message) bool {
 
 		_, err := p.db.Exec(`delete from variables where name=? and value=?`, variable, value)
 		if err != nil {
-			p.Bot.Send(bot.Message, message.Channel, "I'm broke and need attention in my variable creation code.")
+			p.Bot.Send(bot.Message, message, "I'm broke and need attention in my variable creation code.")
 			log.Println("[admin]: ", err)
 		} else {
-			p.Bot.Send(bot.Message, message.Channel, "Removed.")
+			p.Bot.Send(bot.Message, message, "Removed.")
 		}
 
 		return true
@@ -125,27 +371,55 @@ func (p *AdminPlugin) handleVariables(message msg.Message) bool {
 	row := p.db.QueryRow(`select count(*) from variables where value = ?`, variable, value)
 	err := row.Scan(&count)
 	if err != nil {
-		p.Bot.Send(bot.Message, message.Channel, "I'm broke and need attention in my variable creation code.")
+		p.Bot.Send(bot.Message, message, "I'm broke and need attention in my variable creation code.")
 		log.Println("[admin]: ", err)
 		return true
 	}
 
 	if count > 0 {
-		p.Bot.Send(bot.Message, message.Channel, "I've already got that one.")
+		p.Bot.Send(bot.Message, message, "I've already got that one.")
 	} else {
 		_, err := p.db.Exec(`INSERT INTO variables (name, value) VALUES (?, ?)`, variable, value)
 		if err != nil {
-			p.Bot.Send(bot.Message, message.Channel, "I'm broke and need attention in my variable creation code.")
+			p.Bot.Send(bot.Message, message, "I'm broke and need attention in my variable creation code.")
 			log.Println("[admin]: ", err)
 			return true
 		}
-		p.Bot.Send(bot.Message, message.Channel, "Added.")
+		p.Bot.Send(bot.Message, message, "Added.")
 	}
 	return true
 }
 
 // Help responds to help requests. Every plugin must implement a help function.
 func (p *AdminPlugin) help(kind bot.Kind, m msg.Message, args ...interface{}) bool {
-	p.Bot.Send(bot.Message, m.Channel, "This does super secret things that you're not allowed to know about.")
+	p.Bot.Send(bot.Message, m, "This does super secret things that you're not allowed to know about.")
 	return true
 }
+
+func (p *AdminPlugin) registerWeb() {
+	p.Bot.RegisterWeb("/audit", "Audit", bot.WebAdmin, p.serveAudit)
+}
+
+// serveAudit lists recent administrative and destructive actions
+func (p *AdminPlugin) serveAudit(w http.ResponseWriter, r *http.Request) {
+	plugin := r.FormValue("plugin")
+	entries, err := audit.Recent(p.db, plugin, p.cfg.GetInt("Audit.WebLimit", 0))
+	context := map[string]interface{}{
+		"Plugin":  plugin,
+		"Entries": entries,
+	}
+	if err != nil {
+		log.Println("[admin]: error reading audit log: ", err)
+		context["Error"] = "Could not read the audit log."
+	}
+	t, err := template.New("auditIndex").Funcs(template.FuncMap{
+		"when": func(t time.Time) string { return t.Format("2006-01-02 15:04:05") },
+	}).Parse(auditIndex)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if err := t.Execute(w, context); err != nil {
+		log.Println(err)
+	}
+}
@@ -1,13 +1,19 @@
 package admin
 
 import (
+	"os"
 	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/velour/catbase/bot"
+	"github.com/velour/catbase/bot/audit"
 	"github.com/velour/catbase/bot/msg"
 	"github.com/velour/catbase/bot/user"
+	"github.com/velour/catbase/config"
+
+	// registers slack.token as a secret
+	_ "github.com/velour/catbase/connectors/slackapp"
 )
 
 var (
@@ -67,3 +73,132 @@ func TestGetForbidden(t *testing.T) {
 	assert.Len(t, mb.Messages, 1)
 	assert.Contains(t, mb.Messages[0], expected)
 }
+
+func TestPluginDisableInChannel(t *testing.T) {
+	a, mb := setup(t)
+	mb.AddPlugin(a)
+	mb.AddPlugin(&bot.MockBot{})
+	a.message(makeMessage("!plugin disable bot in #general"))
+	assert.Len(t, mb.Messages, 1)
+	assert.False(t, bot.PluginEnabled(mb.Config(), "bot", "#general"))
+	assert.True(t, bot.PluginEnabled(mb.Config(), "bot", "#random"))
+
+	a.message(makeMessage("!plugin enable bot in #general"))
+	assert.True(t, bot.PluginEnabled(mb.Config(), "bot", "#general"))
+}
+
+func TestPluginEnableInChannelWhenDisabledEverywhere(t *testing.T) {
+	a, mb := setup(t)
+	mb.AddPlugin(a)
+	mb.AddPlugin(&bot.MockBot{})
+	a.message(makeMessage("!plugin disable bot"))
+	a.message(makeMessage("!plugin enable bot in #general"))
+	assert.Len(t, mb.Messages, 2)
+	assert.Contains(t, mb.Messages[1], "disabled everywhere")
+	assert.False(t, bot.PluginEnabled(mb.Config(), "bot", "#general"))
+
+	a.message(makeMessage("!plugin only bot in #random"))
+	a.message(makeMessage("!plugin enable bot"))
+	a.message(makeMessage("!plugin enable bot in #general"))
+	assert.Contains(t, mb.Messages[4], "still off there")
+}
+
+func TestPluginOnly(t *testing.T) {
+	a, mb := setup(t)
+	mb.AddPlugin(a)
+	mb.AddPlugin(&bot.MockBot{})
+	a.message(makeMessage("!plugin only bot in #random"))
+	assert.False(t, bot.PluginEnabled(mb.Config(), "bot", "#general"))
+	assert.True(t, bot.PluginEnabled(mb.Config(), "bot", "#random"))
+
+	a.message(makeMessage("!plugin everywhere bot"))
+	assert.True(t, bot.PluginEnabled(mb.Config(), "bot", "#general"))
+}
+
+func TestPluginOnlyAdmin(t *testing.T) {
+	a, mb := setup(t)
+	mb.AddPlugin(a)
+	a.message(makeMessage("!plugin only admin in #random"))
+	assert.Len(t, mb.Messages, 1)
+	assert.Contains(t, mb.Messages[0], "can't restrict admin")
+	assert.True(t, bot.PluginEnabled(mb.Config(), "admin", "#general"))
+}
+
+func TestPluginUnknown(t *testing.T) {
+	a, mb := setup(t)
+	a.message(makeMessage("!plugin disable nonsense"))
+	assert.Len(t, mb.Messages, 1)
+	assert.Contains(t, mb.Messages[0], "don't have a plugin")
+}
+
+func TestRole(t *testing.T) {
+	a, mb := setup(t)
+	mb.Receive(bot.Message, msg.Message{User: &user.User{ID: "U2", Name: "bob"}, Channel: "test", Body: "hi"})
+	a.message(makeMessage("!role bob trusted"))
+	assert.Equal(t, bot.Trusted, mb.UserRole(&user.User{ID: "U2"}))
+
+	a.message(makeMessage("!role id:U3 moderator"))
+	assert.Equal(t, bot.Moderator, mb.UserRole(&user.User{ID: "U3"}))
+
+	a.message(makeMessage("!role bob"))
+	assert.Equal(t, "bob is trusted.", mb.Messages[len(mb.Messages)-1])
+}
+
+func TestRoleUnknownNick(t *testing.T) {
+	a, mb := setup(t)
+	a.message(makeMessage("!role nobody admin"))
+	assert.Len(t, mb.Messages, 1)
+	assert.Contains(t, mb.Messages[0], "haven't seen nobody")
+}
+
+func TestSetIsAudited(t *testing.T) {
+	a, mb := setup(t)
+	mb.Config().Set("test.key", "old")
+	a.message(makeMessage("!set test.key new value"))
+	entries, err := audit.Recent(mb.DB(), "admin", 10)
+	assert.Nil(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "test.key", entries[0].Target)
+	assert.Equal(t, "old", entries[0].Before)
+	assert.Equal(t, "new value", entries[0].After)
+}
+
+func TestSetSecret(t *testing.T) {
+	a, mb := setup(t)
+	a.message(makeMessage("!set slack.token xoxb-123"))
+	assert.Len(t, mb.Messages, 1)
+	assert.Contains(t, mb.Messages[0], "cannot access")
+	assert.Equal(t, "", mb.Config().Get("slack.token", ""))
+}
+
+func TestSetInvalid(t *testing.T) {
+	config.Register(config.Key{Name: "AdminSetTest.Count", Type: config.Int})
+	a, mb := setup(t)
+	a.message(makeMessage("!set adminsettest.count lots"))
+	assert.Len(t, mb.Messages, 1)
+	assert.Contains(t, mb.Messages[0], "must be a int")
+	assert.Equal(t, "", mb.Config().Get("AdminSetTest.Count", ""))
+}
+
+func TestConfigList(t *testing.T) {
+	config.Register(config.Key{Name: "AdminTest.Limit", Type: config.Int, Default: "3", Description: "a limit"})
+	a, mb := setup(t)
+	mb.Config().Set("AdminTest.Limit", "7")
+	a.message(makeMessage("!config list admintest"))
+	assert.Len(t, mb.Messages, 1)
+	assert.Contains(t, mb.Messages[0], "AdminTest.Limit (int, default 3) = 7 [db]: a limit")
+}
+
+func TestSetShadowed(t *testing.T) {
+	config.Register(config.Key{Name: "AdminTest.Shadowed"})
+	os.Setenv("ADMINTESTSHADOWED", "env value")
+	defer os.Unsetenv("ADMINTESTSHADOWED")
+	a, mb := setup(t)
+	a.message(makeMessage("!set admintest.shadowed chat value"))
+	assert.Len(t, mb.Messages, 1)
+	assert.Contains(t, mb.Messages[0], "I can't set that")
+	assert.Equal(t, "env value", mb.Config().Get("AdminTest.Shadowed", ""))
+
+	a.message(makeMessage("!config list admintest"))
+	assert.Contains(t, strings.Join(mb.Messages, "\n"), "AdminTest.Shadowed (string) = env value [env]")
+}
@@ -0,0 +1,49 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+package admin
+
+var auditIndex = `
+<!DOCTYPE html>
+<html>
+<head>
+	<title>Audit log</title>
+	<link rel="stylesheet" href="https://cdnjs.cloudflare.com/ajax/libs/pure/0.6.0/pure-min.css">
+</head>
+<body>
+	<div>
+		<form action="/audit" method="GET" class="pure-form">
+			<fieldset>
+				<legend>Who did what</legend>
+				<input type="text" name="plugin" placeholder="plugin" value="{{.Plugin}}" />
+				<button type="submit" class="pure-button notice">Filter</button>
+			</fieldset>
+		</form>
+	</div>
+	{{if .Error}}
+	<p>{{.Error}}</p>
+	{{end}}
+	<table class="pure-table">
+		<thead>
+			<tr>
+				<th>When</th><th>Who</th><th>Channel</th><th>Plugin</th>
+				<th>Action</th><th>Target</th><th>Before</th><th>After</th>
+			</tr>
+		</thead>
+		<tbody>
+		{{range .Entries}}
+			<tr>
+				<td>{{when .Time}}</td>
+				<td title="{{.UserID}}">{{.Nick}}</td>
+				<td>{{.Channel}}</td>
+				<td>{{.Plugin}}</td>
+				<td>{{.Action}}</td>
+				<td>{{.Target}}</td>
+				<td>{{.Before}}</td>
+				<td>{{.After}}</td>
+			</tr>
+		{{end}}
+		</tbody>
+	</table>
+</body>
+</html>
+`
@@ -12,7 +12,9 @@ import (
 
 	"github.com/jmoiron/sqlx"
 	"github.com/velour/catbase/bot"
+	"github.com/velour/catbase/bot/migrate"
 	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/config"
 )
 
 var (
@@ -52,39 +54,48 @@ type BabblerArc struct {
 	Frequency  int64 `db:"frequency"`
 }
 
+func init() {
+	migrate.Register("babbler",
+		migrate.Migration{Version: 1, Description: "create babbler tables", SQL: `
+			create table if not exists babblers (
+				id integer primary key,
+				babbler string
+			);
+			create table if not exists babblerWords (
+				id integer primary key,
+				word string
+			);
+			create table if not exists babblerNodes (
+				id integer primary key,
+				babblerId integer,
+				wordId integer,
+				root integer,
+				rootFrequency integer
+			);
+			create table if not exists babblerArcs (
+				id integer primary key,
+				fromNodeId integer,
+				toNodeId interger,
+				frequency integer
+			);`},
+		migrate.Migration{Version: 2, Description: "fix the type of babblerArcs.toNodeId", SQL: `
+			create table babblerArcs_new (
+				id integer primary key,
+				fromNodeId integer,
+				toNodeId integer,
+				frequency integer
+			);
+			insert into babblerArcs_new (id, fromNodeId, toNodeId, frequency)
+				select id, fromNodeId, toNodeId, frequency from babblerArcs;
+			drop table babblerArcs;
+			alter table babblerArcs_new rename to babblerArcs;`},
+	)
+}
+
 func New(b bot.Bot) *BabblerPlugin {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
-	if _, err := b.DB().Exec(`create table if not exists babblers (
-			id integer primary key,
-			babbler string
-		);`); err != nil {
-		log.Fatal(err)
-	}
-
-	if _, err := b.DB().Exec(`create table if not exists babblerWords (
-			id integer primary key,
-			word string
-		);`); err != nil {
-		log.Fatal(err)
-	}
-
-	if _, err := b.DB().Exec(`create table if not exists babblerNodes (
-			id integer primary key,
-			babblerId integer,
-			wordId integer,
-			root integer,
-			rootFrequency integer
-		);`); err != nil {
-		log.Fatal(err)
-	}
-
-	if _, err := b.DB().Exec(`create table if not exists babblerArcs (
-			id integer primary key,
-			fromNodeId integer,
-			toNodeId interger,
-			frequency integer
-		);`); err != nil {
+	if err := migrate.Up(b.DB(), "babbler"); err != nil {
 		log.Fatal(err)
 	}
 
@@ -137,14 +148,14 @@ func (p *BabblerPlugin) message(kind bot.Kind, message msg.Message, args ...inte
 	} else if strings.Index(lowercase, "batch learn for ") == 0 {
 		saidWhat, saidSomething = p.batchLearn(tokens)
 	} else if len(tokens) == 5 && strings.Index(lowercase, "merge babbler") == 0 {
-		saidWhat, saidSomething = p.merge(tokens)
+		saidWhat, saidSomething = p.merge(message, tokens)
 	} else {
 		//this should always return "", false
 		saidWhat, saidSomething = p.addToBabbler(message.User.Name, lowercase)
 	}
 
 	if saidSomething {
-		p.Bot.Send(bot.Message, message.Channel, saidWhat)
+		p.Bot.Send(bot.Message, message, saidWhat)
 	}
 	return saidSomething
 }
@@ -158,24 +169,20 @@ func (p *BabblerPlugin) help(kind bot.Kind, msg msg.Message, args ...interface{}
 		"seabass says-middle-out ...",
 		"seabass says-bridge ... | ...",
 	}
-	p.Bot.Send(bot.Message, msg.Channel, strings.Join(commands, "\n\n"))
+	p.Bot.Send(bot.Message, msg, strings.Join(commands, "\n\n"))
 	return true
 }
 
 func (p *BabblerPlugin) makeBabbler(name string) (*Babbler, error) {
-	res, err := p.db.Exec(`insert into babblers (babbler) values (?);`, name)
-	if err == nil {
-		id, err := res.LastInsertId()
-		if err != nil {
-			log.Print(err)
-			return nil, err
-		}
-		return &Babbler{
-			BabblerId: id,
-			Name:      name,
-		}, nil
+	id, err := config.DialectOf(p.db).InsertID(p.db, `insert into babblers (babbler) values (?);`, name)
+	if err != nil {
+		log.Print(err)
+		return nil, err
 	}
-	return nil, err
+	return &Babbler{
+		BabblerId: id,
+		Name:      name,
+	}, nil
 }
 
 func (p *BabblerPlugin) getBabbler(name string) (*Babbler, error) {
@@ -245,12 +252,7 @@ func (p *BabblerPlugin) getWord(word string) (*BabblerWord, error) {
 }
 
 func (p *BabblerPlugin) createNewWord(word string) (*BabblerWord, error) {
-	res, err := p.db.Exec(`insert into babblerWords (word) values (?);`, word)
-	if err != nil {
-		log.Print(err)
-		return nil, err
-	}
-	id, err := res.LastInsertId()
+	id, err := config.DialectOf(p.db).InsertID(p.db, `insert into babblerWords (word) values (?);`, word)
 	if err != nil {
 		log.Print(err)
 		return nil, err
@@ -296,13 +298,7 @@ func (p *BabblerPlugin) createBabblerNode(babbler *Babbler, word string) (*Babbl
 		return nil, err
 	}
 
-	res, err := p.db.Exec(`insert into babblerNodes (babblerId, wordId, root, rootFrequency) values (?, ?, 0, 0)`, babbler.BabblerId, w.WordId)
-	if err != nil {
-		log.Print(err)
-		return nil, err
-	}
-
-	id, err := res.LastInsertId()
+	id, err := config.DialectOf(p.db).InsertID(p.db, `insert into babblerNodes (babblerId, wordId, root, rootFrequency) values (?, ?, 0, 0)`, babbler.BabblerId, w.WordId)
 	if err != nil {
 		log.Print(err)
 		return nil, err
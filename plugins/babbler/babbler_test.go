@@ -8,6 +8,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/velour/catbase/bot"
+	"github.com/velour/catbase/bot/audit"
 	"github.com/velour/catbase/bot/msg"
 	"github.com/velour/catbase/bot/user"
 )
@@ -296,6 +297,10 @@ func TestBabblerMerge(t *testing.T) {
 	assert.True(t, res)
 	assert.Len(t, mb.Messages, 1)
 	assert.Contains(t, mb.Messages[0], "mooooiggged")
+	entries, err := audit.Recent(mb.DB(), "babbler", 10)
+	assert.Nil(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "seabass2", entries[0].After)
 
 	res = bp.message(makeMessage("!seabass2 says"))
 	assert.True(t, res)
@@ -3,6 +3,9 @@ package babbler
 import (
 	"fmt"
 	"strings"
+
+	"github.com/velour/catbase/bot/audit"
+	"github.com/velour/catbase/bot/msg"
 )
 
 func (p *BabblerPlugin) initializeBabbler(tokens []string) (string, bool) {
@@ -136,7 +139,7 @@ func (p *BabblerPlugin) batchLearn(tokens []string) (string, bool) {
 	return "phew that was tiring.", true
 }
 
-func (p *BabblerPlugin) merge(tokens []string) (string, bool) {
+func (p *BabblerPlugin) merge(message msg.Message, tokens []string) (string, bool) {
 	if tokens[3] != "into" {
 		return "try using 'merge babbler [x] into [y]'", true
 	}
@@ -164,6 +167,9 @@ func (p *BabblerPlugin) merge(tokens []string) (string, bool) {
 	if err != nil {
 		return "merge failed.", true
 	}
+	e := audit.New(message, "babbler", "merge", who)
+	e.After = into
+	audit.Log(p.db, e)
 
 	return "mooooiggged", true
 }
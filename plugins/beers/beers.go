@@ -16,7 +16,9 @@ import (
 
 	"github.com/jmoiron/sqlx"
 	"github.com/velour/catbase/bot"
+	"github.com/velour/catbase/bot/migrate"
 	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/config"
 	"github.com/velour/catbase/plugins/counter"
 )
 
@@ -37,24 +39,37 @@ type untappdUser struct {
 	chanNick    string
 }
 
+func init() {
+	config.Register(
+		config.Key{Name: "Untappd.Token", Description: "API access token", Secret: true},
+		config.Key{Name: "Untappd.Channels", Type: config.Array, Description: "channels to announce check-ins in"},
+		config.Key{Name: "Untappd.Freq", Type: config.Int, Default: "120", Description: "seconds between check-in polls, 0 pauses them"},
+	)
+}
+
+func init() {
+	migrate.Register("beers",
+		migrate.Migration{Version: 1, Description: "create untappd table", SQL: `
+			create table if not exists untappd (
+				id integer primary key,
+				untappdUser string,
+				channel string,
+				lastCheckin integer,
+				chanNick string
+			);`},
+	)
+}
+
 // New BeersPlugin creates a new BeersPlugin with the Plugin interface
 func New(b bot.Bot) *BeersPlugin {
-	if _, err := b.DB().Exec(`create table if not exists untappd (
-			id integer primary key,
-			untappdUser string,
-			channel string,
-			lastCheckin integer,
-			chanNick string
-		);`); err != nil {
+	if err := migrate.Up(b.DB(), "beers"); err != nil {
 		log.Fatal(err)
 	}
 	p := &BeersPlugin{
 		Bot: b,
 		db:  b.DB(),
 	}
-	for _, channel := range b.Config().GetArray("Untappd.Channels", []string{}) {
-		go p.untappdLoop(channel)
-	}
+	bot.WatchChannels(b.Config(), "Untappd.Channels", p.untappdLoop)
 	b.Register(p, bot.Message, p.message)
 	b.Register(p, bot.Help, p.help)
 	return p
@@ -197,7 +212,7 @@ func (p *BeersPlugin) help(kind bot.Kind, message msg.Message, args ...interface
 	msg := "Beers: imbibe by using either beers +=,=,++ or with the !imbibe/drink " +
 		"commands. I'll keep a count of how many beers you've had and then if you want " +
 		"to reset, just !puke it all up!"
-	p.Bot.Send(bot.Message, message.Channel, msg)
+	p.Bot.Send(bot.Message, message, msg)
 	return true
 }
 
@@ -421,16 +436,23 @@ func (p *BeersPlugin) checkUntappd(channel string) {
 	}
 }
 
-func (p *BeersPlugin) untappdLoop(channel string) {
-	frequency := p.Bot.Config().GetInt("Untappd.Freq", 120)
-	if frequency == 0 {
-		return
-	}
-
-	log.Println("Checking every ", frequency, " seconds")
-
+// untappdLoop checks for new check-ins to announce in channel until quit is
+// closed, rereading Untappd.Freq each time so it can be changed live.
+// A frequency of 0 pauses the checks without stopping the loop.
+func (p *BeersPlugin) untappdLoop(channel string, quit <-chan struct{}) {
 	for {
-		time.Sleep(time.Duration(frequency) * time.Second)
-		p.checkUntappd(channel)
+		frequency := p.Bot.Config().GetInt("Untappd.Freq", 0)
+		paused := frequency <= 0
+		if paused {
+			frequency = 120
+		}
+		select {
+		case <-quit:
+			return
+		case <-time.After(time.Duration(frequency) * time.Second):
+		}
+		if !paused {
+			p.checkUntappd(channel)
+		}
 	}
 }
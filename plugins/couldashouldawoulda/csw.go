@@ -65,7 +65,7 @@ func (p *CSWPlugin) message(kind bot.Kind, message msg.Message, args ...interfac
 			}
 		}
 
-		p.Bot.Send(bot.Message, message.Channel, responses[rand.Intn(len(responses))])
+		p.Bot.Send(bot.Message, message, responses[rand.Intn(len(responses))])
 		return true
 	}
 
@@ -13,7 +13,10 @@ import (
 
 	"github.com/jmoiron/sqlx"
 	"github.com/velour/catbase/bot"
+	"github.com/velour/catbase/bot/audit"
+	"github.com/velour/catbase/bot/migrate"
 	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/config"
 )
 
 // This is a counter plugin to count arbitrary things.
@@ -86,7 +89,7 @@ func Leader(db *sqlx.DB, itemName string) ([]Item, error) {
 func MkAlias(db *sqlx.DB, item, pointsTo string) (*alias, error) {
 	item = strings.ToLower(item)
 	pointsTo = strings.ToLower(pointsTo)
-	res, err := db.Exec(`insert into counter_alias (item, points_to) values (?, ?)`,
+	id, err := config.DialectOf(db).InsertID(db, `insert into counter_alias (item, points_to) values (?, ?)`,
 		item, pointsTo)
 	if err != nil {
 		_, err := db.Exec(`update counter_alias set points_to=? where item=?`, pointsTo, item)
@@ -99,7 +102,6 @@ func MkAlias(db *sqlx.DB, item, pointsTo string) (*alias, error) {
 		}
 		return &a, nil
 	}
-	id, _ := res.LastInsertId()
 
 	return &alias{db, id, item, pointsTo}, nil
 }
@@ -132,12 +134,11 @@ func GetItem(db *sqlx.DB, nick, itemName string) (Item, error) {
 
 // Create saves a counter
 func (i *Item) Create() error {
-	res, err := i.Exec(`insert into counter (nick, item, count) values (?, ?, ?);`,
+	id, err := config.DialectOf(i.DB).InsertID(i.DB, `insert into counter (nick, item, count) values (?, ?, ?);`,
 		i.Nick, i.Item, i.Count)
 	if err != nil {
 		return err
 	}
-	id, _ := res.LastInsertId()
 	// hackhackhack?
 	i.ID = id
 	return err
@@ -172,27 +173,35 @@ func (i *Item) Delete() error {
 	return err
 }
 
+func init() {
+	migrate.Register("counter",
+		migrate.Migration{Version: 1, Description: "create counter tables", SQL: `
+			create table if not exists counter (
+				id integer primary key,
+				nick string,
+				item string,
+				count integer
+			);
+			create table if not exists counter_alias (
+				id integer PRIMARY KEY AUTOINCREMENT,
+				item string NOT NULL UNIQUE,
+				points_to string NOT NULL
+			);`},
+	)
+}
+
 // NewCounterPlugin creates a new CounterPlugin with the Plugin interface
 func New(b bot.Bot) *CounterPlugin {
-	tx := b.DB().MustBegin()
-	b.DB().MustExec(`create table if not exists counter (
-			id integer primary key,
-			nick string,
-			item string,
-			count integer
-		);`)
-	b.DB().MustExec(`create table if not exists counter_alias (
-			id integer PRIMARY KEY AUTOINCREMENT,
-			item string NOT NULL UNIQUE,
-			points_to string NOT NULL
-		);`)
-	tx.Commit()
+	if err := migrate.Up(b.DB(), "counter"); err != nil {
+		log.Fatal(err)
+	}
 	cp := &CounterPlugin{
 		Bot: b,
 		DB:  b.DB(),
 	}
 	b.Register(cp, bot.Message, cp.message)
 	b.Register(cp, bot.Help, cp.help)
+	b.RequireRole(cp, bot.Trusted, `^clear\s`)
 	return cp
 }
 
@@ -258,9 +267,14 @@ func (p *CounterPlugin) message(kind bot.Kind, message msg.Message, args ...inte
 			return true
 		}
 		log.Printf("Items: %+v", items)
+		before := []string{}
 		for _, item := range items {
+			before = append(before, fmt.Sprintf("%s: %d", item.Item, item.Count))
 			item.Delete()
 		}
+		e := audit.New(message, "counter", "reset", strings.ToLower(nick))
+		e.Before = strings.Join(before, ", ")
+		audit.Log(p.DB, e)
 		p.Bot.Send(bot.Message, channel, fmt.Sprintf("%s, you are as new, my son.", nick))
 		return true
 	} else if message.Command && parts[0] == "inspect" && len(parts) == 2 {
@@ -319,6 +333,9 @@ func (p *CounterPlugin) message(kind bot.Kind, message msg.Message, args ...inte
 			p.Bot.Send(bot.Message, channel, "Something went wrong removing that counter;")
 			return true
 		}
+		e := audit.New(message, "counter", "clear", subject+"."+itemName)
+		e.Before = strconv.Itoa(it.Count)
+		audit.Log(p.DB, e)
 
 		p.Bot.Send(bot.Action, channel, fmt.Sprintf("chops a few %s out of his brain",
 			itemName))
@@ -449,7 +466,7 @@ func (p *CounterPlugin) message(kind bot.Kind, message msg.Message, args ...inte
 
 // Help responds to help requests. Every plugin must implement a help function.
 func (p *CounterPlugin) help(kind bot.Kind, message msg.Message, args ...interface{}) bool {
-	p.Bot.Send(bot.Message, message.Channel, "You can set counters incrementally by using "+
+	p.Bot.Send(bot.Message, message, "You can set counters incrementally by using "+
 		"<noun>++ and <noun>--. You can see all of your counters using "+
 		"\"inspect\", erase them with \"clear\", and view single counters with "+
 		"\"count\".")
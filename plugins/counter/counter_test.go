@@ -9,6 +9,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/velour/catbase/bot"
+	"github.com/velour/catbase/bot/audit"
 	"github.com/velour/catbase/bot/msg"
 	"github.com/velour/catbase/bot/user"
 )
@@ -253,3 +254,16 @@ func TestHelp(t *testing.T) {
 	c.help(bot.Help, msg.Message{Channel: "channel"}, []string{})
 	assert.Len(t, mb.Messages, 1)
 }
+
+func TestClearIsAudited(t *testing.T) {
+	mb, c := setup(t)
+	c.message(makeMessage("test++"))
+	c.message(makeMessage("test++"))
+	c.message(makeMessage("!clear test"))
+	entries, err := audit.Recent(mb.DB(), "counter", 10)
+	assert.Nil(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "clear", entries[0].Action)
+	assert.Equal(t, "tester.test", entries[0].Target)
+	assert.Equal(t, "2", entries[0].Before)
+}
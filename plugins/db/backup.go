@@ -0,0 +1,132 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	sqlite3 "github.com/mattn/go-sqlite3"
+)
+
+const (
+	backupPrefix = "catbase-"
+	backupSuffix = ".db"
+	backupStamp  = "20060102-150405"
+)
+
+// snapshot copies a live SQLite database to path with the online backup API,
+// so writes made while it runs can't leave the copy inconsistent
+func snapshot(db *sqlx.DB, path string) error {
+	ctx := context.Background()
+	src, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	destDB, err := sql.Open(db.DriverName(), path)
+	if err != nil {
+		return err
+	}
+	defer destDB.Close()
+	dest, err := destDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer dest.Close()
+
+	return dest.Raw(func(destConn interface{}) error {
+		return src.Raw(func(srcConn interface{}) error {
+			d, ok := destConn.(*sqlite3.SQLiteConn)
+			s, ok2 := srcConn.(*sqlite3.SQLiteConn)
+			if !ok || !ok2 {
+				return fmt.Errorf("backups only work with SQLite")
+			}
+			b, err := d.Backup("main", s, "main")
+			if err != nil {
+				return err
+			}
+			if _, err := b.Step(-1); err != nil {
+				b.Finish()
+				return err
+			}
+			return b.Finish()
+		})
+	})
+}
+
+// backup writes a new snapshot into dir and removes all but the newest keep
+func backup(db *sqlx.DB, dir string, keep int) (string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, backupPrefix+time.Now().Format(backupStamp)+backupSuffix)
+	// write somewhere else first so a half written file is never the latest
+	tmp := path + ".tmp"
+	if err := snapshot(db, tmp); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return "", err
+	}
+	return path, rotate(dir, keep)
+}
+
+// backups lists the snapshots in dir, oldest first
+func backups(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	files := []string{}
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasPrefix(name, backupPrefix) && strings.HasSuffix(name, backupSuffix) {
+			files = append(files, filepath.Join(dir, name))
+		}
+	}
+	// the timestamp in the name sorts in time order
+	sort.Strings(files)
+	return files, nil
+}
+
+// rotate removes the oldest snapshots so that only keep remain
+func rotate(dir string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+	files, err := backups(dir)
+	if err != nil {
+		return err
+	}
+	for len(files) > keep {
+		if err := os.Remove(files[0]); err != nil {
+			return err
+		}
+		files = files[1:]
+	}
+	return nil
+}
+
+// latest finds the newest snapshot in dir
+func latest(dir string) (string, error) {
+	files, err := backups(dir)
+	if err != nil {
+		return "", err
+	}
+	if len(files) == 0 {
+		return "", os.ErrNotExist
+	}
+	return files[len(files)-1], nil
+}
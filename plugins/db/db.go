@@ -5,6 +5,8 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/velour/catbase/bot"
@@ -17,29 +19,95 @@ type DBPlugin struct {
 	config *config.Config
 }
 
+func init() {
+	config.Register(
+		config.Key{Name: "Backup.Dir", Default: "backups", Description: "directory snapshots of the database are kept in"},
+		config.Key{Name: "Backup.Keep", Type: config.Int, Default: "7", Description: "snapshots to keep, older ones are removed"},
+		config.Key{Name: "Backup.Hours", Type: config.Int, Default: "24", Description: "hours between scheduled snapshots, 0 turns them off"},
+	)
+}
+
 func New(b bot.Bot) *DBPlugin {
 	p := &DBPlugin{b, b.Config()}
+	b.Register(p, bot.Message, p.message)
+	b.Register(p, bot.Help, p.help)
+	b.RequireRole(p, bot.Admin, `^backup$`)
 	p.registerWeb()
+	go p.backupLoop()
 	return p
 }
 
-func (p *DBPlugin) Message(message msg.Message) bool            { return false }
-func (p *DBPlugin) Event(kind string, message msg.Message) bool { return false }
-func (p *DBPlugin) ReplyMessage(msg.Message, string) bool       { return false }
-func (p *DBPlugin) BotMessage(message msg.Message) bool         { return false }
-func (p *DBPlugin) Help(channel string, parts []string)         {}
+func (p *DBPlugin) message(kind bot.Kind, message msg.Message, args ...interface{}) bool {
+	if !message.Command || strings.ToLower(strings.TrimSpace(message.Body)) != "backup" {
+		return false
+	}
+	path, err := p.backup()
+	if err != nil {
+		log.Printf("Error backing up DB: %s", err)
+		p.bot.Send(bot.Message, message, fmt.Sprintf("I couldn't back up: %s", err))
+		return true
+	}
+	p.bot.Send(bot.Message, message, fmt.Sprintf("Backed up to %s.", filepath.Base(path)))
+	return true
+}
+
+func (p *DBPlugin) help(kind bot.Kind, message msg.Message, args ...interface{}) bool {
+	p.bot.Send(bot.Message, message,
+		"Admins can snapshot the database with `!backup`. The latest snapshot can be downloaded from /db/catbase.db with the web token.")
+	return true
+}
+
+func (p *DBPlugin) backup() (string, error) {
+	if config.DialectOf(p.config.DB) != config.SQLite {
+		return "", fmt.Errorf("backups only work with SQLite, use your database's own tools")
+	}
+	return backup(p.config.DB,
+		p.config.Get("Backup.Dir", ""),
+		p.config.GetInt("Backup.Keep", 0))
+}
+
+// backupLoop takes a snapshot every Backup.Hours, rereading it each time
+func (p *DBPlugin) backupLoop() {
+	for {
+		hours := p.config.GetInt("Backup.Hours", 0)
+		if hours <= 0 {
+			// check again later in case it is turned on
+			time.Sleep(time.Hour)
+			continue
+		}
+		time.Sleep(time.Duration(hours) * time.Hour)
+		if path, err := p.backup(); err != nil {
+			log.Printf("Error in scheduled DB backup: %s", err)
+		} else {
+			log.Printf("Backed up DB to %s", path)
+		}
+	}
+}
 
 func (p *DBPlugin) registerWeb() {
-	http.HandleFunc("/db/catbase.db", p.serveQuery)
+	p.bot.RegisterWeb("/db/catbase.db", "Database", bot.WebAdmin, p.serveQuery)
 }
 
+// serveQuery sends the latest snapshot, the live database may be mid-write
 func (p *DBPlugin) serveQuery(w http.ResponseWriter, r *http.Request) {
-	f, err := os.Open(p.bot.Config().DBFile)
+	path, err := latest(p.config.Get("Backup.Dir", ""))
+	if err != nil {
+		log.Printf("Error finding DB snapshot for web service: %s", err)
+		http.Error(w, "No backup yet, try !backup", http.StatusNotFound)
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		log.Printf("Error opening DB snapshot for web service: %s", err)
+		http.Error(w, "Error opening DB", http.StatusInternalServerError)
+		return
+	}
 	defer f.Close()
+	info, err := f.Stat()
 	if err != nil {
-		log.Printf("Error opening DB for web service: %s", err)
-		fmt.Fprintf(w, "Error opening DB")
+		log.Printf("Error opening DB snapshot for web service: %s", err)
+		http.Error(w, "Error opening DB", http.StatusInternalServerError)
 		return
 	}
-	http.ServeContent(w, r, "catbase.db", time.Now(), f)
+	http.ServeContent(w, r, "catbase.db", info.ModTime(), f)
 }
@@ -0,0 +1,72 @@
+package db
+
+import (
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/velour/catbase/bot"
+	"github.com/velour/catbase/bot/msg"
+)
+
+func setup(t *testing.T) (*DBPlugin, *bot.MockBot, string) {
+	mb := bot.NewMockBot()
+	dir := t.TempDir()
+	mb.Config().Set("Backup.Dir", dir)
+	mb.Config().Set("Backup.Keep", "2")
+	mb.DB().MustExec(`create table if not exists backup_test (name string)`)
+	mb.DB().MustExec(`delete from backup_test`)
+	mb.DB().MustExec(`insert into backup_test (name) values ('kitty')`)
+	return &DBPlugin{mb, mb.Config()}, mb, dir
+}
+
+func TestBackup(t *testing.T) {
+	p, mb, dir := setup(t)
+	assert.True(t, p.message(bot.Message, msg.Message{Channel: "#test", Body: "backup", Command: true}))
+	assert.Len(t, mb.Messages, 1)
+	assert.Contains(t, mb.Messages[0], "Backed up to catbase-")
+
+	path, err := latest(dir)
+	assert.NoError(t, err)
+	snap := sqlx.MustOpen("sqlite3_custom", path)
+	defer snap.Close()
+	var name string
+	assert.NoError(t, snap.Get(&name, `select name from backup_test`))
+	assert.Equal(t, "kitty", name)
+}
+
+func TestRotate(t *testing.T) {
+	dir := t.TempDir()
+	for _, stamp := range []string{"20180101-000000", "20180102-000000", "20180103-000000"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, backupPrefix+stamp+backupSuffix), nil, 0600))
+	}
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0600))
+	assert.NoError(t, rotate(dir, 2))
+	files, err := backups(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "catbase-20180102-000000.db"),
+		filepath.Join(dir, "catbase-20180103-000000.db"),
+	}, files)
+	_, err = os.Stat(filepath.Join(dir, "notes.txt"))
+	assert.NoError(t, err)
+}
+
+func TestDownloadLatest(t *testing.T) {
+	p, _, _ := setup(t)
+	w := httptest.NewRecorder()
+	p.serveQuery(w, httptest.NewRequest("GET", "/db/catbase.db", nil))
+	assert.Equal(t, 404, w.Code)
+
+	_, err := p.backup()
+	assert.NoError(t, err)
+	w = httptest.NewRecorder()
+	p.serveQuery(w, httptest.NewRequest("GET", "/db/catbase.db", nil))
+	assert.Equal(t, 200, w.Code)
+	body, _ := io.ReadAll(w.Body)
+	assert.Equal(t, "SQLite format 3\x00", string(body[:16]))
+}
@@ -71,6 +71,6 @@ func (p *DicePlugin) message(kind bot.Kind, message msg.Message, args ...interfa
 
 // Help responds to help requests. Every plugin must implement a help function.
 func (p *DicePlugin) help(kind bot.Kind, message msg.Message, args ...interface{}) bool {
-	p.Bot.Send(bot.Message, message.Channel, "Roll dice using notation XdY. Try \"3d20\".")
+	p.Bot.Send(bot.Message, message, "Roll dice using notation XdY. Try \"3d20\".")
 	return true
 }
@@ -12,6 +12,7 @@ import (
 
 	"github.com/velour/catbase/bot"
 	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/config"
 )
 
 type EmojifyMePlugin struct {
@@ -20,15 +21,40 @@ type EmojifyMePlugin struct {
 	Emoji       map[string]string
 }
 
+func init() {
+	config.Register(
+		config.Key{Name: "Emojify.Chance", Type: config.Float, Default: "0.02", Description: "chance of reacting with an emoji that matches a word"},
+		config.Key{Name: "Emojify.Scoreless", Type: config.Array, Description: "emoji that are never used"},
+	)
+}
+
 func New(b bot.Bot) *EmojifyMePlugin {
+	emojiMap, err := fetchEmoji()
+	if err != nil {
+		// Carry on with whatever the chat service gives us later
+		log.Printf("Error getting generic emoji list: %s", err)
+		emojiMap = map[string]string{}
+	}
+
+	ep := &EmojifyMePlugin{
+		Bot:         b,
+		GotBotEmoji: false,
+		Emoji:       emojiMap,
+	}
+	b.Register(ep, bot.Message, ep.message)
+	return ep
+}
+
+// fetchEmoji downloads the generic emoji list from gemoji
+func fetchEmoji() (map[string]string, error) {
 	resp, err := http.Get("https://raw.githubusercontent.com/github/gemoji/master/db/emoji.json")
 	if err != nil {
-		log.Fatalf("Error generic emoji list: %s", err)
+		return nil, err
 	}
 	body, err := ioutil.ReadAll(resp.Body)
 	resp.Body.Close()
 	if err != nil {
-		log.Fatalf("Error generic emoji list body: %s", err)
+		return nil, err
 	}
 
 	type Emoji struct {
@@ -38,7 +64,7 @@ func New(b bot.Bot) *EmojifyMePlugin {
 	var emoji []Emoji
 	err = json.Unmarshal(body, &emoji)
 	if err != nil {
-		log.Fatalf("Error parsing emoji list: %s", err)
+		return nil, err
 	}
 
 	emojiMap := map[string]string{}
@@ -47,14 +73,7 @@ func New(b bot.Bot) *EmojifyMePlugin {
 			emojiMap[alias] = alias
 		}
 	}
-
-	ep := &EmojifyMePlugin{
-		Bot:         b,
-		GotBotEmoji: false,
-		Emoji:       emojiMap,
-	}
-	b.Register(ep, bot.Message, ep.message)
-	return ep
+	return emojiMap, nil
 }
 
 func (p *EmojifyMePlugin) message(kind bot.Kind, message msg.Message, args ...interface{}) bool {
@@ -90,7 +109,7 @@ func (p *EmojifyMePlugin) message(kind bot.Kind, message msg.Message, args ...in
 		}
 	}
 
-	if emojied > 0 && rand.Float64() <= p.Bot.Config().GetFloat64("Emojify.Chance", 0.02)*emojied {
+	if emojied > 0 && rand.Float64() <= p.Bot.Config().GetFloat64("Emojify.Chance", 0)*emojied {
 		for _, e := range emojys {
 			p.Bot.Send(bot.Reaction, message.Channel, e, message)
 		}
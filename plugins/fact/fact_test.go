@@ -7,6 +7,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/velour/catbase/bot"
 	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/bot/transcript"
 	"github.com/velour/catbase/bot/user"
 )
 
@@ -55,3 +56,108 @@ func TestReactCantLearnSpaces(t *testing.T) {
 	assert.Len(t, mb.Messages, 1)
 	assert.Contains(t, mb.Messages[0], "not a valid")
 }
+
+func makeHistoryPlugin(t *testing.T) (*FactoidPlugin, *bot.MockBot) {
+	p, mb := makePlugin(t)
+	mb.DB().MustExec(`delete from factoid; delete from factoid_history;`)
+	return p, mb
+}
+
+func TestUndoChange(t *testing.T) {
+	p, mb := makeHistoryPlugin(t)
+	p.message(bot.Message, makeMessage("user1", "!coffee <is> great"))
+	p.message(bot.Message, makeMessage("user2", "!coffee =~ s/great/terrible/"))
+	f, err := GetSingleFact(mb.DB(), "coffee")
+	assert.Nil(t, err)
+	assert.Equal(t, "terrible", f.Tidbit)
+
+	p.message(bot.Message, makeMessage("user1", "!undo"))
+	f, err = GetSingleFact(mb.DB(), "coffee")
+	assert.Nil(t, err)
+	assert.Equal(t, "great", f.Tidbit)
+
+	p.message(bot.Message, makeMessage("user1", "!undo"))
+	assert.Contains(t, mb.Messages[len(mb.Messages)-1], "nothing to undo")
+}
+
+func TestUndoInterleaved(t *testing.T) {
+	p, mb := makeHistoryPlugin(t)
+	p.message(bot.Message, makeMessage("user1", "!coffee <is> great"))
+	p.message(bot.Message, makeMessage("user1", "!tea <is> fine"))
+	edit := makeMessage("user2", "!coffee =~ s/great/terrible/")
+	edit.Channel = "#a"
+	p.message(bot.Message, edit)
+	edit = makeMessage("user3", "!tea =~ s/fine/awful/")
+	edit.Channel = "#b"
+	p.message(bot.Message, edit)
+
+	undo := makeMessage("user2", "!undo")
+	undo.Channel = "#a"
+	p.message(bot.Message, undo)
+	f, err := GetSingleFact(mb.DB(), "coffee")
+	assert.Nil(t, err)
+	assert.Equal(t, "great", f.Tidbit)
+	f, err = GetSingleFact(mb.DB(), "tea")
+	assert.Nil(t, err)
+	assert.Equal(t, "awful", f.Tidbit, "an undo in #a leaves #b's newer edit alone")
+
+	p.message(bot.Message, undo)
+	assert.Contains(t, mb.Messages[len(mb.Messages)-1], "nothing to undo")
+}
+
+func TestUndoForget(t *testing.T) {
+	p, mb := makeHistoryPlugin(t)
+	p.message(bot.Message, makeMessage("user1", "!coffee <is> great"))
+	p.message(bot.Message, makeMessage("user2", "coffee"))
+	p.message(bot.Message, makeMessage("user2", "!forget that"))
+	_, err := GetSingleFact(mb.DB(), "coffee")
+	assert.NotNil(t, err)
+
+	p.message(bot.Message, makeMessage("user1", "!undo"))
+	f, err := GetSingleFact(mb.DB(), "coffee")
+	assert.Nil(t, err)
+	assert.Equal(t, "great", f.Tidbit)
+	assert.Equal(t, "user1", f.Owner)
+}
+
+func TestHistoryAndRevert(t *testing.T) {
+	p, mb := makeHistoryPlugin(t)
+	p.message(bot.Message, makeMessage("user1", "!coffee <is> great"))
+	p.message(bot.Message, makeMessage("user2", "!coffee =~ s/great/good/"))
+	p.message(bot.Message, makeMessage("user3", "!coffee =~ s/good/bad/"))
+
+	mb.Messages = nil
+	p.message(bot.Message, makeMessage("user1", "!history coffee"))
+	assert.Len(t, mb.Messages, 2)
+	assert.Contains(t, mb.Messages[0], "#2 coffee <is> good (owner user1, change by user3")
+	assert.Contains(t, mb.Messages[1], "#1 coffee <is> great")
+
+	p.message(bot.Message, makeMessage("user1", "!revert #1"))
+	f, err := GetSingleFact(mb.DB(), "coffee")
+	assert.Nil(t, err)
+	assert.Equal(t, "great", f.Tidbit)
+
+	// The revert itself can be undone
+	p.message(bot.Message, makeMessage("user1", "!undo"))
+	f, err = GetSingleFact(mb.DB(), "coffee")
+	assert.Nil(t, err)
+	assert.Equal(t, "bad", f.Tidbit)
+
+	p.message(bot.Message, makeMessage("user1", "!revert 99"))
+	assert.Contains(t, mb.Messages[len(mb.Messages)-1], "don't have a revision #99")
+}
+
+func TestChangeNeedsTrust(t *testing.T) {
+	h := transcript.New()
+	b := h.Bot()
+	b.AddPlugin(New(b))
+	out := h.Run([]transcript.Line{
+		{Channel: "#test", User: "alice", Body: "!coffee is great"},
+		{Channel: "#test", User: "alice", Body: "!coffee ~= s/great/terrible/"},
+		{Channel: "#test", User: "alice", Body: "!coffee =~ s/great/terrible/"},
+		{Channel: "#test", User: "alice", Body: "!coffee =~ /great/"},
+	})
+	assert.Equal(t, 2, strings.Count(out, "you need the trusted role"), out)
+	assert.Contains(t, out, "coffee is great")
+	assert.NotContains(t, out, "Changing")
+}
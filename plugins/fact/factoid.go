@@ -10,12 +10,16 @@ import (
 	"math/rand"
 	"net/http"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/velour/catbase/bot"
+	"github.com/velour/catbase/bot/audit"
+	"github.com/velour/catbase/bot/migrate"
 	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/config"
 )
 
 // The factoid plugin provides a learning system to the bot so that it can
@@ -33,6 +37,11 @@ type Factoid struct {
 	Count    int
 }
 
+// String gives the fact the way it would be learned
+func (f Factoid) String() string {
+	return fmt.Sprintf("%s <%s> %s", f.Fact, f.Verb, f.Tidbit)
+}
+
 type alias struct {
 	Fact string
 	Next string
@@ -77,7 +86,7 @@ func (a *alias) save(db *sqlx.DB) error {
 	if err != nil {
 		return fmt.Errorf("there is no fact at that destination")
 	}
-	q = `insert or replace into factoid_alias (fact, next) values (?, ?)`
+	q = config.DialectOf(db).Upsert("factoid_alias", []string{"fact", "next"})
 	_, err = db.Exec(q, a.Fact, a.Next)
 	if err != nil {
 		return err
@@ -112,7 +121,7 @@ func (f *Factoid) Save(db *sqlx.DB) error {
 		f.Created = time.Now()
 		f.Accessed = time.Now()
 		// insert
-		res, err := db.Exec(`insert into factoid (
+		id, err := config.DialectOf(db).InsertID(db, `insert into factoid (
 			fact,
 			tidbit,
 			verb,
@@ -132,7 +141,6 @@ func (f *Factoid) Save(db *sqlx.DB) error {
 		if err != nil {
 			return err
 		}
-		id, err := res.LastInsertId()
 		// hackhackhack?
 		f.ID.Int64 = id
 		f.ID.Valid = true
@@ -207,7 +215,7 @@ func GetSingle(db *sqlx.DB) (*Factoid, error) {
 			accessed,
 			count
 		from factoid
-		order by random() limit 1;`).Scan(
+		order by `+config.DialectOf(db).Random()+` limit 1;`).Scan(
 		&f.ID,
 		&f.Fact,
 		&f.Tidbit,
@@ -237,7 +245,7 @@ func GetSingleFact(db *sqlx.DB, fact string) (*Factoid, error) {
 			count
 		from factoid
 		where fact like ?
-		order by random() limit 1;`,
+		order by `+config.DialectOf(db).Random()+` limit 1;`,
 		fact).Scan(
 		&f.ID,
 		&f.Fact,
@@ -253,6 +261,36 @@ func GetSingleFact(db *sqlx.DB, fact string) (*Factoid, error) {
 	return &f, err
 }
 
+func getFactByID(db *sqlx.DB, id int64) (*Factoid, error) {
+	var f Factoid
+	var tmpCreated int64
+	var tmpAccessed int64
+	err := db.QueryRow(`select
+			id,
+			fact,
+			tidbit,
+			verb,
+			owner,
+			created,
+			accessed,
+			count
+		from factoid
+		where id=?;`,
+		id).Scan(
+		&f.ID,
+		&f.Fact,
+		&f.Tidbit,
+		&f.Verb,
+		&f.Owner,
+		&tmpCreated,
+		&tmpAccessed,
+		&f.Count,
+	)
+	f.Created = time.Unix(tmpCreated, 0)
+	f.Accessed = time.Unix(tmpAccessed, 0)
+	return &f, err
+}
+
 // Factoid provides the necessary plugin-wide needs
 type FactoidPlugin struct {
 	Bot      bot.Bot
@@ -261,6 +299,16 @@ type FactoidPlugin struct {
 	db       *sqlx.DB
 }
 
+func init() {
+	config.Register(
+		config.Key{Name: "Factoid.StartupFact", Default: "speed test", Description: "fact said after connecting"},
+		config.Key{Name: "Factoid.QuoteChance", Type: config.Float, Default: "0.99", Description: "chance of saying a fact when the channel is quiet"},
+		config.Key{Name: "Factoid.QuoteTime", Type: config.Int, Default: "30", Description: "minutes of quiet before saying a fact"},
+		config.Key{Name: "Factoid.MinLen", Type: config.Int, Default: "4", Description: "shortest trigger that can be learned"},
+		config.Key{Name: "Factoid.HistoryLimit", Type: config.Int, Default: "5", Description: "most revisions listed by history"},
+	)
+}
+
 // NewFactoid creates a new Factoid with the Plugin interface
 func New(botInst bot.Bot) *FactoidPlugin {
 	p := &FactoidPlugin{
@@ -276,34 +324,17 @@ func New(botInst bot.Bot) *FactoidPlugin {
 		db: botInst.DB(),
 	}
 
-	if _, err := p.db.Exec(`create table if not exists factoid (
-			id integer primary key,
-			fact string,
-			tidbit string,
-			verb string,
-			owner string,
-			created integer,
-			accessed integer,
-			count integer
-		);`); err != nil {
+	if err := migrate.Up(p.db, "fact"); err != nil {
 		log.Fatal(err)
 	}
 
-	if _, err := p.db.Exec(`create table if not exists factoid_alias (
-			fact string,
-			next string,
-			primary key (fact, next)
-		);`); err != nil {
-		log.Fatal(err)
-	}
+	bot.WatchChannels(botInst.Config(), "channels", p.factTimer)
 
 	for _, channel := range botInst.Config().GetArray("channels", []string{}) {
-		go p.factTimer(channel)
-
 		go func(ch string) {
 			// Some random time to start up
 			time.Sleep(time.Duration(15) * time.Second)
-			if ok, fact := p.findTrigger(p.Bot.Config().Get("Factoid.StartupFact", "speed test")); ok {
+			if ok, fact := p.findTrigger(p.Bot.Config().Get("Factoid.StartupFact", "")); ok {
 				p.sayFact(msg.Message{
 					Channel: ch,
 					Body:    "speed test", // BUG: This is defined in the config too
@@ -316,6 +347,9 @@ func New(botInst bot.Bot) *FactoidPlugin {
 
 	botInst.Register(p, bot.Message, p.message)
 	botInst.Register(p, bot.Help, p.help)
+	botInst.RequireRole(p, bot.Trusted, `(=~|~=)\s*s/`)
+	botInst.RequireRole(p, bot.Trusted, `^(undo$|revert\s)`)
+	botInst.RequireRole(p, bot.Trusted, `^forget that$`)
 
 	p.registerWeb()
 
@@ -410,13 +444,13 @@ func (p *FactoidPlugin) sayFact(message msg.Message, fact Factoid) {
 		}
 
 		if fact.Verb == "action" {
-			p.Bot.Send(bot.Action, message.Channel, msg)
+			p.Bot.Send(bot.Action, message, msg)
 		} else if fact.Verb == "react" {
 			p.Bot.Send(bot.Reaction, message.Channel, msg, message)
 		} else if fact.Verb == "reply" {
-			p.Bot.Send(bot.Message, message.Channel, msg)
+			p.Bot.Send(bot.Message, message, msg)
 		} else {
-			p.Bot.Send(bot.Message, message.Channel, full)
+			p.Bot.Send(bot.Message, message, full)
 		}
 	}
 
@@ -435,7 +469,7 @@ func (p *FactoidPlugin) sayFact(message msg.Message, fact Factoid) {
 // trigger checks the message for its fitness to be a factoid and then hauls
 // the message off to sayFact for processing if it is in fact a trigger
 func (p *FactoidPlugin) trigger(message msg.Message) bool {
-	minLen := p.Bot.Config().GetInt("Factoid.MinLen", 4)
+	minLen := p.Bot.Config().GetInt("Factoid.MinLen", 0)
 	if len(message.Body) > minLen || message.Command || message.Body == "..." {
 		if ok, fact := p.findTrigger(message.Body); ok {
 			p.sayFact(message, *fact)
@@ -462,7 +496,7 @@ func (p *FactoidPlugin) tellThemWhatThatWas(message msg.Message) bool {
 		msg = fmt.Sprintf("That was (#%d) '%s <%s> %s'",
 			fact.ID.Int64, fact.Fact, fact.Verb, fact.Tidbit)
 	}
-	p.Bot.Send(bot.Message, message.Channel, msg)
+	p.Bot.Send(bot.Message, message, msg)
 	return true
 }
 
@@ -480,21 +514,21 @@ func (p *FactoidPlugin) learnAction(message msg.Message, action string) bool {
 	action = strings.TrimSpace(action)
 
 	if len(trigger) == 0 || len(fact) == 0 || len(action) == 0 {
-		p.Bot.Send(bot.Message, message.Channel, "I don't want to learn that.")
+		p.Bot.Send(bot.Message, message, "I don't want to learn that.")
 		return true
 	}
 
 	if len(strings.Split(fact, "$and")) > 4 {
-		p.Bot.Send(bot.Message, message.Channel, "You can't use more than 4 $and operators.")
+		p.Bot.Send(bot.Message, message, "You can't use more than 4 $and operators.")
 		return true
 	}
 
 	strippedaction := strings.Replace(strings.Replace(action, "<", "", 1), ">", "", 1)
 
 	if err := p.learnFact(message, trigger, strippedaction, fact); err != nil {
-		p.Bot.Send(bot.Message, message.Channel, err.Error())
+		p.Bot.Send(bot.Message, message, err.Error())
 	} else {
-		p.Bot.Send(bot.Message, message.Channel, fmt.Sprintf("Okay, %s.", message.User.Name))
+		p.Bot.Send(bot.Message, message, fmt.Sprintf("Okay, %s.", message.User.Name))
 	}
 
 	return true
@@ -514,22 +548,112 @@ func changeOperator(body string) string {
 // an admin, it may be deleted
 func (p *FactoidPlugin) forgetLastFact(message msg.Message) bool {
 	if p.LastFact == nil {
-		p.Bot.Send(bot.Message, message.Channel, "I refuse.")
+		p.Bot.Send(bot.Message, message, "I refuse.")
 		return true
 	}
 
+	if err := saveRevision(p.db, p.LastFact, "forget", message.User.Name, message.Channel); err != nil {
+		log.Println("Error keeping history of fact: ", p.LastFact, err)
+	}
 	err := p.LastFact.delete(p.db)
 	if err != nil {
 		log.Println("Error removing fact: ", p.LastFact, err)
+	} else {
+		e := audit.New(message, "fact", "forget", p.LastFact.Fact)
+		e.Before = p.LastFact.String()
+		audit.Log(p.db, e)
 	}
 	fmt.Printf("Forgot #%d: %s %s %s\n", p.LastFact.ID.Int64, p.LastFact.Fact,
 		p.LastFact.Verb, p.LastFact.Tidbit)
-	p.Bot.Send(bot.Action, message.Channel, "hits himself over the head with a skillet")
+	p.Bot.Send(bot.Action, message, "hits himself over the head with a skillet")
 	p.LastFact = nil
 
 	return true
 }
 
+// undo puts back the fact most recently changed or forgotten in the channel
+func (p *FactoidPlugin) undo(message msg.Message) bool {
+	rev, err := lastRevision(p.db, message.Channel)
+	if err == sql.ErrNoRows {
+		p.Bot.Send(bot.Message, message, "There's nothing to undo.")
+		return true
+	} else if err != nil {
+		log.Println("Error finding fact to undo: ", err)
+		p.Bot.Send(bot.Message, message, "I couldn't undo that.")
+		return true
+	}
+	e := audit.New(message, "fact", "undo", rev.Fact)
+	if cur, err := getFactByID(p.db, rev.FactID); err == nil {
+		e.Before = cur.String()
+	}
+	f, err := rev.restore(p.db)
+	if err != nil {
+		log.Println("Error restoring fact: ", rev, err)
+		p.Bot.Send(bot.Message, message, "I couldn't undo that.")
+		return true
+	}
+	if err := rev.delete(p.db); err != nil {
+		log.Println("Error removing undone revision: ", rev, err)
+	}
+	e.After = f.String()
+	audit.Log(p.db, e)
+	p.Bot.Send(bot.Message, message, fmt.Sprintf("Okay, %s is back.", f))
+	return true
+}
+
+// revert puts back a particular revision, keeping the current version so it can be undone
+func (p *FactoidPlugin) revert(message msg.Message, idStr string) bool {
+	id, err := strconv.ParseInt(strings.TrimPrefix(idStr, "#"), 10, 64)
+	if err != nil {
+		p.Bot.Send(bot.Message, message, fmt.Sprintf("%s isn't a revision number.", idStr))
+		return true
+	}
+	rev, err := getRevision(p.db, id)
+	if err == sql.ErrNoRows {
+		p.Bot.Send(bot.Message, message, fmt.Sprintf("I don't have a revision #%d.", id))
+		return true
+	} else if err != nil {
+		log.Println("Error finding revision: ", id, err)
+		p.Bot.Send(bot.Message, message, "I couldn't revert that.")
+		return true
+	}
+	e := audit.New(message, "fact", "revert", rev.Fact)
+	if cur, err := getFactByID(p.db, rev.FactID); err == nil {
+		e.Before = cur.String()
+		if err := saveRevision(p.db, cur, "revert", message.User.Name, message.Channel); err != nil {
+			log.Println("Error keeping history of fact: ", cur, err)
+		}
+	}
+	f, err := rev.restore(p.db)
+	if err != nil {
+		log.Println("Error restoring fact: ", rev, err)
+		p.Bot.Send(bot.Message, message, "I couldn't revert that.")
+		return true
+	}
+	e.After = f.String()
+	audit.Log(p.db, e)
+	p.Bot.Send(bot.Message, message, fmt.Sprintf("Okay, %s is back.", f))
+	return true
+}
+
+// history lists the past versions of a trigger
+func (p *FactoidPlugin) history(message msg.Message, trigger string) bool {
+	revs, err := factHistory(p.db, strings.ToLower(trigger), p.Bot.Config().GetInt("Factoid.HistoryLimit", 0))
+	if err != nil {
+		log.Println("Error getting fact history: ", trigger, err)
+		p.Bot.Send(bot.Message, message, "I couldn't look that up.")
+		return true
+	}
+	if len(revs) == 0 {
+		p.Bot.Send(bot.Message, message, fmt.Sprintf("%s has never changed.", trigger))
+		return true
+	}
+	for _, r := range revs {
+		p.Bot.Send(bot.Message, message, r.String())
+	}
+	return true
+}
+
 // Allow users to change facts with a simple regexp
 func (p *FactoidPlugin) changeFact(message msg.Message) bool {
 	oper := changeOperator(message.Body)
@@ -544,7 +668,7 @@ func (p *FactoidPlugin) changeFact(message msg.Message) bool {
 	if len(parts) == 4 {
 		// replacement
 		if parts[0] != "s" {
-			p.Bot.Send(bot.Message, message.Channel, "Nah.")
+			p.Bot.Send(bot.Message, message, "Nah.")
 		}
 		find := parts[1]
 		replace := parts[2]
@@ -559,32 +683,42 @@ func (p *FactoidPlugin) changeFact(message msg.Message) bool {
 		}
 		// make the changes
 		msg := fmt.Sprintf("Changing %d facts.", len(result))
-		p.Bot.Send(bot.Message, message.Channel, msg)
+		p.Bot.Send(bot.Message, message, msg)
 		reg, err := regexp.Compile(find)
 		if err != nil {
-			p.Bot.Send(bot.Message, message.Channel, "I don't really want to.")
+			p.Bot.Send(bot.Message, message, "I don't really want to.")
 			return false
 		}
 		for _, fact := range result {
+			e := audit.New(message, "fact", "change", fact.Fact)
+			e.Before = fact.String()
+			if err := saveRevision(p.db, fact, "change", message.User.Name, message.Channel); err != nil {
+				log.Println("Error keeping history of fact: ", fact, err)
+			}
 			fact.Fact = reg.ReplaceAllString(fact.Fact, replace)
 			fact.Fact = strings.ToLower(fact.Fact)
 			fact.Verb = reg.ReplaceAllString(fact.Verb, replace)
 			fact.Tidbit = reg.ReplaceAllString(fact.Tidbit, replace)
 			fact.Count += 1
 			fact.Accessed = time.Now()
-			fact.Save(p.db)
+			if err := fact.Save(p.db); err != nil {
+				log.Println("Error changing fact: ", fact, err)
+				continue
+			}
+			e.After = fact.String()
+			audit.Log(p.db, e)
 		}
 	} else if len(parts) == 3 {
 		// search for a factoid and print it
 		result, err := getFacts(p.db, trigger, parts[1])
 		if err != nil {
 			log.Println("Error getting facts: ", trigger, err)
-			p.Bot.Send(bot.Message, message.Channel, "bzzzt")
+			p.Bot.Send(bot.Message, message, "bzzzt")
 			return true
 		}
 		count := len(result)
 		if count == 0 {
-			p.Bot.Send(bot.Message, message.Channel, "I didn't find any facts like that.")
+			p.Bot.Send(bot.Message, message, "I didn't find any facts like that.")
 			return true
 		}
 		if parts[2] == "g" && len(result) > 4 {
@@ -604,9 +738,9 @@ func (p *FactoidPlugin) changeFact(message msg.Message) bool {
 		if count > 4 {
 			msg = fmt.Sprintf("%s | ...and %d others", msg, count)
 		}
-		p.Bot.Send(bot.Message, message.Channel, msg)
+		p.Bot.Send(bot.Message, message, msg)
 	} else {
-		p.Bot.Send(bot.Message, message.Channel, "I don't know what you mean.")
+		p.Bot.Send(bot.Message, message, "I don't know what you mean.")
 	}
 	return true
 }
@@ -630,14 +764,14 @@ func (p *FactoidPlugin) message(kind bot.Kind, message msg.Message, args ...inte
 		m := strings.TrimPrefix(message.Body, "alias ")
 		parts := strings.SplitN(m, "->", 2)
 		if len(parts) != 2 {
-			p.Bot.Send(bot.Message, message.Channel, "If you want to alias something, use: `alias this -> that`")
+			p.Bot.Send(bot.Message, message, "If you want to alias something, use: `alias this -> that`")
 			return true
 		}
 		a := aliasFromStrings(strings.TrimSpace(parts[1]), strings.TrimSpace(parts[0]))
 		if err := a.save(p.db); err != nil {
-			p.Bot.Send(bot.Message, message.Channel, err.Error())
+			p.Bot.Send(bot.Message, message, err.Error())
 		} else {
-			p.Bot.Send(bot.Action, message.Channel, "learns a new synonym")
+			p.Bot.Send(bot.Action, message, "learns a new synonym")
 		}
 		return true
 	}
@@ -654,6 +788,23 @@ func (p *FactoidPlugin) message(kind bot.Kind, message msg.Message, args ...inte
 		return p.forgetLastFact(message)
 	}
 
+	if parts := strings.Fields(message.Body); len(parts) > 0 {
+		switch strings.ToLower(parts[0]) {
+		case "undo":
+			if len(parts) == 1 {
+				return p.undo(message)
+			}
+		case "revert":
+			if len(parts) == 2 {
+				return p.revert(message, parts[1])
+			}
+		case "history":
+			if len(parts) > 1 {
+				return p.history(message, strings.Join(parts[1:], " "))
+			}
+		}
+	}
+
 	if changeOperator(message.Body) != "" {
 		return p.changeFact(message)
 	}
@@ -669,14 +820,15 @@ func (p *FactoidPlugin) message(kind bot.Kind, message msg.Message, args ...inte
 	}
 
 	// We didn't find anything, panic!
-	p.Bot.Send(bot.Message, message.Channel, p.NotFound[rand.Intn(len(p.NotFound))])
+	p.Bot.Send(bot.Message, message, p.NotFound[rand.Intn(len(p.NotFound))])
 	return true
 }
 
 // Help responds to help requests. Every plugin must implement a help function.
 func (p *FactoidPlugin) help(kind bot.Kind, message msg.Message, args ...interface{}) bool {
-	p.Bot.Send(bot.Message, message.Channel, "I can learn facts and spit them back out. You can say \"this is that\" or \"he <has> $5\". Later, trigger the factoid by just saying the trigger word, \"this\" or \"he\" in these examples.")
-	p.Bot.Send(bot.Message, message.Channel, "I can also figure out some variables including: $nonzero, $digit, $nick, and $someone.")
+	p.Bot.Send(bot.Message, message, "I can learn facts and spit them back out. You can say \"this is that\" or \"he <has> $5\". Later, trigger the factoid by just saying the trigger word, \"this\" or \"he\" in these examples.")
+	p.Bot.Send(bot.Message, message, "I can also figure out some variables including: $nonzero, $digit, $nick, and $someone.")
+	p.Bot.Send(bot.Message, message, "Made a mistake? \"undo\" puts back the last fact changed or forgotten in this channel, \"history <trigger>\" lists old versions and \"revert <#>\" restores one.")
 	return true
 }
 
@@ -691,16 +843,22 @@ func (p *FactoidPlugin) randomFact() *Factoid {
 }
 
 // factTimer spits out a fact at a given interval and with given probability
-func (p *FactoidPlugin) factTimer(channel string) {
-	quoteTime := p.Bot.Config().GetInt("Factoid.QuoteTime", 30)
-	if quoteTime == 0 {
-		quoteTime = 30
-		p.Bot.Config().Set("Factoid.QuoteTime", "30")
-	}
-	duration := time.Duration(quoteTime) * time.Minute
+// until quit is closed
+func (p *FactoidPlugin) factTimer(channel string, quit <-chan struct{}) {
 	myLastMsg := time.Now()
 	for {
-		time.Sleep(time.Duration(5) * time.Second) // why 5?
+		select {
+		case <-quit:
+			return
+		case <-time.After(time.Duration(5) * time.Second): // why 5?
+		}
+
+		quoteTime := p.Bot.Config().GetInt("Factoid.QuoteTime", 0)
+		if quoteTime == 0 {
+			quoteTime = 30
+			p.Bot.Config().Set("Factoid.QuoteTime", "30")
+		}
+		duration := time.Duration(quoteTime) * time.Minute
 
 		lastmsg, err := p.Bot.LastMessage(channel)
 		if err != nil {
@@ -711,7 +869,7 @@ func (p *FactoidPlugin) factTimer(channel string) {
 		tdelta := time.Since(lastmsg.Time)
 		earlier := time.Since(myLastMsg) > tdelta
 		chance := rand.Float64()
-		quoteChance := p.Bot.Config().GetFloat64("Factoid.QuoteChance", 0.99)
+		quoteChance := p.Bot.Config().GetFloat64("Factoid.QuoteChance", 0)
 		if quoteChance == 0.0 {
 			quoteChance = 0.99
 			p.Bot.Config().Set("Factoid.QuoteChance", "0.99")
@@ -740,9 +898,8 @@ func (p *FactoidPlugin) factTimer(channel string) {
 
 // Register any web URLs desired
 func (p *FactoidPlugin) registerWeb() {
-	http.HandleFunc("/factoid/req", p.serveQuery)
-	http.HandleFunc("/factoid", p.serveQuery)
-	p.Bot.RegisterWeb("/factoid", "Factoid")
+	p.Bot.RegisterWeb("/factoid/req", "", bot.WebPublic, p.serveQuery)
+	p.Bot.RegisterWeb("/factoid", "Factoid", bot.WebPublic, p.serveQuery)
 }
 
 func linkify(text string) template.HTML {
@@ -0,0 +1,168 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+package fact
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/velour/catbase/bot/migrate"
+)
+
+// revision is a copy of a factoid from before it was changed or forgotten
+type revision struct {
+	ID        int64
+	FactID    int64
+	Fact      string
+	Tidbit    string
+	Verb      string
+	Owner     string
+	Created   time.Time
+	Count     int
+	Action    string
+	ChangedBy string
+	Changed   time.Time
+}
+
+func (r revision) String() string {
+	return fmt.Sprintf("#%d %s <%s> %s (owner %s, %s by %s %s)",
+		r.ID, r.Fact, r.Verb, r.Tidbit, r.Owner, r.Action, r.ChangedBy,
+		r.Changed.Format("2006-01-02 15:04"))
+}
+
+func init() {
+	migrate.Register("fact",
+		migrate.Migration{Version: 1, Description: "create factoid tables", SQL: `
+			create table if not exists factoid (
+				id integer primary key,
+				fact string,
+				tidbit string,
+				verb string,
+				owner string,
+				created integer,
+				accessed integer,
+				count integer
+			);
+			create table if not exists factoid_alias (
+				fact string,
+				next string,
+				primary key (fact, next)
+			);`},
+		migrate.Migration{Version: 2, Description: "keep factoid revisions", SQL: `
+			create table if not exists factoid_history (
+				id integer primary key,
+				fact_id integer,
+				fact string,
+				tidbit string,
+				verb string,
+				owner string,
+				created integer,
+				count integer,
+				action string,
+				changed_by string,
+				changed integer
+			);`},
+		migrate.Migration{Version: 3, Description: "keep the channel of factoid revisions", SQL: `
+			alter table factoid_history add column channel text;`},
+	)
+}
+
+// saveRevision keeps the current state of a factoid before who does action to
+// it in channel
+func saveRevision(db *sqlx.DB, f *Factoid, action, who, channel string) error {
+	if !f.ID.Valid {
+		return fmt.Errorf("cannot keep history of an unsaved fact")
+	}
+	_, err := db.Exec(`insert into factoid_history
+		(fact_id, fact, tidbit, verb, owner, created, count, action, changed_by, changed, channel)
+		values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		f.ID.Int64, f.Fact, f.Tidbit, f.Verb, f.Owner, f.Created.Unix(), f.Count,
+		action, who, time.Now().Unix(), channel)
+	return err
+}
+
+const revisionColumns = `id, fact_id, fact, tidbit, verb, owner, created, count, action, changed_by, changed`
+
+func scanRevisions(rows *sql.Rows) ([]revision, error) {
+	defer rows.Close()
+	revs := []revision{}
+	for rows.Next() {
+		var r revision
+		var created, changed int64
+		err := rows.Scan(&r.ID, &r.FactID, &r.Fact, &r.Tidbit, &r.Verb, &r.Owner,
+			&created, &r.Count, &r.Action, &r.ChangedBy, &changed)
+		if err != nil {
+			return nil, err
+		}
+		r.Created = time.Unix(created, 0)
+		r.Changed = time.Unix(changed, 0)
+		revs = append(revs, r)
+	}
+	return revs, rows.Err()
+}
+
+// getRevision finds a revision by ID
+func getRevision(db *sqlx.DB, id int64) (*revision, error) {
+	return findRevision(db, `select `+revisionColumns+` from factoid_history where id=?`, id)
+}
+
+// lastRevision finds the newest revision made in a channel, so an undo in
+// one channel can't take back a change made in another
+func lastRevision(db *sqlx.DB, channel string) (*revision, error) {
+	return findRevision(db, `select `+revisionColumns+` from factoid_history
+		where channel=? order by id desc limit 1`, channel)
+}
+
+func findRevision(db *sqlx.DB, q string, args ...interface{}) (*revision, error) {
+	rows, err := db.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	revs, err := scanRevisions(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(revs) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &revs[0], nil
+}
+
+// factHistory lists past versions of a trigger, including facts that have
+// since been renamed away from it, newest first
+func factHistory(db *sqlx.DB, trigger string, limit int) ([]revision, error) {
+	rows, err := db.Query(`select `+revisionColumns+` from factoid_history
+		where fact=? or fact_id in (select id from factoid where fact=?)
+		order by id desc limit ?`, trigger, trigger, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanRevisions(rows)
+}
+
+// restore puts a revision back, recreating the fact if it was forgotten
+func (r *revision) restore(db *sqlx.DB) (*Factoid, error) {
+	f, err := getFactByID(db, r.FactID)
+	if err == sql.ErrNoRows {
+		_, err = db.Exec(`insert into factoid
+			(id, fact, tidbit, verb, owner, created, accessed, count)
+			values (?, ?, ?, ?, ?, ?, ?, ?)`,
+			r.FactID, r.Fact, r.Tidbit, r.Verb, r.Owner, r.Created.Unix(), time.Now().Unix(), r.Count)
+		if err != nil {
+			return nil, err
+		}
+		return getFactByID(db, r.FactID)
+	} else if err != nil {
+		return nil, err
+	}
+	f.Fact, f.Tidbit, f.Verb, f.Owner = r.Fact, r.Tidbit, r.Verb, r.Owner
+	f.Accessed = time.Now()
+	return f, f.Save(db)
+}
+
+func (r *revision) delete(db *sqlx.DB) error {
+	_, err := db.Exec(`delete from factoid_history where id=?`, r.ID)
+	return err
+}
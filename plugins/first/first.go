@@ -12,7 +12,9 @@ import (
 
 	"github.com/jmoiron/sqlx"
 	"github.com/velour/catbase/bot"
+	"github.com/velour/catbase/bot/migrate"
 	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/config"
 )
 
 // This is a first plugin to serve as an example and quick copy/paste for new plugins.
@@ -46,16 +48,30 @@ func (fe *FirstEntry) save(db *sqlx.DB) error {
 	return nil
 }
 
+func init() {
+	config.Register(
+		config.Key{Name: "Bad.Msgs", Type: config.Array, Description: "messages that can't be first"},
+		config.Key{Name: "Bad.Hosts", Type: config.Array, Description: "hosts that can't be first"},
+		config.Key{Name: "Bad.Nicks", Type: config.Array, Description: "nicks that can't be first"},
+	)
+}
+
+func init() {
+	migrate.Register("first",
+		migrate.Migration{Version: 1, Description: "create first table", SQL: `
+			create table if not exists first (
+				id integer primary key,
+				day integer,
+				time integer,
+				body string,
+				nick string
+			);`},
+	)
+}
+
 // NewFirstPlugin creates a new FirstPlugin with the Plugin interface
 func New(b bot.Bot) *FirstPlugin {
-	_, err := b.DB().Exec(`create table if not exists first (
-			id integer primary key,
-			day integer,
-			time integer,
-			body string,
-			nick string
-		);`)
-	if err != nil {
+	if err := migrate.Up(b.DB(), "first"); err != nil {
 		log.Fatal("Could not create first table: ", err)
 	}
 
@@ -212,6 +228,6 @@ func (p *FirstPlugin) LoadData() {
 
 // Help responds to help requests. Every plugin must implement a help function.
 func (p *FirstPlugin) help(kind bot.Kind, message msg.Message, args ...interface{}) bool {
-	p.Bot.Send(bot.Message, message.Channel, "Sorry, First does not do a goddamn thing.")
+	p.Bot.Send(bot.Message, message, "Sorry, First does not do a goddamn thing.")
 	return true
 }
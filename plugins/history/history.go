@@ -0,0 +1,233 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+// Package history searches everything the bot has heard.
+package history
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/velour/catbase/bot"
+	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/bot/msglog"
+	"github.com/velour/catbase/config"
+)
+
+// contextLines is how many messages either side of a linked message are shown
+const contextLines = 10
+
+type HistoryPlugin struct {
+	Bot bot.Bot
+	cfg *config.Config
+}
+
+func init() {
+	config.Register(
+		config.Key{Name: "History.GrepLimit", Type: config.Int, Default: "5", Description: "most matches grep replies with"},
+		config.Key{Name: "History.WebLimit", Type: config.Int, Default: "200", Description: "most matches shown on the web"},
+		config.Key{Name: "History.Public", Type: config.Bool, Default: "false", Description: "let anyone browse the message log on the web, not just holders of Web.Token"},
+	)
+}
+
+func New(b bot.Bot) *HistoryPlugin {
+	p := &HistoryPlugin{
+		Bot: b,
+		cfg: b.Config(),
+	}
+	b.Register(p, bot.Message, p.message)
+	b.Register(p, bot.Help, p.help)
+	p.registerWeb()
+	return p
+}
+
+// grepRegex parses "grep <pattern> [in #chan] [from nick]"
+var grepRegex = regexp.MustCompile(`(?i)^grep\s+(.+?)(?:\s+in\s+(\S+))?(?:\s+from\s+(\S+))?$`)
+
+func (p *HistoryPlugin) message(kind bot.Kind, message msg.Message, args ...interface{}) bool {
+	if !message.Command {
+		return false
+	}
+	m := grepRegex.FindStringSubmatch(strings.TrimSpace(message.Body))
+	if m == nil {
+		return false
+	}
+
+	q := msglog.Query{
+		Pattern: m[1],
+		Channel: message.Channel,
+		User:    m[3],
+		Limit:   p.cfg.GetInt("History.GrepLimit", 0),
+	}
+	if m[2] != "" && !strings.EqualFold(m[2], message.Channel) {
+		// the log holds private messages too, only search where the asker can read
+		if !p.inChannel(message, m[2]) {
+			p.Bot.Send(bot.Message, message, fmt.Sprintf("You can only search channels you're in, and you're not in %s.", m[2]))
+			return true
+		}
+		q.Channel = m[2]
+	}
+	if _, err := regexp.Compile(q.Pattern); err != nil {
+		p.Bot.Send(bot.Message, message, fmt.Sprintf("That's not a pattern I understand: %s", err))
+		return true
+	}
+
+	entries, err := p.Bot.History(q)
+	if err != nil {
+		log.Printf("[history] error searching for %q: %s", q.Pattern, err)
+		p.Bot.Send(bot.Message, message, "I couldn't search my history.")
+		return true
+	}
+	if len(entries) == 0 {
+		p.Bot.Send(bot.Message, message, "I haven't heard anything like that.")
+		return true
+	}
+
+	// Oldest first reads naturally, one message each because IRC can't send newlines
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		line := fmt.Sprintf("%s %s", formatEntry(e), e.Body)
+		if p.public() {
+			// the page would ask anyone else for the web token
+			line += fmt.Sprintf(" (%s)", p.link(e))
+		}
+		p.Bot.Send(bot.Message, message, line)
+	}
+	return true
+}
+
+// inChannel checks that the sender of message is a member of channel.
+// Private conversations list only their own members, so this keeps
+// everyone else out of them.
+func (p *HistoryPlugin) inChannel(message msg.Message, channel string) bool {
+	if message.User == nil {
+		return false
+	}
+	for _, u := range p.Bot.Who(channel) {
+		if strings.EqualFold(u.Name, message.User.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *HistoryPlugin) help(kind bot.Kind, message msg.Message, args ...interface{}) bool {
+	p.Bot.Send(bot.Message, message, "Search what's been said with !grep <pattern> [in #channel] [from nick], in channels you're in. "+
+		"Patterns are regular expressions. Browse everything at "+p.baseURL()+"/history")
+	return true
+}
+
+// formatEntry gives the time, channel and speaker of a log entry
+func formatEntry(e msglog.Entry) string {
+	speaker := "<" + e.User.Name + ">"
+	if e.Action {
+		speaker = "* " + e.User.Name
+	}
+	return fmt.Sprintf("[%s] %s %s", e.Time.Format("2006-01-02 15:04"), e.Channel, speaker)
+}
+
+func (p *HistoryPlugin) baseURL() string {
+	return strings.TrimSuffix(p.cfg.Get("BaseURL", "http://"+p.cfg.Get("HttpAddr", "")), "/")
+}
+
+// link points at an entry in the context of its channel
+func (p *HistoryPlugin) link(e msglog.Entry) string {
+	return fmt.Sprintf("%s/history?around=%d#%d", p.baseURL(), e.ID, e.ID)
+}
+
+// registerWeb serves the page open to GETs and checks History.Public on
+// every request, so changing it in chat takes effect without a restart
+func (p *HistoryPlugin) registerWeb() {
+	p.Bot.RegisterWeb("/history", "History", bot.WebPublic, p.serveHistory)
+}
+
+func (p *HistoryPlugin) serveHistory(w http.ResponseWriter, r *http.Request) {
+	bot.Protect(p.cfg, p.webAccess(), p.serveQuery).ServeHTTP(w, r)
+}
+
+func (p *HistoryPlugin) public() bool {
+	public, _ := strconv.ParseBool(p.cfg.Get("History.Public", ""))
+	return public
+}
+
+// webAccess keeps the message log behind the web token unless History.Public is set
+func (p *HistoryPlugin) webAccess() bot.Access {
+	if p.public() {
+		return bot.WebPublic
+	}
+	return bot.WebAdmin
+}
+
+func (p *HistoryPlugin) serveQuery(w http.ResponseWriter, r *http.Request) {
+	context := map[string]interface{}{
+		"Pattern": r.FormValue("pattern"),
+		"Channel": r.FormValue("channel"),
+		"Nick":    r.FormValue("nick"),
+		"Around":  int64(0),
+	}
+
+	q := msglog.Query{
+		Pattern: r.FormValue("pattern"),
+		Channel: r.FormValue("channel"),
+		User:    r.FormValue("nick"),
+		Limit:   p.cfg.GetInt("History.WebLimit", 0),
+	}
+	if around, err := strconv.ParseInt(r.FormValue("around"), 10, 64); err == nil {
+		q = p.aroundQuery(around)
+		context["Around"] = around
+	}
+
+	if q.Pattern != "" {
+		if _, err := regexp.Compile(q.Pattern); err != nil {
+			context["Error"] = err.Error()
+		}
+	}
+	if context["Error"] == nil {
+		entries, err := p.Bot.History(q)
+		if err != nil {
+			log.Println("[history] web error searching: ", err)
+			context["Error"] = "Could not search history."
+		}
+		context["Entries"] = entries
+	}
+
+	funcMap := template.FuncMap{
+		"when": func(e msglog.Entry) string { return e.Time.Format("2006-01-02 15:04:05") },
+		"contextURL": func(e msglog.Entry) string {
+			return fmt.Sprintf("/history?around=%d#%d", e.ID, e.ID)
+		},
+	}
+	t, err := template.New("historyIndex").Funcs(funcMap).Parse(historyIndex)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if err := t.Execute(w, context); err != nil {
+		log.Println(err)
+	}
+}
+
+// aroundQuery finds the messages surrounding an entry in its channel
+func (p *HistoryPlugin) aroundQuery(id int64) msglog.Query {
+	q := msglog.Query{MinID: id, MaxID: id, Limit: 1}
+	entries, err := p.Bot.History(q)
+	if err != nil || len(entries) == 0 {
+		return q
+	}
+	channel := entries[0].Channel
+	// Bound the window by the IDs of the neighbours in the same channel
+	min, max := id, id
+	before, _ := p.Bot.History(msglog.Query{Channel: channel, MaxID: id, Limit: contextLines + 1})
+	if len(before) > 0 {
+		min = before[len(before)-1].ID
+	}
+	after, _ := p.Bot.History(msglog.Query{Channel: channel, MinID: id, Limit: contextLines + 1, Oldest: true})
+	if len(after) > 0 {
+		max = after[len(after)-1].ID
+	}
+	return msglog.Query{Channel: channel, MinID: min, MaxID: max, Oldest: true}
+}
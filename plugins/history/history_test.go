@@ -0,0 +1,141 @@
+package history
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/velour/catbase/bot"
+	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/bot/user"
+)
+
+func makeMessage(channel, nick, payload string) msg.Message {
+	isCmd := strings.HasPrefix(payload, "!")
+	if isCmd {
+		payload = payload[1:]
+	}
+	return msg.Message{
+		User:    &user.User{Name: nick},
+		Channel: channel,
+		Body:    payload,
+		Command: isCmd,
+		Time:    time.Date(2018, 1, 2, 3, 4, 5, 0, time.Local),
+	}
+}
+
+func setup(t *testing.T) (*HistoryPlugin, *bot.MockBot) {
+	mb := bot.NewMockBot()
+	mb.DB().MustExec(`delete from config`)
+	mb.Config().Set("BaseURL", "http://catbase.test/")
+	p := New(mb)
+	for _, m := range []msg.Message{
+		makeMessage("#test", "alice", "I like turtles"),
+		makeMessage("#test", "bob", "turtles are slow"),
+		makeMessage("#other", "alice", "turtles everywhere"),
+	} {
+		mb.Receive(bot.Message, m)
+	}
+	return p, mb
+}
+
+func TestGrep(t *testing.T) {
+	p, mb := setup(t)
+	assert.True(t, p.message(bot.Message, makeMessage("#test", "carol", "!grep turt")))
+	assert.Len(t, mb.Messages, 2)
+	assert.Equal(t, "[2018-01-02 03:04] #test <alice> I like turtles", mb.Messages[0])
+	assert.Contains(t, mb.Messages[1], "<bob> turtles are slow")
+}
+
+func TestGrepLinksPublicPage(t *testing.T) {
+	p, mb := setup(t)
+	mb.Config().Set("History.Public", "true")
+	p.message(bot.Message, makeMessage("#test", "carol", "!grep like turt"))
+	assert.Len(t, mb.Messages, 1)
+	assert.Equal(t, "[2018-01-02 03:04] #test <alice> I like turtles (http://catbase.test/history?around=1#1)", mb.Messages[0])
+}
+
+func TestGrepFilters(t *testing.T) {
+	p, mb := setup(t)
+	mb.Members = map[string][]string{"#other": {"alice", "carol"}}
+	p.message(bot.Message, makeMessage("#test", "carol", "!grep ^turtles in #other from alice"))
+	assert.Len(t, mb.Messages, 1)
+	assert.Contains(t, mb.Messages[0], "#other <alice> turtles everywhere")
+}
+
+func TestGrepOtherChannels(t *testing.T) {
+	p, mb := setup(t)
+	mb.Receive(bot.Message, makeMessage("alice", "alice", "my secret turtle"))
+	mb.Members = map[string][]string{"#other": {"alice"}, "alice": {"alice", "catbase"}}
+
+	p.message(bot.Message, makeMessage("#test", "carol", "!grep turtle in #other"))
+	p.message(bot.Message, makeMessage("#test", "carol", "!grep secret in alice"))
+	if assert.Len(t, mb.Messages, 2) {
+		assert.Contains(t, mb.Messages[0], "not in #other")
+		assert.Contains(t, mb.Messages[1], "not in alice")
+	}
+}
+
+func TestGrepNothing(t *testing.T) {
+	p, mb := setup(t)
+	p.message(bot.Message, makeMessage("#test", "carol", "!grep frogs"))
+	assert.Len(t, mb.Messages, 1)
+	assert.Contains(t, mb.Messages[0], "haven't heard")
+}
+
+func TestGrepBadPattern(t *testing.T) {
+	p, mb := setup(t)
+	p.message(bot.Message, makeMessage("#test", "carol", "!grep tur(tles"))
+	assert.Len(t, mb.Messages, 1)
+	assert.Contains(t, mb.Messages[0], "not a pattern")
+}
+
+func TestNotACommand(t *testing.T) {
+	p, mb := setup(t)
+	assert.False(t, p.message(bot.Message, makeMessage("#test", "carol", "grep turtles")))
+	assert.Empty(t, mb.Messages)
+}
+
+func TestServeQuery(t *testing.T) {
+	p, _ := setup(t)
+	w := httptest.NewRecorder()
+	p.serveQuery(w, httptest.NewRequest("GET", "/history?pattern=slow", nil))
+	assert.Contains(t, w.Body.String(), "turtles are slow")
+	assert.NotContains(t, w.Body.String(), "I like turtles")
+
+	w = httptest.NewRecorder()
+	p.serveQuery(w, httptest.NewRequest("GET", "/history?around=2", nil))
+	assert.Contains(t, w.Body.String(), "I like turtles")
+	assert.NotContains(t, w.Body.String(), "turtles everywhere")
+	assert.Contains(t, w.Body.String(), `class="highlight"`)
+}
+
+func TestWebAccess(t *testing.T) {
+	p, mb := setup(t)
+	assert.Equal(t, bot.WebAdmin, p.webAccess())
+	mb.Config().Set("History.Public", "true")
+	assert.Equal(t, bot.WebPublic, p.webAccess())
+}
+
+func TestServeHistoryChecksEachRequest(t *testing.T) {
+	p, mb := setup(t)
+	mb.Config().Set("Web.Token", "hunter2")
+
+	w := httptest.NewRecorder()
+	p.serveHistory(w, httptest.NewRequest("GET", "/history?pattern=slow", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	mb.Config().Set("History.Public", "true")
+	w = httptest.NewRecorder()
+	p.serveHistory(w, httptest.NewRequest("GET", "/history?pattern=slow", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "turtles are slow")
+
+	mb.Config().Set("History.Public", "false")
+	w = httptest.NewRecorder()
+	p.serveHistory(w, httptest.NewRequest("GET", "/history?pattern=slow", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,49 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+package history
+
+var historyIndex = `
+<!DOCTYPE html>
+<html>
+<head>
+	<title>History</title>
+	<link rel="stylesheet" href="https://cdnjs.cloudflare.com/ajax/libs/pure/0.6.0/pure-min.css">
+	<style>
+		.highlight { background-color: #ffffcc; }
+		td.when { white-space: nowrap; }
+	</style>
+</head>
+<body>
+	<div>
+		<form action="/history" method="GET" class="pure-form">
+			<fieldset>
+				<legend>Search the message history</legend>
+				<input type="text" name="pattern" placeholder="regular expression" value="{{.Pattern}}" />
+				<input type="text" name="channel" placeholder="#channel" value="{{.Channel}}" />
+				<input type="text" name="nick" placeholder="nick" value="{{.Nick}}" />
+				<button type="submit" class="pure-button notice">Search</button>
+			</fieldset>
+		</form>
+	</div>
+	{{if .Error}}
+	<p>{{.Error}}</p>
+	{{end}}
+	<table class="pure-table">
+		<thead>
+			<tr><th>When</th><th>Channel</th><th>Who</th><th>Message</th></tr>
+		</thead>
+		<tbody>
+		{{$around := .Around}}
+		{{range .Entries}}
+			<tr id="{{.ID}}"{{if eq .ID $around}} class="highlight"{{end}}>
+				<td class="when"><a href="{{contextURL .}}">{{when .}}</a></td>
+				<td>{{.Channel}}</td>
+				<td>{{.User.Name}}</td>
+				<td>{{if .Action}}<em>{{.Body}}</em>{{else}}{{.Body}}{{end}}</td>
+			</tr>
+		{{end}}
+		</tbody>
+	</table>
+</body>
+</html>
+`
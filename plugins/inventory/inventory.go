@@ -23,10 +23,16 @@ type InventoryPlugin struct {
 	r1, r2, r3, r4, r5 *regexp.Regexp
 }
 
+func init() {
+	config.Register(
+		config.Key{Name: "inventory.max", Type: config.Int, Default: "10", Description: "most items the bot holds"},
+	)
+}
+
 // New creates a new InventoryPlugin with the Plugin interface
 func New(b bot.Bot) *InventoryPlugin {
 	config := b.Config()
-	nick := config.Get("nick", "bot")
+	nick := config.Get("nick", "")
 	r1, err := regexp.Compile("take this (.+)")
 	checkerr(err)
 	r2, err := regexp.Compile("have a (.+)")
@@ -88,7 +94,7 @@ func (p *InventoryPlugin) message(kind bot.Kind, message msg.Message, args ...in
 				log.Printf("I think I have more than 0 items: %+v, len(items)=%d", items, len(items))
 				say = fmt.Sprintf("I'm currently holding %s", strings.Join(items, ", "))
 			}
-			p.bot.Send(bot.Message, message.Channel, say)
+			p.bot.Send(bot.Message, message, say)
 			return true
 		}
 
@@ -127,7 +133,7 @@ func (p *InventoryPlugin) message(kind bot.Kind, message msg.Message, args ...in
 
 func (p *InventoryPlugin) removeRandom() string {
 	var name string
-	err := p.QueryRow(`select item from inventory order by random() limit 1`).Scan(
+	err := p.QueryRow(`select item from inventory order by ` + config.DialectOf(p.DB).Random() + ` limit 1`).Scan(
 		&name,
 	)
 	if err != nil {
@@ -154,7 +160,7 @@ func (p *InventoryPlugin) count() int {
 
 func (p *InventoryPlugin) random() string {
 	var name string
-	err := p.QueryRow(`select item from inventory order by random() limit 1`).Scan(
+	err := p.QueryRow(`select item from inventory order by ` + config.DialectOf(p.DB).Random() + ` limit 1`).Scan(
 		&name,
 	)
 	if err != nil {
@@ -199,11 +205,11 @@ func (p *InventoryPlugin) remove(i string) {
 
 func (p *InventoryPlugin) addItem(m msg.Message, i string) bool {
 	if p.exists(i) {
-		p.bot.Send(bot.Message, m.Channel, fmt.Sprintf("I already have %s.", i))
+		p.bot.Send(bot.Message, m, fmt.Sprintf("I already have %s.", i))
 		return true
 	}
 	var removed string
-	max := p.config.GetInt("inventory.max", 10)
+	max := p.config.GetInt("inventory.max", 0)
 	if p.count() > max {
 		removed = p.removeRandom()
 	}
@@ -212,9 +218,9 @@ func (p *InventoryPlugin) addItem(m msg.Message, i string) bool {
 		log.Printf("Error inserting new inventory item: %s", err)
 	}
 	if removed != "" {
-		p.bot.Send(bot.Action, m.Channel, fmt.Sprintf("dropped %s and took %s from %s", removed, i, m.User.Name))
+		p.bot.Send(bot.Action, m, fmt.Sprintf("dropped %s and took %s from %s", removed, i, m.User.Name))
 	} else {
-		p.bot.Send(bot.Action, m.Channel, fmt.Sprintf("takes %s from %s", i, m.User.Name))
+		p.bot.Send(bot.Action, m, fmt.Sprintf("takes %s from %s", i, m.User.Name))
 	}
 	return true
 }
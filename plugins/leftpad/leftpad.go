@@ -19,6 +19,13 @@ type LeftpadPlugin struct {
 	config *config.Config
 }
 
+func init() {
+	config.Register(
+		config.Key{Name: "LeftPad.MaxLen", Type: config.Int, Default: "50", Description: "longest padding allowed"},
+		config.Key{Name: "LeftPad.Who", Default: "Putin", Description: "who gets blamed for long padding"},
+	)
+}
+
 // New creates a new LeftpadPlugin with the Plugin interface
 func New(b bot.Bot) *LeftpadPlugin {
 	p := &LeftpadPlugin{
@@ -43,20 +50,20 @@ func (p *LeftpadPlugin) message(kind bot.Kind, message msg.Message, args ...inte
 		padchar := parts[1]
 		length, err := strconv.Atoi(parts[2])
 		if err != nil {
-			p.bot.Send(bot.Message, message.Channel, "Invalid padding number")
+			p.bot.Send(bot.Message, message, "Invalid padding number")
 			return true
 		}
-		maxLen, who := p.config.GetInt("LeftPad.MaxLen", 50), p.config.Get("LeftPad.Who", "Putin")
+		maxLen, who := p.config.GetInt("LeftPad.MaxLen", 0), p.config.Get("LeftPad.Who", "")
 		if length > maxLen && maxLen > 0 {
 			msg := fmt.Sprintf("%s would kill me if I did that.", who)
-			p.bot.Send(bot.Message, message.Channel, msg)
+			p.bot.Send(bot.Message, message, msg)
 			return true
 		}
 		text := strings.Join(parts[3:], " ")
 
 		res := leftpad.LeftPad(text, length, padchar)
 
-		p.bot.Send(bot.Message, message.Channel, res)
+		p.bot.Send(bot.Message, message, res)
 		return true
 	}
 
@@ -81,7 +81,7 @@ func (p *NerdepediaPlugin) message(kind bot.Kind, message msg.Message, args ...i
 			}
 
 			if description != "" && link != "" {
-				p.bot.Send(bot.Message, message.Channel, fmt.Sprintf("%s (%s)", description, link))
+				p.bot.Send(bot.Message, message, fmt.Sprintf("%s (%s)", description, link))
 				return true
 			}
 		}
@@ -91,6 +91,6 @@ func (p *NerdepediaPlugin) message(kind bot.Kind, message msg.Message, args ...i
 
 // Help responds to help requests. Every plugin must implement a help function.
 func (p *NerdepediaPlugin) help(kind bot.Kind, message msg.Message, args ...interface{}) bool {
-	p.bot.Send(bot.Message, message.Channel, "nerd stuff")
+	p.bot.Send(bot.Message, message, "nerd stuff")
 	return true
 }
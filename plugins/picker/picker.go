@@ -39,14 +39,14 @@ func (p *PickerPlugin) message(kind bot.Kind, message msg.Message, args ...inter
 
 	n, items, err := p.parse(message.Body)
 	if err != nil {
-		p.Bot.Send(bot.Message, message.Channel, err.Error())
+		p.Bot.Send(bot.Message, message, err.Error())
 		return true
 	}
 
 	if n == 1 {
 		item := items[rand.Intn(len(items))]
 		out := fmt.Sprintf("I've chosen %q for you.", strings.TrimSpace(item))
-		p.Bot.Send(bot.Message, message.Channel, out)
+		p.Bot.Send(bot.Message, message, out)
 		return true
 	}
 
@@ -62,7 +62,7 @@ func (p *PickerPlugin) message(kind bot.Kind, message msg.Message, args ...inter
 		fmt.Fprintf(&b, ", %q", item)
 	}
 	b.WriteString(" }")
-	p.Bot.Send(bot.Message, message.Channel, b.String())
+	p.Bot.Send(bot.Message, message, b.String())
 	return true
 }
 
@@ -112,6 +112,6 @@ func (p *PickerPlugin) parse(body string) (int, []string, error) {
 
 // Help responds to help requests. Every plugin must implement a help function.
 func (p *PickerPlugin) help(kind bot.Kind, message msg.Message, args ...interface{}) bool {
-	p.Bot.Send(bot.Message, message.Channel, "Choose from a list of options. Try \"pick {a,b,c}\".")
+	p.Bot.Send(bot.Message, message, "Choose from a list of options. Try \"pick {a,b,c}\".")
 	return true
 }
@@ -15,6 +15,17 @@ type ReactionPlugin struct {
 	Config *config.Config
 }
 
+func init() {
+	config.Register(
+		config.Key{Name: "Reaction.GeneralChance", Type: config.Float, Default: "0.01", Description: "chance of reacting to any message"},
+		config.Key{Name: "Reaction.HarrassChance", Type: config.Float, Default: "0.05", Description: "chance of reacting to someone on the harass list"},
+		config.Key{Name: "Reaction.HarrassList", Type: config.Array, Description: "nicks to react to more often"},
+		config.Key{Name: "Reaction.NegativeHarrassmentMultiplier", Type: config.Int, Default: "2", Description: "how many more negative reactions the harass list gets"},
+		config.Key{Name: "Reaction.PositiveReactions", Type: config.Array, Description: "emoji for positive reactions"},
+		config.Key{Name: "Reaction.NegativeReactions", Type: config.Array, Description: "emoji for negative reactions"},
+	)
+}
+
 func New(b bot.Bot) *ReactionPlugin {
 	rp := &ReactionPlugin{
 		Bot:    b,
@@ -33,11 +44,11 @@ func (p *ReactionPlugin) message(kind bot.Kind, message msg.Message, args ...int
 		}
 	}
 
-	chance := p.Config.GetFloat64("Reaction.GeneralChance", 0.01)
+	chance := p.Config.GetFloat64("Reaction.GeneralChance", 0)
 	negativeWeight := 1
 	if harrass {
-		chance = p.Config.GetFloat64("Reaction.HarrassChance", 0.05)
-		negativeWeight = p.Config.GetInt("Reaction.NegativeHarrassmentMultiplier", 2)
+		chance = p.Config.GetFloat64("Reaction.HarrassChance", 0)
+		negativeWeight = p.Config.GetInt("Reaction.NegativeHarrassmentMultiplier", 0)
 	}
 
 	if rand.Float64() < chance {
@@ -9,19 +9,19 @@ import (
 	"github.com/jmoiron/sqlx"
 	"github.com/velour/catbase/bot"
 	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/bot/msglog"
+	"github.com/velour/catbase/config"
 	"github.com/velour/catbase/plugins/fact"
 )
 
 type RememberPlugin struct {
 	bot bot.Bot
-	log map[string][]msg.Message
 	db  *sqlx.DB
 }
 
 func New(b bot.Bot) *RememberPlugin {
 	p := &RememberPlugin{
 		bot: b,
-		log: make(map[string][]msg.Message),
 		db:  b.DB(),
 	}
 
@@ -34,7 +34,7 @@ func New(b bot.Bot) *RememberPlugin {
 func (p *RememberPlugin) message(kind bot.Kind, message msg.Message, args ...interface{}) bool {
 	if strings.ToLower(message.Body) == "quote" && message.Command {
 		q := p.randQuote()
-		p.bot.Send(bot.Message, message.Channel, q)
+		p.bot.Send(bot.Message, message, q)
 
 		// is it evil not to remember that the user said quote?
 		return true
@@ -50,57 +50,54 @@ func (p *RememberPlugin) message(kind bot.Kind, message msg.Message, args ...int
 		// fuck this hoser
 		nick := parts[1]
 		snip := strings.Join(parts[2:], " ")
-		for i := len(p.log[message.Channel]) - 1; i >= 0; i-- {
-			entry := p.log[message.Channel][i]
-			log.Printf("Comparing %s:%s with %s:%s",
-				entry.User.Name, entry.Body, nick, snip)
-			if strings.ToLower(entry.User.Name) == strings.ToLower(nick) &&
-				strings.Contains(
-					strings.ToLower(entry.Body),
-					strings.ToLower(snip),
-				) {
-				log.Printf("Found!")
-
-				var msg string
-				if entry.Action {
-					msg = fmt.Sprintf("*%s* %s", entry.User.Name, entry.Body)
-				} else {
-					msg = fmt.Sprintf("<%s> %s", entry.User.Name, entry.Body)
-				}
-
-				trigger := fmt.Sprintf("%s quotes", entry.User.Name)
-
-				fact := fact.Factoid{
-					Fact:     strings.ToLower(trigger),
-					Verb:     "reply",
-					Tidbit:   msg,
-					Owner:    user.Name,
-					Created:  time.Now(),
-					Accessed: time.Now(),
-					Count:    0,
-				}
-				if err := fact.Save(p.db); err != nil {
-					log.Println("ERROR!!!!:", err)
-					p.bot.Send(bot.Message, message.Channel, "Tell somebody I'm broke.")
-				}
-
-				log.Println("Remembering factoid:", msg)
-
-				// sorry, not creative with names so we're reusing msg
-				msg = fmt.Sprintf("Okay, %s, remembering '%s'.",
-					message.User.Name, msg)
-				p.bot.Send(bot.Message, message.Channel, msg)
-				p.recordMsg(message)
-				return true
+		entries, err := p.bot.History(msglog.Query{
+			Channel: message.Channel,
+			User:    nick,
+			Text:    snip,
+			Limit:   1,
+		})
+		if err != nil {
+			log.Println("Error searching history:", err)
+		}
+		if len(entries) > 0 {
+			entry := entries[0]
+			log.Printf("Found!")
+
+			var msg string
+			if entry.Action {
+				msg = fmt.Sprintf("*%s* %s", entry.User.Name, entry.Body)
+			} else {
+				msg = fmt.Sprintf("<%s> %s", entry.User.Name, entry.Body)
+			}
 
+			trigger := fmt.Sprintf("%s quotes", entry.User.Name)
+
+			fact := fact.Factoid{
+				Fact:     strings.ToLower(trigger),
+				Verb:     "reply",
+				Tidbit:   msg,
+				Owner:    user.Name,
+				Created:  time.Now(),
+				Accessed: time.Now(),
+				Count:    0,
+			}
+			if err := fact.Save(p.db); err != nil {
+				log.Println("ERROR!!!!:", err)
+				p.bot.Send(bot.Message, message, "Tell somebody I'm broke.")
 			}
+
+			log.Println("Remembering factoid:", msg)
+
+			// sorry, not creative with names so we're reusing msg
+			msg = fmt.Sprintf("Okay, %s, remembering '%s'.",
+				message.User.Name, msg)
+			p.bot.Send(bot.Message, message, msg)
+			return true
 		}
-		p.bot.Send(bot.Message, message.Channel, "Sorry, I don't know that phrase.")
-		p.recordMsg(message)
+		p.bot.Send(bot.Message, message, "Sorry, I don't know that phrase.")
 		return true
 	}
 
-	p.recordMsg(message)
 	return false
 }
 
@@ -110,7 +107,7 @@ func (p *RememberPlugin) help(kind bot.Kind, message msg.Message, args ...interf
 		"be any part of their message. Later on, you can ask for a random " +
 		"!quote."
 
-	p.bot.Send(bot.Message, message.Channel, msg)
+	p.bot.Send(bot.Message, message, msg)
 	return true
 }
 
@@ -123,7 +120,7 @@ func (p *RememberPlugin) randQuote() string {
 	var tmpCreated int64
 	var tmpAccessed int64
 	err := p.db.QueryRow(`select * from factoid where fact like '%quotes'
-		order by random() limit 1;`).Scan(
+		order by `+config.DialectOf(p.db).Random()+` limit 1;`).Scan(
 		&f.ID,
 		&f.Fact,
 		&f.Tidbit,
@@ -142,8 +139,3 @@ func (p *RememberPlugin) randQuote() string {
 
 	return f.Tidbit
 }
-
-func (p *RememberPlugin) recordMsg(message msg.Message) {
-	log.Printf("Logging message: %s: %s", message.User.Name, message.Body)
-	p.log[message.Channel] = append(p.log[message.Channel], message)
-}
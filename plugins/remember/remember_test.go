@@ -44,6 +44,7 @@ func TestCornerCaseBug(t *testing.T) {
 
 	for _, m := range msgs {
 		p.message(bot.Message, m)
+		mb.Receive(bot.Message, m)
 	}
 	assert.Len(t, mb.Messages, 1)
 	assert.Contains(t, mb.Messages[0], "horse dick")
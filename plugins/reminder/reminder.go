@@ -13,6 +13,8 @@ import (
 
 	"github.com/jmoiron/sqlx"
 	"github.com/velour/catbase/bot"
+	"github.com/velour/catbase/bot/audit"
+	"github.com/velour/catbase/bot/migrate"
 	"github.com/velour/catbase/bot/msg"
 	"github.com/velour/catbase/config"
 )
@@ -38,16 +40,30 @@ type Reminder struct {
 	channel string
 }
 
+func init() {
+	config.Register(
+		config.Key{Name: "Reminder.MaxBatchAdd", Type: config.Int, Default: "10", Description: "most reminders one command can add"},
+		config.Key{Name: "Reminder.MaxList", Type: config.Int, Default: "25", Description: "most reminders listed at once"},
+	)
+}
+
+func init() {
+	migrate.Register("reminder",
+		migrate.Migration{Version: 1, Description: "create reminders table", SQL: `
+			create table if not exists reminders (
+				id integer primary key,
+				fromWho string,
+				toWho string,
+				what string,
+				remindWhen string,
+				channel string
+			);`},
+	)
+}
+
 func New(b bot.Bot) *ReminderPlugin {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
-	if _, err := b.DB().Exec(`create table if not exists reminders (
-			id integer primary key,
-			fromWho string,
-			toWho string,
-			what string,
-			remindWhen string,
-			channel string
-		);`); err != nil {
+	if err := migrate.Up(b.DB(), "reminder"); err != nil {
 		log.Fatal(err)
 	}
 
@@ -124,7 +140,7 @@ func (p *ReminderPlugin) message(kind bot.Kind, message msg.Message, args ...int
 				endTime := time.Now().UTC().Add(dur2)
 				what := strings.Join(parts[6:], " ")
 
-				max := p.config.GetInt("Reminder.MaxBatchAdd", 10)
+				max := p.config.GetInt("Reminder.MaxBatchAdd", 0)
 				for i := 0; when.Before(endTime); i++ {
 					if i >= max {
 						p.Bot.Send(bot.Message, channel, "Easy cowboy, that's a lot of reminders. I'll add some of them.")
@@ -182,8 +198,15 @@ func (p *ReminderPlugin) message(kind bot.Kind, message msg.Message, args ...int
 			p.Bot.Send(bot.Message, channel, fmt.Sprintf("couldn't parse id: %s", parts[2]))
 
 		} else {
+			e := audit.New(message, "reminder", "cancel", parts[2])
+			var from, to, what string
+			row := p.db.QueryRow(`select fromWho, toWho, what from reminders where id = ?;`, id)
+			if row.Scan(&from, &to, &what) == nil {
+				e.Before = fmt.Sprintf("%s reminding %s: %s", from, to, what)
+			}
 			err := p.deleteReminder(id)
 			if err == nil {
+				audit.Log(p.db, e)
 				p.Bot.Send(bot.Message, channel, fmt.Sprintf("successfully canceled reminder: %s", parts[2]))
 			} else {
 				p.Bot.Send(bot.Message, channel, fmt.Sprintf("failed to find and cancel reminder: %s", parts[2]))
@@ -196,7 +219,7 @@ func (p *ReminderPlugin) message(kind bot.Kind, message msg.Message, args ...int
 }
 
 func (p *ReminderPlugin) help(kind bot.Kind, message msg.Message, args ...interface{}) bool {
-	p.Bot.Send(bot.Message, message.Channel, "Pester someone with a reminder. Try \"remind <user> in <duration> message\".\n\nUnsure about duration syntax? Check https://golang.org/pkg/time/#ParseDuration")
+	p.Bot.Send(bot.Message, message, "Pester someone with a reminder. Try \"remind <user> in <duration> message\".\n\nUnsure about duration syntax? Check https://golang.org/pkg/time/#ParseDuration")
 	return true
 }
 
@@ -265,7 +288,7 @@ func (p *ReminderPlugin) deleteReminder(id int64) error {
 }
 
 func (p *ReminderPlugin) getRemindersFormatted(filter string) (string, error) {
-	max := p.config.GetInt("Reminder.MaxList", 25)
+	max := p.config.GetInt("Reminder.MaxList", 0)
 	queryString := fmt.Sprintf("select id, fromWho, toWho, what, remindWhen from reminders %s order by remindWhen asc limit %d;", filter, max)
 	countString := fmt.Sprintf("select COUNT(*) from reminders %s;", filter)
 
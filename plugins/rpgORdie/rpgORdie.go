@@ -111,7 +111,7 @@ func New(b bot.Bot) *RPGPlugin {
 func (p *RPGPlugin) message(kind bot.Kind, message msg.Message, args ...interface{}) bool {
 	if strings.ToLower(message.Body) == "start rpg" {
 		b := NewRandomBoard()
-		ts, _ := p.Bot.Send(bot.Message, message.Channel, b.toMessageString())
+		ts, _ := p.Bot.Send(bot.Message, message, b.toMessageString())
 		p.listenFor[ts] = b
 		p.Bot.Send(bot.Reply, message.Channel, "Over here.", ts)
 		return true
@@ -120,13 +120,13 @@ func (p *RPGPlugin) message(kind bot.Kind, message msg.Message, args ...interfac
 }
 
 func (p *RPGPlugin) help(kind bot.Kind, message msg.Message, args ...interface{}) bool {
-	p.Bot.Send(bot.Message, message.Channel, "Go find a walkthrough or something.")
+	p.Bot.Send(bot.Message, message, "Go find a walkthrough or something.")
 	return true
 }
 
 func (p *RPGPlugin) replyMessage(kind bot.Kind, message msg.Message, args ...interface{}) bool {
 	identifier := args[0].(string)
-	if strings.ToLower(message.User.Name) != strings.ToLower(p.Bot.Config().Get("Nick", "bot")) {
+	if strings.ToLower(message.User.Name) != strings.ToLower(p.Bot.Config().Get("Nick", "")) {
 		if b, ok := p.listenFor[identifier]; ok {
 
 			var res int
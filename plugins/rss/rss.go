@@ -3,17 +3,22 @@ package rss
 import (
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/velour/catbase/bot"
 	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/config"
 
 	"github.com/mmcdole/gofeed"
 )
 
 type RSSPlugin struct {
-	Bot       bot.Bot
-	cache     map[string]*cacheItem
+	Bot   bot.Bot
+	cache map[string]*cacheItem
+
+	// settings guards shelfLife and maxLines, which change when they are set
+	settings  sync.Mutex
 	shelfLife time.Duration
 	maxLines  int
 }
@@ -49,37 +54,59 @@ func (c *cacheItem) getCurrentPage(maxLines int) string {
 	return page
 }
 
+func init() {
+	config.Register(
+		config.Key{Name: "rss.maxLines", Type: config.Int, Default: "5", Description: "most items shown from a feed"},
+		config.Key{Name: "rss.shelfLife", Type: config.Int, Default: "20", Description: "minutes a fetched feed is cached"},
+	)
+}
+
 func New(b bot.Bot) *RSSPlugin {
 	rss := &RSSPlugin{
-		Bot:       b,
-		cache:     map[string]*cacheItem{},
-		shelfLife: time.Minute * time.Duration(b.Config().GetInt("rss.shelfLife", 20)),
-		maxLines:  b.Config().GetInt("rss.maxLines", 5),
+		Bot:   b,
+		cache: map[string]*cacheItem{},
 	}
+	rss.loadSettings()
+	b.Config().Watch("rss.shelfLife", func(_, _ string) { rss.loadSettings() })
+	b.Config().Watch("rss.maxLines", func(_, _ string) { rss.loadSettings() })
 	b.Register(rss, bot.Message, rss.message)
 	b.Register(rss, bot.Help, rss.help)
 	return rss
 }
 
+func (p *RSSPlugin) loadSettings() {
+	p.settings.Lock()
+	defer p.settings.Unlock()
+	p.shelfLife = time.Minute * time.Duration(p.Bot.Config().GetInt("rss.shelfLife", 0))
+	p.maxLines = p.Bot.Config().GetInt("rss.maxLines", 0)
+}
+
+func (p *RSSPlugin) getSettings() (time.Duration, int) {
+	p.settings.Lock()
+	defer p.settings.Unlock()
+	return p.shelfLife, p.maxLines
+}
+
 func (p *RSSPlugin) message(kind bot.Kind, message msg.Message, args ...interface{}) bool {
 	tokens := strings.Fields(message.Body)
 	numTokens := len(tokens)
 
 	if numTokens == 2 && strings.ToLower(tokens[0]) == "rss" {
+		shelfLife, maxLines := p.getSettings()
 		if item, ok := p.cache[strings.ToLower(tokens[1])]; ok && time.Now().Before(item.expiration) {
-			p.Bot.Send(bot.Message, message.Channel, item.getCurrentPage(p.maxLines))
+			p.Bot.Send(bot.Message, message, item.getCurrentPage(maxLines))
 			return true
 		} else {
 			fp := gofeed.NewParser()
 			feed, err := fp.ParseURL(tokens[1])
 			if err != nil {
-				p.Bot.Send(bot.Message, message.Channel, fmt.Sprintf("RSS error: %s", err.Error()))
+				p.Bot.Send(bot.Message, message, fmt.Sprintf("RSS error: %s", err.Error()))
 				return true
 			}
 			item := &cacheItem{
 				key:         strings.ToLower(tokens[1]),
 				data:        []string{feed.Title},
-				expiration:  time.Now().Add(p.shelfLife),
+				expiration:  time.Now().Add(shelfLife),
 				currentLine: 0,
 			}
 
@@ -89,7 +116,7 @@ func (p *RSSPlugin) message(kind bot.Kind, message msg.Message, args ...interfac
 
 			p.cache[strings.ToLower(tokens[1])] = item
 
-			p.Bot.Send(bot.Message, message.Channel, item.getCurrentPage(p.maxLines))
+			p.Bot.Send(bot.Message, message, item.getCurrentPage(maxLines))
 			return true
 		}
 	}
@@ -99,6 +126,6 @@ func (p *RSSPlugin) message(kind bot.Kind, message msg.Message, args ...interfac
 
 // Help responds to help requests. Every plugin must implement a help function.
 func (p *RSSPlugin) help(kind bot.Kind, message msg.Message, args ...interface{}) bool {
-	p.Bot.Send(bot.Message, message.Channel, "try '!rss http://rss.cnn.com/rss/edition.rss'")
+	p.Bot.Send(bot.Message, message, "try '!rss http://rss.cnn.com/rss/edition.rss'")
 	return true
 }
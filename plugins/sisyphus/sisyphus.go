@@ -10,6 +10,7 @@ import (
 
 	"github.com/velour/catbase/bot"
 	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/config"
 )
 
 const (
@@ -37,6 +38,15 @@ type game struct {
 	nextAns  int
 }
 
+func init() {
+	config.Register(
+		config.Key{Name: "Sisyphus.MinDecrement", Type: config.Int, Default: "10", Description: "least the boulder rolls back"},
+		config.Key{Name: "Sisyphus.MaxDecrement", Type: config.Int, Default: "30", Description: "most the boulder rolls back"},
+		config.Key{Name: "Sisyphus.MinPush", Type: config.Int, Default: "1", Description: "least a push moves the boulder"},
+		config.Key{Name: "Sisyphus.MaxPush", Type: config.Int, Default: "10", Description: "most a push moves the boulder"},
+	)
+}
+
 func NewRandomGame(b bot.Bot, channel, who string) *game {
 	size := rand.Intn(9) + 2
 	g := game{
@@ -59,8 +69,8 @@ func (g *game) scheduleDecrement() {
 	if g.timers[0] != nil {
 		g.timers[0].Stop()
 	}
-	minDec := g.bot.Config().GetInt("Sisyphus.MinDecrement", 10)
-	maxDec := g.bot.Config().GetInt("Sisyphus.MaxDecrement", 30)
+	minDec := g.bot.Config().GetInt("Sisyphus.MinDecrement", 0)
+	maxDec := g.bot.Config().GetInt("Sisyphus.MaxDecrement", 0)
 	g.nextDec = time.Now().Add(time.Duration((minDec + rand.Intn(maxDec))) * time.Minute)
 	go func() {
 		t := time.NewTimer(g.nextDec.Sub(time.Now()))
@@ -76,8 +86,8 @@ func (g *game) schedulePush() {
 	if g.timers[1] != nil {
 		g.timers[1].Stop()
 	}
-	minPush := g.bot.Config().GetInt("Sisyphus.MinPush", 1)
-	maxPush := g.bot.Config().GetInt("Sisyphus.MaxPush", 10)
+	minPush := g.bot.Config().GetInt("Sisyphus.MinPush", 0)
+	maxPush := g.bot.Config().GetInt("Sisyphus.MaxPush", 0)
 	g.nextPush = time.Now().Add(time.Duration(rand.Intn(maxPush)+minPush) * time.Minute)
 	go func() {
 		t := time.NewTimer(g.nextPush.Sub(time.Now()))
@@ -183,13 +193,13 @@ func (p *SisyphusPlugin) message(kind bot.Kind, message msg.Message, args ...int
 }
 
 func (p *SisyphusPlugin) help(kind bot.Kind, message msg.Message, args ...interface{}) bool {
-	p.Bot.Send(bot.Message, message.Channel, "https://en.wikipedia.org/wiki/Sisyphus")
+	p.Bot.Send(bot.Message, message, "https://en.wikipedia.org/wiki/Sisyphus")
 	return true
 }
 
 func (p *SisyphusPlugin) replyMessage(kind bot.Kind, message msg.Message, args ...interface{}) bool {
 	identifier := args[0].(string)
-	if strings.ToLower(message.User.Name) != strings.ToLower(p.Bot.Config().Get("Nick", "bot")) {
+	if strings.ToLower(message.User.Name) != strings.ToLower(p.Bot.Config().Get("Nick", "")) {
 		if g, ok := p.listenFor[identifier]; ok {
 
 			log.Printf("got message on %s: %+v", identifier, message)
@@ -212,7 +222,7 @@ func (p *SisyphusPlugin) replyMessage(kind bot.Kind, message msg.Message, args .
 				} else {
 					p.Bot.Send(bot.Reply, message.Channel, "you lose", identifier)
 					msg := fmt.Sprintf("%s just lost the sisyphus game after %s", g.who, time.Now().Sub(g.start))
-					p.Bot.Send(bot.Message, message.Channel, msg)
+					p.Bot.Send(bot.Message, message, msg)
 					g.endGame()
 				}
 			} else {
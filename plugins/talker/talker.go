@@ -84,6 +84,6 @@ func (p *TalkerPlugin) message(kind bot.Kind, message msg.Message, args ...inter
 }
 
 func (p *TalkerPlugin) help(kind bot.Kind, message msg.Message, args ...interface{}) bool {
-	p.Bot.Send(bot.Message, message.Channel, "Hi, this is talker. I like to talk about FredFelps!")
+	p.Bot.Send(bot.Message, message, "Hi, this is talker. I like to talk about FredFelps!")
 	return true
 }
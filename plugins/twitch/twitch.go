@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"text/template"
 	"time"
 
@@ -24,8 +25,10 @@ const (
 )
 
 type TwitchPlugin struct {
-	Bot        bot.Bot
-	config     *config.Config
+	Bot    bot.Bot
+	config *config.Config
+
+	sync.Mutex
 	twitchList map[string]*Twitcher
 }
 
@@ -58,6 +61,18 @@ type stream struct {
 	} `json:"pagination"`
 }
 
+func init() {
+	config.Register(
+		config.Key{Name: "Twitch.ClientID", Description: "API client ID", Secret: true},
+		config.Key{Name: "Twitch.Authorization", Description: "API authorization token", Secret: true},
+		config.Key{Name: "Twitch.Channels", Type: config.Array, Description: "channels to announce streams in"},
+		config.Key{Name: "Twitch.Freq", Type: config.Int, Default: "60", Description: "seconds between stream checks"},
+		config.Key{Name: "Twitch.IsTpl", Description: "template for a stream going live"},
+		config.Key{Name: "Twitch.NotTpl", Description: "template for a stream that is offline"},
+		config.Key{Name: "Twitch.StoppedTpl", Description: "template for a stream ending"},
+	)
+}
+
 func New(b bot.Bot) *TwitchPlugin {
 	p := &TwitchPlugin{
 		Bot:        b,
@@ -65,17 +80,7 @@ func New(b bot.Bot) *TwitchPlugin {
 		twitchList: map[string]*Twitcher{},
 	}
 
-	for _, ch := range p.config.GetArray("Twitch.Channels", []string{}) {
-		for _, twitcherName := range p.config.GetArray("Twitch."+ch+".Users", []string{}) {
-			if _, ok := p.twitchList[twitcherName]; !ok {
-				p.twitchList[twitcherName] = &Twitcher{
-					name:   twitcherName,
-					gameID: "",
-				}
-			}
-		}
-		go p.twitchLoop(ch)
-	}
+	bot.WatchChannels(p.config, "Twitch.Channels", p.twitchLoop)
 
 	b.Register(p, bot.Message, p.message)
 	b.Register(p, bot.Help, p.help)
@@ -84,8 +89,22 @@ func New(b bot.Bot) *TwitchPlugin {
 	return p
 }
 
+// twitcher finds the streamer with the given name, starting to follow them
+// if they are new
+func (p *TwitchPlugin) twitcher(name string) *Twitcher {
+	p.Lock()
+	defer p.Unlock()
+	if _, ok := p.twitchList[name]; !ok {
+		p.twitchList[name] = &Twitcher{
+			name:   name,
+			gameID: "",
+		}
+	}
+	return p.twitchList[name]
+}
+
 func (p *TwitchPlugin) registerWeb() {
-	http.HandleFunc("/isstreaming/", p.serveStreaming)
+	p.Bot.RegisterWeb("/isstreaming/", "", bot.WebPublic, p.serveStreaming)
 }
 
 func (p *TwitchPlugin) serveStreaming(w http.ResponseWriter, r *http.Request) {
@@ -95,7 +114,9 @@ func (p *TwitchPlugin) serveStreaming(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	p.Lock()
 	twitcher := p.twitchList[pathParts[2]]
+	p.Unlock()
 	if twitcher == nil {
 
 		fmt.Fprint(w, "User not found.")
@@ -125,9 +146,7 @@ func (p *TwitchPlugin) message(kind bot.Kind, message msg.Message, args ...inter
 		channel := message.Channel
 		if users := p.config.GetArray("Twitch."+channel+".Users", []string{}); len(users) > 0 {
 			for _, twitcherName := range users {
-				if _, ok := p.twitchList[twitcherName]; ok {
-					p.checkTwitch(channel, p.twitchList[twitcherName], true)
-				}
+				p.checkTwitch(channel, p.twitcher(twitcherName), true)
 			}
 		}
 		return true
@@ -147,24 +166,29 @@ func (p *TwitchPlugin) help(kind bot.Kind, message msg.Message, args ...interfac
 	msg += fmt.Sprintf("twitch.stoppedtpl (default: %s)\n", stoppedStreamingTplFallback)
 	msg += "You can reset all messages with `!reset twitch`"
 	msg += "And you can ask who is streaming with `!twitch status`"
-	p.Bot.Send(bot.Message, message.Channel, msg)
+	p.Bot.Send(bot.Message, message, msg)
 	return true
 }
 
-func (p *TwitchPlugin) twitchLoop(channel string) {
-	frequency := p.config.GetInt("Twitch.Freq", 60)
-	if p.config.Get("twitch.clientid", "") == "" || p.config.Get("twitch.authorization", "") == "" {
-		log.Println("Disabling twitch autochecking.")
-		return
-	}
-
-	log.Println("Checking every ", frequency, " seconds")
-
+// twitchLoop checks on the streamers followed in channel until quit is closed.
+// Users, frequency and credentials are reread each time so they can be changed live.
+func (p *TwitchPlugin) twitchLoop(channel string, quit <-chan struct{}) {
 	for {
-		time.Sleep(time.Duration(frequency) * time.Second)
+		frequency := p.config.GetInt("Twitch.Freq", 0)
+		if frequency <= 0 {
+			frequency = 60
+		}
+		select {
+		case <-quit:
+			return
+		case <-time.After(time.Duration(frequency) * time.Second):
+		}
 
+		if p.config.Get("twitch.clientid", "") == "" || p.config.Get("twitch.authorization", "") == "" {
+			continue
+		}
 		for _, twitcherName := range p.config.GetArray("Twitch."+channel+".Users", []string{}) {
-			p.checkTwitch(channel, p.twitchList[twitcherName], false)
+			p.checkTwitch(channel, p.twitcher(twitcherName), false)
 		}
 	}
 }
@@ -16,6 +16,13 @@ type YourPlugin struct {
 	config *config.Config
 }
 
+func init() {
+	config.Register(
+		config.Key{Name: "your.maxlength", Type: config.Int, Default: "140", Description: "longest message that gets corrected"},
+		config.Key{Name: "Your.Replacements", Type: config.Array, Description: "names of replacement rules under your.replacements.<name>"},
+	)
+}
+
 // NewYourPlugin creates a new YourPlugin with the Plugin interface
 func New(b bot.Bot) *YourPlugin {
 	yp := &YourPlugin{
@@ -31,7 +38,7 @@ func New(b bot.Bot) *YourPlugin {
 // This function returns true if the plugin responds in a meaningful way to the users message.
 // Otherwise, the function returns false and the bot continues execution of other plugins.
 func (p *YourPlugin) message(kind bot.Kind, message msg.Message, args ...interface{}) bool {
-	maxLen := p.config.GetInt("your.maxlength", 140)
+	maxLen := p.config.GetInt("your.maxlength", 0)
 	if len(message.Body) > maxLen {
 		return false
 	}
@@ -46,7 +53,7 @@ func (p *YourPlugin) message(kind bot.Kind, message msg.Message, args ...interfa
 		}
 	}
 	if msg != message.Body {
-		p.bot.Send(bot.Message, message.Channel, msg)
+		p.bot.Send(bot.Message, message, msg)
 		return true
 	}
 	return false
@@ -54,6 +61,6 @@ func (p *YourPlugin) message(kind bot.Kind, message msg.Message, args ...interfa
 
 // Help responds to help requests. Every plugin must implement a help function.
 func (p *YourPlugin) help(kind bot.Kind, message msg.Message, args ...interface{}) bool {
-	p.bot.Send(bot.Message, message.Channel, "Your corrects people's grammar.")
+	p.bot.Send(bot.Message, message, "Your corrects people's grammar.")
 	return true
 }
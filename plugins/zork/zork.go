@@ -117,6 +117,6 @@ func (p *ZorkPlugin) message(kind bot.Kind, message msg.Message, args ...interfa
 }
 
 func (p *ZorkPlugin) help(kind bot.Kind, message msg.Message, args ...interface{}) bool {
-	p.bot.Send(bot.Message, message.Channel, "Play zork using 'zork <zork command>'.")
+	p.bot.Send(bot.Message, message, "Play zork using 'zork <zork command>'.")
 	return true
 }